@@ -0,0 +1,85 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"context"
+	"net/http"
+)
+
+// HandleChain registers a chain of request handles with the given path and
+// method, like Handle. Requests matching the route are passed to the first
+// handle of the chain, which either serves the request or passes it on to the
+// next handle by calling Next, e.g. if a feature flag is not enabled for the
+// request. Requests passed on by the last handle are answered by the router's
+// NotFound handler.
+func (r *Router) HandleChain(method, path string, handles ...http.Handler) *Route {
+	if len(handles) == 0 {
+		panic(registrationError(KindNilHandler, path,
+			"handle must not be nil in path '"+path+"'"))
+	}
+	for _, handle := range handles {
+		if handle == nil {
+			panic(registrationError(KindNilHandler, path,
+				"handle must not be nil in path '"+path+"'"))
+		}
+	}
+
+	return r.Handle(method, path, &chainHandler{
+		router:  r,
+		handles: append([]http.Handler(nil), handles...),
+	})
+}
+
+// Next passes a request to the next handle of the chain registered with
+// HandleChain, which the calling handle is part of. It must be called from
+// the handle's ServeHTTP method, with its http.ResponseWriter and request, or
+// a request derived from it, and only if the handle has not written anything
+// to the response yet. The handle must not use the http.ResponseWriter after
+// Next returns.
+//
+// Requests of handles which are not part of a chain are answered with
+// http.NotFound.
+func Next(w http.ResponseWriter, req *http.Request) {
+	link, ok := req.Context().Value(chainKey).(*chainLink)
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	link.chain.serve(w, req, link.index+1)
+}
+
+// chainKey is the context key for the *chainLink of a request served by a
+// chain handle.
+var chainKey = &ContextKey{"chain"}
+
+// chainLink is the position of a request in a chain.
+type chainLink struct {
+	chain *chainHandler
+	index int
+}
+
+// chainHandler implements HandleChain.
+type chainHandler struct {
+	router  *Router
+	handles []http.Handler
+}
+
+func (h *chainHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.serve(w, req, 0)
+}
+
+// serve passes req to the handle at index i, or to the router's NotFound
+// handler if the chain is exhausted.
+func (h *chainHandler) serve(w http.ResponseWriter, req *http.Request, i int) {
+	if i >= len(h.handles) {
+		h.router.serveNotFound(w, req)
+		return
+	}
+
+	ctx := context.WithValue(req.Context(), chainKey, &chainLink{h, i})
+	h.handles[i].ServeHTTP(w, req.WithContext(ctx))
+}
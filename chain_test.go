@@ -0,0 +1,83 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterHandleChain(t *testing.T) {
+	var served []string
+	flagged := func(name, flag string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served = append(served, name)
+			if r.Header.Get("X-Flag") != flag {
+				Next(w, r)
+				return
+			}
+			w.Write([]byte(name + " " + GetValue(r.Context(), "id")))
+		})
+	}
+
+	router := New()
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = append(served, "notfound")
+		w.WriteHeader(http.StatusNotFound)
+	})
+	router.HandleChain(http.MethodGet, "/items/:id",
+		flagged("beta", "beta"),
+		flagged("canary", "canary"),
+	)
+
+	for _, test := range []struct {
+		flag, body string
+		code       int
+		served     []string
+	}{
+		{"beta", "beta 42", http.StatusOK, []string{"beta"}},
+		{"canary", "canary 42", http.StatusOK, []string{"beta", "canary"}},
+		{"", "", http.StatusNotFound, []string{"beta", "canary", "notfound"}},
+	} {
+		served = nil
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, "/items/42", nil)
+		r.Header.Set("X-Flag", test.flag)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Body.String() != test.body || len(served) != len(test.served) {
+			t.Errorf("flag %q: got %d %q served by %v, want %d %q by %v",
+				test.flag, w.Code, w.Body.String(), served, test.code, test.body, test.served)
+			continue
+		}
+		for i := range served {
+			if served[i] != test.served[i] {
+				t.Errorf("flag %q: served by %v, want %v", test.flag, served, test.served)
+				break
+			}
+		}
+	}
+
+	// outside of a chain, Next answers with http.NotFound
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	Next(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Next outside of a chain: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	recv := catchPanic(func() {
+		router.HandleChain(http.MethodGet, "/empty")
+	})
+	if rerr, ok := recv.(*RegistrationError); !ok || rerr.Kind != KindNilHandler {
+		t.Errorf("HandleChain without handles: got panic %v", recv)
+	}
+	recv = catchPanic(func() {
+		router.HandleChain(http.MethodGet, "/nil", flagged("a", "a"), nil)
+	})
+	if rerr, ok := recv.(*RegistrationError); !ok || rerr.Kind != KindNilHandler {
+		t.Errorf("HandleChain with nil handle: got panic %v", recv)
+	}
+}
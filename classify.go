@@ -0,0 +1,114 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+// OutcomeKind describes how a request is routed.
+type OutcomeKind uint8
+
+const (
+	// OutcomeNotFound is used for requests answered by the NotFound handler.
+	OutcomeNotFound OutcomeKind = iota
+
+	// OutcomeMatched is used for requests matching a route.
+	OutcomeMatched
+
+	// OutcomeRedirect is used for requests redirected because of
+	// RedirectTrailingSlash or RedirectFixedPath.
+	OutcomeRedirect
+
+	// OutcomeMethodNotAllowed is used for requests answered with 405 Method
+	// Not Allowed because of HandleMethodNotAllowed.
+	OutcomeMethodNotAllowed
+
+	// OutcomeOptions is used for OPTIONS requests answered automatically
+	// because of HandleOptions.
+	OutcomeOptions
+
+	// OutcomeSlashMismatch is used for requests passed to the
+	// SlashMismatchHandler.
+	OutcomeSlashMismatch
+
+	// OutcomeBadRequest is used for requests rejected because of
+	// RejectControlChars.
+	OutcomeBadRequest
+)
+
+var outcomeKindNames = [...]string{
+	OutcomeNotFound:         "not found",
+	OutcomeMatched:          "matched",
+	OutcomeRedirect:         "redirect",
+	OutcomeMethodNotAllowed: "method not allowed",
+	OutcomeOptions:          "options",
+	OutcomeSlashMismatch:    "slash mismatch",
+	OutcomeBadRequest:       "bad request",
+}
+
+func (k OutcomeKind) String() string {
+	if int(k) < len(outcomeKindNames) {
+		return outcomeKindNames[k]
+	}
+	return "unknown"
+}
+
+// Outcome describes how a request is routed, as returned by Classify.
+type Outcome struct {
+	Kind OutcomeKind
+
+	// Method, Pattern and Params are set for OutcomeMatched. Method is the
+	// method of the matched route, which differs from the request method for
+	// routes of the router's MethodFallback. Pattern is the registered path
+	// of the route and Params are the matched params, before they are passed
+	// to TransformParams.
+	Method  string
+	Pattern string
+	Params  Params
+
+	// Location is the redirect target for OutcomeRedirect, and the path with
+	// the trailing slash toggled for OutcomeSlashMismatch. Code is the status
+	// code of the redirect.
+	Location string
+	Code     int
+
+	// Allow is the sorted list of methods listed in the "Allow" header for
+	// OutcomeMethodNotAllowed and OutcomeOptions.
+	Allow []string
+}
+
+// Classify returns how a request with the given method and path would be
+// routed, without serving it. RedirectInterceptors are called with a request
+// without headers. Routers added with Scheme and Host are not consulted, and
+// requests matching a route are reported as OutcomeMatched even if the route
+// is disabled.
+func (r *Router) Classify(method, path string) Outcome {
+	req := classifyRequest(method, path)
+
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	_, o := r.route(req, nil)
+	sort.Strings(o.Allow)
+	return o
+}
+
+// classifyRequest returns a request without headers for the given method and
+// path, as routed by Classify.
+func classifyRequest(method, path string) *http.Request {
+	return &http.Request{
+		Method:     method,
+		URL:        &url.URL{Path: path},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		RequestURI: path,
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRouterClassify(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	router := New()
+	router.RejectControlChars = true
+	router.MethodFallback = map[string]string{http.MethodHead: http.MethodGet}
+	router.Get("/users/:id", handlerFunc)
+	router.Put("/users/:id", handlerFunc)
+	router.Get("/path", handlerFunc)
+	router.Post("/path", handlerFunc)
+
+	for _, test := range []struct {
+		method, path string
+		want         Outcome
+	}{
+		{http.MethodGet, "/users/42", Outcome{
+			Kind:    OutcomeMatched,
+			Method:  http.MethodGet,
+			Pattern: "/users/:id",
+			Params:  Params{Param{"id", "42"}},
+		}},
+		{http.MethodHead, "/users/42", Outcome{
+			Kind:    OutcomeMatched,
+			Method:  http.MethodGet,
+			Pattern: "/users/:id",
+			Params:  Params{Param{"id", "42"}},
+		}},
+		{http.MethodGet, "/path/", Outcome{
+			Kind:     OutcomeRedirect,
+			Location: "/path",
+			Code:     http.StatusMovedPermanently,
+		}},
+		{http.MethodPost, "/PATH", Outcome{
+			Kind:     OutcomeRedirect,
+			Location: "/path",
+			Code:     http.StatusTemporaryRedirect,
+		}},
+		{http.MethodDelete, "/users/42", Outcome{
+			Kind:  OutcomeMethodNotAllowed,
+			Allow: []string{http.MethodGet, http.MethodOptions, http.MethodPut},
+		}},
+		{http.MethodOptions, "/path", Outcome{
+			Kind:  OutcomeOptions,
+			Allow: []string{http.MethodGet, http.MethodOptions, http.MethodPost},
+		}},
+		{http.MethodGet, "/nope", Outcome{Kind: OutcomeNotFound}},
+		{http.MethodGet, "/path\x00", Outcome{Kind: OutcomeBadRequest}},
+	} {
+		if got := router.Classify(test.method, test.path); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Classify(%s, %q) = %+v, want %+v", test.method, test.path, got, test.want)
+		}
+	}
+
+	router.RedirectTrailingSlash = false
+	router.SlashMismatchHandler = handlerFunc
+	want := Outcome{Kind: OutcomeSlashMismatch, Location: "/path"}
+	if got := router.Classify(http.MethodGet, "/path/"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Classify(GET, /path/) = %+v, want %+v", got, want)
+	}
+
+	if s := OutcomeKind(255).String(); s != "unknown" {
+		t.Errorf("unexpected name %q for invalid kind", s)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// ContextKey is a value for use with context.WithValue. It's used as
+// a pointer so it fits in an interface{} without allocation.
+//
+// Packages that cannot call GetParams or GetPanic may look up the values the
+// router stores in a request context with the exported keys instead.
+type ContextKey struct{ name string }
+
+func (k *ContextKey) String() string { return "httprouter context value " + k.name }
+
+var (
+	// ParamsKey is the context key for the params of a matched route. The
+	// associated value has type *Params and is only present if the route
+	// has any params.
+	ParamsKey = &ContextKey{"param"}
+
+	// PanicKey is the context key for the value recovered from a panic,
+	// it is only present in requests passed to the PanicHandler.
+	PanicKey = &ContextKey{"panic"}
+
+	// PanicStackKey is the context key for the stack trace of the goroutine
+	// at the time a panic was recovered, it is only present in requests
+	// passed to the PanicHandler and PanicResponse. The associated value has
+	// type []byte.
+	PanicStackKey = &ContextKey{"panic stack"}
+
+	// EffectiveMethodKey is the context key for the method of the route that
+	// was used because of the router's MethodFallback. The associated value
+	// has type string.
+	EffectiveMethodKey = &ContextKey{"effective method"}
+
+	// CanonicalPathKey is the context key for the path with an extra (without
+	// the) trailing slash, it is only present in requests passed to the
+	// SlashMismatchHandler. The associated value has type string.
+	CanonicalPathKey = &ContextKey{"canonical path"}
+
+	// MatchedPatternKey is the context key for the registered path of the
+	// matched route, e.g. "/users/:id". The associated value has type string.
+	MatchedPatternKey = &ContextKey{"matched pattern"}
+
+	// AllowKey is the context key for the methods allowed for the request
+	// path, it is only present in requests passed to custom OPTIONS handlers
+	// if HandleOptions is enabled. The associated value has type []string.
+	AllowKey = &ContextKey{"allow"}
+
+	// RedirectKey is the context key for the redirect of a request, it is
+	// only present in requests passed to the RedirectHandler. The associated
+	// value has type *RedirectInfo.
+	RedirectKey = &ContextKey{"redirect"}
+)
+
+// GetParams returns the Param-slice associated with a context.Context
+// if there is one, otherwise it returns nil.
+func GetParams(ctx context.Context) Params {
+	// Handlers usually receive the context created by the router, which
+	// can be read without looking up ParamsKey.
+	if c, ok := ctx.(*paramsContext); ok && c.ps != nil {
+		return c.ps
+	}
+	if ps := ctx.Value(ParamsKey); ps != nil {
+		return *ps.(*Params)
+	}
+	return nil
+}
+
+// GetValue is short-hand for GetParams(ctx).ByName(name).
+func GetValue(ctx context.Context, name string) string {
+	// Handlers usually receive the context created by the router, which
+	// can be read without looking up ParamsKey.
+	if c, ok := ctx.(*paramsContext); ok && c.ps != nil {
+		return c.ps.ByName(name)
+	}
+	return GetParams(ctx).ByName(name)
+}
+
+// GetMatchedPattern returns the registered path of the route matching the
+// request associated with a context.Context, e.g. "/users/:id" for a request
+// for /users/42. Unlike the request path, it is suitable as a metrics label.
+// It returns an empty string if no route matched, e.g. in the NotFound and
+// MethodNotAllowed handlers, and for routes without params if the router's
+// SkipStaticPattern is enabled.
+func GetMatchedPattern(ctx context.Context) string {
+	if c, ok := ctx.(*paramsContext); ok && c.pattern != "" {
+		return c.pattern
+	}
+	pattern, _ := ctx.Value(MatchedPatternKey).(string)
+	return pattern
+}
+
+// ParamsFromRequest is short-hand for GetParams(r.Context()).
+func ParamsFromRequest(r *http.Request) Params {
+	return GetParams(r.Context())
+}
+
+// ValueFromRequest is short-hand for GetValue(r.Context(), name).
+func ValueFromRequest(r *http.Request, name string) string {
+	return GetValue(r.Context(), name)
+}
+
+// SetValue returns a copy of ctx with the param of the given name set to value.
+// An existing param of the same name is replaced, otherwise the param is
+// added. The params of ctx are not modified.
+func SetValue(ctx context.Context, name, value string) context.Context {
+	old := GetParams(ctx)
+
+	ps := make(Params, len(old), len(old)+1)
+	copy(ps, old)
+
+	for i := range ps {
+		if ps[i].Key == name {
+			ps[i].Value = value
+			return &paramsContext{Context: ctx, ps: ps}
+		}
+	}
+
+	return &paramsContext{Context: ctx, ps: append(ps, Param{name, value})}
+}
+
+type paramsContext struct {
+	context.Context
+	ps      Params
+	pattern string
+}
+
+func (c *paramsContext) String() string {
+	return fmt.Sprintf("%v.WithValue(%#v, %#v)", c.Context, ParamsKey, &c.ps)
+}
+
+func (c *paramsContext) Value(key interface{}) interface{} {
+	if key == ParamsKey && c.ps != nil {
+		return &c.ps
+	}
+	if key == MatchedPatternKey && c.pattern != "" {
+		return c.pattern
+	}
+	return c.Context.Value(key)
+}
+
+// GetEffectiveMethod returns the method of the route that handled the request
+// associated with a context.Context, if it was routed with the router's
+// MethodFallback. Otherwise it returns an empty string.
+func GetEffectiveMethod(ctx context.Context) string {
+	method, _ := ctx.Value(EffectiveMethodKey).(string)
+	return method
+}
+
+// GetCanonicalPath returns the path of the handle which would have matched the
+// request associated with a context.Context with an extra (without the)
+// trailing slash, if it was passed to the router's SlashMismatchHandler.
+// Otherwise it returns an empty string.
+func GetCanonicalPath(ctx context.Context) string {
+	path, _ := ctx.Value(CanonicalPathKey).(string)
+	return path
+}
+
+// GetAllow returns the sorted methods allowed for the request path, as listed
+// in the "Allow" header, if the request associated with a context.Context is
+// handled by a custom OPTIONS handler and the router's HandleOptions is
+// enabled. Otherwise it returns nil.
+func GetAllow(ctx context.Context) []string {
+	allow, _ := ctx.Value(AllowKey).([]string)
+	return allow
+}
+
+// RedirectInfo describes a redirect of the router because of
+// RedirectTrailingSlash or RedirectFixedPath.
+type RedirectInfo struct {
+	// Path is the request path which was corrected.
+	Path string
+
+	// Target is the URL the request would be redirected to by
+	// http.Redirect, including the query of the request.
+	Target string
+
+	// Code is the status code of the redirect.
+	Code int
+}
+
+// GetRedirect returns the redirect of the request associated with a
+// context.Context, if it was passed to the router's RedirectHandler.
+// Otherwise it returns nil.
+func GetRedirect(ctx context.Context) *RedirectInfo {
+	info, _ := ctx.Value(RedirectKey).(*RedirectInfo)
+	return info
+}
+
+// GetPanic returns the recovered panic value associated with a
+// context.Context.
+func GetPanic(ctx context.Context) interface{} {
+	return ctx.Value(PanicKey)
+}
+
+// GetPanicStack returns the stack trace, as formatted by debug.Stack, of the
+// goroutine which panicked while serving the request associated with a
+// context.Context, if it was passed to the router's PanicHandler or
+// PanicResponse. Otherwise it returns nil.
+func GetPanicStack(ctx context.Context) []byte {
+	stack, _ := ctx.Value(PanicStackKey).([]byte)
+	return stack
+}
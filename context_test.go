@@ -0,0 +1,248 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestContextKeys(t *testing.T) {
+	router := New()
+
+	var ps interface{}
+	router.Get("/user/:name", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ps = r.Context().Value(ParamsKey)
+	}))
+
+	w := new(mockResponseWriter)
+	req, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(w, req)
+
+	want := Params{Param{"name", "gopher"}}
+	if p, ok := ps.(*Params); !ok || !reflect.DeepEqual(*p, want) {
+		t.Fatalf("wrong context value for ParamsKey: want %v, got %v", &want, ps)
+	}
+
+	ctx := context.WithValue(context.Background(), PanicKey, "oops!")
+	if rcv := GetPanic(ctx); rcv != "oops!" {
+		t.Errorf("wrong value for GetPanic: want %v, got %v", "oops!", rcv)
+	}
+	if stack := GetPanicStack(ctx); stack != nil {
+		t.Errorf("expected nil stack for context without stack, got %s", stack)
+	}
+
+	if ps := GetParams(context.Background()); ps != nil {
+		t.Errorf("expected nil params for empty context, got %v", ps)
+	}
+}
+
+func TestGetValue(t *testing.T) {
+	ps := Params{Param{"name", "gopher"}, Param{"id", "42"}}
+	ctx := &paramsContext{Context: context.Background(), ps: ps}
+
+	if v := GetValue(ctx, "id"); v != "42" {
+		t.Errorf("wrong value for GetValue: want %q, got %q", "42", v)
+	}
+
+	// contexts derived from the router's context use the ParamsKey lookup
+	derived := context.WithValue(ctx, PanicKey, "oops!")
+	if v := GetValue(derived, "name"); v != "gopher" {
+		t.Errorf("wrong value for GetValue on derived context: want %q, got %q", "gopher", v)
+	}
+
+	if v := GetValue(context.Background(), "name"); v != "" {
+		t.Errorf("expected empty value for empty context, got %q", v)
+	}
+}
+
+func TestGetValueAndParams(t *testing.T) {
+	want := Params{Param{"user", "gopher"}, Param{"repo", "httprouter"}}
+
+	var contexts []context.Context
+	router := New()
+	router.Get("/:user/:repo", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		contexts = append(contexts, r.Context())
+	}))
+	req, _ := http.NewRequest(http.MethodGet, "/gopher/httprouter", nil)
+	router.ServeHTTP(new(mockResponseWriter), req)
+
+	// the params may also be stored by packages which only know ParamsKey
+	ps := append(Params(nil), want...)
+	contexts = append(contexts, context.WithValue(context.Background(), ParamsKey, &ps))
+
+	for i, ctx := range contexts {
+		if got := GetParams(ctx); !reflect.DeepEqual(got, want) {
+			t.Errorf("context %d: wrong params: want %v, got %v", i, want, got)
+		}
+		for _, p := range want {
+			if v := GetValue(ctx, p.Key); v != p.Value {
+				t.Errorf("context %d: wrong value for %q: want %q, got %q", i, p.Key, p.Value, v)
+			}
+		}
+	}
+}
+
+func TestGetMatchedPattern(t *testing.T) {
+	var pattern string
+	record := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		pattern = GetMatchedPattern(r.Context())
+	})
+
+	router := New()
+	router.Get("/users/:id", record)
+	router.Get("/about", record)
+	router.NotFound = record
+	router.MethodNotAllowed = record
+
+	for _, test := range []struct {
+		skip               bool
+		method, path, want string
+	}{
+		{false, http.MethodGet, "/users/42", "/users/:id"},
+		{false, http.MethodGet, "/about", "/about"},
+		{false, http.MethodGet, "/nope", ""},
+		{false, http.MethodPost, "/users/42", ""},
+		{true, http.MethodGet, "/users/42", "/users/:id"},
+		{true, http.MethodGet, "/about", ""},
+	} {
+		pattern = "unset"
+		router.SkipStaticPattern = test.skip
+		req, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(new(mockResponseWriter), req)
+		if pattern != test.want {
+			t.Errorf("%s %s (SkipStaticPattern=%t): got pattern %q, want %q",
+				test.method, test.path, test.skip, pattern, test.want)
+		}
+	}
+
+	// the pattern survives SetValue and derived contexts
+	ctx := &paramsContext{Context: context.Background(), pattern: "/users/:id"}
+	derived := context.WithValue(SetValue(ctx, "id", "7"), PanicKey, "oops!")
+	if p := GetMatchedPattern(derived); p != "/users/:id" {
+		t.Errorf("wrong pattern for derived context: want %q, got %q", "/users/:id", p)
+	}
+	if ps := GetParams(ctx); ps != nil {
+		t.Errorf("expected nil params for a route without params, got %v", ps)
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	ps := Params{Param{"name", "gopher"}}
+	req, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+
+	if ps := ParamsFromRequest(req); ps != nil {
+		t.Errorf("expected nil params for request without params, got %v", ps)
+	}
+	if v := ValueFromRequest(req, "name"); v != "" {
+		t.Errorf("expected empty value for request without params, got %q", v)
+	}
+
+	req = req.WithContext(&paramsContext{Context: req.Context(), ps: ps})
+	if got := ParamsFromRequest(req); !reflect.DeepEqual(got, ps) {
+		t.Errorf("wrong value for ParamsFromRequest: want %v, got %v", ps, got)
+	}
+	if v := ValueFromRequest(req, "name"); v != "gopher" {
+		t.Errorf("wrong value for ValueFromRequest: want %q, got %q", "gopher", v)
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	ps := Params{Param{"name", "gopher"}, Param{"id", "42"}}
+	ctx := &paramsContext{Context: context.Background(), ps: ps}
+
+	replaced := SetValue(ctx, "id", "43")
+	if got, want := GetParams(replaced), (Params{Param{"name", "gopher"}, Param{"id", "43"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong params after replacing: want %v, got %v", want, got)
+	}
+
+	added := SetValue(replaced, "format", "json")
+	if got, want := GetValue(added, "format"), "json"; got != want {
+		t.Errorf("wrong value for added param: want %q, got %q", want, got)
+	}
+	if got, want := GetValue(added, "id"), "43"; got != want {
+		t.Errorf("wrong value for existing param: want %q, got %q", want, got)
+	}
+
+	// the params of the original context are unchanged
+	if got := GetValue(ctx, "id"); got != "42" {
+		t.Errorf("original params modified: got id %q", got)
+	}
+
+	empty := SetValue(context.Background(), "name", "gopher")
+	if got, want := GetParams(empty), (Params{Param{"name", "gopher"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong params for empty context: want %v, got %v", want, got)
+	}
+}
+
+func TestGetValueMallocs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping malloc count in short mode")
+	}
+	if runtime.GOMAXPROCS(0) > 1 {
+		t.Log("skipping AllocsPerRun checks; GOMAXPROCS>1")
+		return
+	}
+
+	ctx := &paramsContext{Context: context.Background(), ps: Params{Param{"id", "42"}}}
+	derived := context.WithValue(ctx, PanicKey, "oops!")
+	for _, ctx := range []context.Context{ctx, derived} {
+		allocs := testing.AllocsPerRun(100, func() { GetValue(ctx, "id") })
+		if allocs > 0 {
+			t.Errorf("GetValue(%v): %v allocs, want zero", ctx, allocs)
+		}
+	}
+}
+
+func BenchmarkGetValue(b *testing.B) {
+	ctx := &paramsContext{Context: context.Background(), ps: Params{Param{"id", "42"}}}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		GetValue(ctx, "id")
+	}
+}
+
+func BenchmarkGetParams(b *testing.B) {
+	for _, test := range []struct {
+		name string
+		mw   func(http.Handler) http.Handler
+	}{
+		// the handle receives the context created by the router
+		{"Router", func(h http.Handler) http.Handler { return h }},
+		// the params have to be looked up through the context chain
+		{"Wrapped", func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), PanicKey, nil)))
+			})
+		}},
+	} {
+		b.Run(test.name, func(b *testing.B) {
+			var ps Params
+			router := New()
+			router.Get("/repos/:owner/:repo/issues/:number", test.mw(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				ps = GetParams(r.Context())
+			})))
+
+			w := new(mockResponseWriter)
+			r, _ := http.NewRequest(http.MethodGet, "/repos/julienschmidt/httprouter/issues/42", nil)
+
+			router.ServeHTTP(w, r)
+			if len(ps) != 3 {
+				b.Fatalf("expected 3 params, got %v", ps)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				router.ServeHTTP(w, r)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig configures the answers to CORS preflight requests, see the
+// router's CORS option.
+type CORSConfig struct {
+	// Origins which are allowed to make cross-origin requests, e.g.
+	// "https://example.com". The origin "*" allows all origins.
+	AllowedOrigins []string
+
+	// Headers, besides the CORS-safelisted ones, which are allowed in
+	// cross-origin requests. The header "*" allows all headers requested
+	// by the client.
+	AllowedHeaders []string
+
+	// If enabled, cross-origin requests may include credentials, e.g.
+	// cookies. The allowed origin is then always sent explicitly, even if
+	// all origins are allowed.
+	AllowCredentials bool
+
+	// How long the answer to a preflight request may be cached by the
+	// client. It is not sent if it is zero.
+	MaxAge time.Duration
+}
+
+// allowOrigin returns the value of the Access-Control-Allow-Origin header for
+// requests from origin, or an empty string if the origin is not allowed.
+func (c *CORSConfig) allowOrigin(origin string) string {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" {
+			if c.AllowCredentials {
+				return origin
+			}
+			return "*"
+		}
+		if strings.EqualFold(o, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// allowHeaders returns the value of the Access-Control-Allow-Headers header
+// for a preflight request for the requested headers.
+func (c *CORSConfig) allowHeaders(requested string) string {
+	for _, h := range c.AllowedHeaders {
+		if h == "*" {
+			return requested
+		}
+	}
+	return strings.Join(c.AllowedHeaders, ", ")
+}
+
+// isPreflight reports whether req is a CORS preflight request.
+func isPreflight(req *http.Request) bool {
+	return req.Method == http.MethodOptions &&
+		req.Header.Get("Origin") != "" &&
+		req.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// servePreflight answers the CORS preflight request req if any method is
+// allowed for its path and reports whether it did.
+func (r *Router) servePreflight(w http.ResponseWriter, req *http.Request) bool {
+	locked := r.rlock()
+	allow := r.allowedMethods(r.requestPath(req), req.Method)
+	if locked {
+		r.mu.RUnlock()
+	}
+	if len(allow) == 0 {
+		return false
+	}
+	sort.Strings(allow)
+
+	h := w.Header()
+	h.Set("Allow", strings.Join(allow, ", "))
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	method := req.Header.Get("Access-Control-Request-Method")
+	origin := r.CORS.allowOrigin(req.Header.Get("Origin"))
+	if origin != "" && contains(allow, method) {
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Allow-Methods", strings.Join(allow, ", "))
+		if headers := r.CORS.allowHeaders(req.Header.Get("Access-Control-Request-Headers")); headers != "" {
+			h.Set("Access-Control-Allow-Headers", headers)
+		}
+		if r.CORS.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if r.CORS.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.FormatInt(int64(r.CORS.MaxAge/time.Second), 10))
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
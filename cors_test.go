@@ -0,0 +1,109 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouterCORS(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	var custom bool
+	router := New()
+	router.CORS = &CORSConfig{
+		AllowedOrigins: []string{"https://example.com"},
+		AllowedHeaders: []string{"Content-Type", "X-Token"},
+		MaxAge:         10 * time.Minute,
+	}
+	router.Get("/users/:id", handlerFunc)
+	router.Put("/users/:id", handlerFunc)
+	router.Options("/users/:id", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		custom = true
+	}))
+
+	preflight := func(path, origin, method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodOptions, path, nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if method != "" {
+			r.Header.Set("Access-Control-Request-Method", method)
+		}
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := preflight("/users/42", "https://example.com", http.MethodPut)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("preflight: got code %d, want %d", w.Code, http.StatusNoContent)
+	}
+	for name, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://example.com",
+		"Access-Control-Allow-Methods":     "GET, OPTIONS, PUT",
+		"Access-Control-Allow-Headers":     "Content-Type, X-Token",
+		"Access-Control-Max-Age":           "600",
+		"Access-Control-Allow-Credentials": "",
+	} {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("preflight: got %s %q, want %q", name, got, want)
+		}
+	}
+	if custom {
+		t.Error("custom OPTIONS handler called for preflight request")
+	}
+
+	// disallowed origins and methods get no CORS headers
+	for _, test := range []struct{ origin, method string }{
+		{"https://evil.example", http.MethodPut},
+		{"https://example.com", http.MethodDelete},
+	} {
+		w = preflight("/users/42", test.origin, test.method)
+		if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("preflight from %s for %s: got code %d, header %v",
+				test.origin, test.method, w.Code, w.Header())
+		}
+	}
+
+	// non-preflight OPTIONS requests are unchanged
+	w = preflight("/users/42", "https://example.com", "")
+	if !custom || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("OPTIONS request without Access-Control-Request-Method: custom=%v header=%v",
+			custom, w.Header())
+	}
+
+	// unknown paths are not found
+	w = preflight("/nope", "https://example.com", http.MethodGet)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("preflight for unknown path: got code %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// wildcards
+	router.CORS = &CORSConfig{
+		AllowedOrigins:   []string{"*"},
+		AllowedHeaders:   []string{"*"},
+		AllowCredentials: true,
+	}
+	w = httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodOptions, "/users/42", nil)
+	r.Header.Set("Origin", "https://other.example")
+	r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	r.Header.Set("Access-Control-Request-Headers", "x-custom")
+	router.ServeHTTP(w, r)
+	for name, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://other.example",
+		"Access-Control-Allow-Headers":     "x-custom",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Max-Age":           "",
+	} {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("wildcard preflight: got %s %q, want %q", name, got, want)
+		}
+	}
+}
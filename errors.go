@@ -0,0 +1,144 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import "net/http"
+
+// ErrorKind describes why registering a route failed.
+type ErrorKind uint8
+
+const (
+	// KindBadPath is used for malformed paths, e.g. paths not beginning
+	// with '/' or with unnamed wildcards.
+	KindBadPath ErrorKind = iota + 1
+
+	// KindConflict is used for routes conflicting with registered routes.
+	KindConflict
+
+	// KindBadFilepath is used for ServeFiles paths not ending with
+	// "/*filepath".
+	KindBadFilepath
+
+	// KindNilHandler is used for nil handles.
+	KindNilHandler
+
+	// KindDuplicateParam is used for paths using a param name twice.
+	KindDuplicateParam
+
+	// KindInvalidOption is used for invalid route options, e.g. a negative
+	// body limit or an invalid content type.
+	KindInvalidOption
+
+	// KindTooManyRoutes is used for routes exceeding the router's
+	// MaxRoutesPerMethod.
+	KindTooManyRoutes
+
+	// KindSealed is used for routes registered after the router was sealed
+	// with Seal.
+	KindSealed
+
+	// KindNotFound is used for operations on routes which are not
+	// registered, e.g. Disable.
+	KindNotFound
+)
+
+var errorKindNames = [...]string{
+	KindBadPath:        "bad path",
+	KindConflict:       "conflict",
+	KindBadFilepath:    "bad filepath",
+	KindNilHandler:     "nil handler",
+	KindDuplicateParam: "duplicate param",
+	KindInvalidOption:  "invalid option",
+	KindTooManyRoutes:  "too many routes",
+	KindSealed:         "sealed router",
+	KindNotFound:       "not found",
+}
+
+func (k ErrorKind) String() string {
+	if int(k) < len(errorKindNames) && errorKindNames[k] != "" {
+		return errorKindNames[k]
+	}
+	return "unknown"
+}
+
+// RegistrationError is the panic value used by Handle, ServeFiles and the
+// other registration methods if a route cannot be registered. It is returned
+// by the Try variants instead.
+type RegistrationError struct {
+	Kind ErrorKind
+
+	// Method is the method of the route, it is empty if the route was
+	// rejected before it was assigned to a method.
+	Method string
+
+	// Path is the path of the route.
+	Path string
+
+	// Message describes the error.
+	Message string
+}
+
+func (e *RegistrationError) Error() string {
+	return e.Message
+}
+
+func registrationError(kind ErrorKind, path, message string) *RegistrationError {
+	return &RegistrationError{Kind: kind, Path: path, Message: message}
+}
+
+// recoverRegistrationError must be deferred directly. It stores a recovered
+// *RegistrationError in err, other panics continue.
+func recoverRegistrationError(err *error) {
+	if rcv := recover(); rcv != nil {
+		regErr, ok := rcv.(*RegistrationError)
+		if !ok {
+			panic(rcv)
+		}
+		*err = regErr
+	}
+}
+
+// setRegistrationMethod must be deferred directly. It sets the method of a
+// recovered *RegistrationError without one and continues panicking.
+func setRegistrationMethod(method string) {
+	if rcv := recover(); rcv != nil {
+		if err, ok := rcv.(*RegistrationError); ok && err.Method == "" {
+			err.Method = method
+		}
+		panic(rcv)
+	}
+}
+
+// TryHandle is like Handle but returns a *RegistrationError instead of
+// panicking if the route cannot be registered.
+func (r *Router) TryHandle(method, path string, handle http.Handler) (err error) {
+	defer recoverRegistrationError(&err)
+	r.Handle(method, path, handle)
+	return nil
+}
+
+// TryServeFiles is like ServeFiles but returns a *RegistrationError instead of
+// panicking if the route cannot be registered.
+func (r *Router) TryServeFiles(path string, root http.FileSystem) (err error) {
+	defer recoverRegistrationError(&err)
+	r.ServeFiles(path, root)
+	return nil
+}
+
+// TryBuild is like Build but returns a *RegistrationError instead of panicking
+// if any of the routes cannot be registered.
+func (r *Router) TryBuild() (err error) {
+	defer recoverRegistrationError(&err)
+	r.Build()
+	return nil
+}
+
+// TryCompile is like Compile but returns a *RegistrationError instead of
+// panicking if any of the routes cannot be registered.
+func (r *Router) TryCompile() (err error) {
+	defer recoverRegistrationError(&err)
+	r.Compile()
+	return nil
+}
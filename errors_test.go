@@ -0,0 +1,108 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRegistrationError(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Get("/user/:name", handlerFunc)
+
+	for _, test := range []struct {
+		method, path string
+		handle       http.Handler
+		kind         ErrorKind
+	}{
+		{http.MethodGet, "noSlash", handlerFunc, KindBadPath},
+		{http.MethodGet, "", handlerFunc, KindBadPath},
+		{http.MethodGet, "/user/:id", handlerFunc, KindConflict},
+		{http.MethodGet, "/user/:name", handlerFunc, KindConflict},
+		{http.MethodPost, "/nil", nil, KindNilHandler},
+		{http.MethodPost, "/:id/:id", handlerFunc, KindDuplicateParam},
+		{http.MethodPost, "/:", handlerFunc, KindBadPath},
+	} {
+		err := router.TryHandle(test.method, test.path, test.handle)
+		regErr, ok := err.(*RegistrationError)
+		if !ok {
+			t.Errorf("TryHandle(%s, %q) returned %v, want a *RegistrationError", test.method, test.path, err)
+			continue
+		}
+		if regErr.Kind != test.kind || regErr.Method != test.method || regErr.Path != test.path {
+			t.Errorf("TryHandle(%s, %q) returned %s error for %s %q, want %s",
+				test.method, test.path, regErr.Kind, regErr.Method, regErr.Path, test.kind)
+		}
+		if regErr.Error() == "" {
+			t.Errorf("TryHandle(%s, %q) returned error without message", test.method, test.path)
+		}
+	}
+
+	if err := router.TryHandle(http.MethodGet, "/ok", handlerFunc); err != nil {
+		t.Errorf("TryHandle returned unexpected error: %v", err)
+	}
+
+	err := router.TryServeFiles("/noFilepath", http.Dir("."))
+	if regErr, ok := err.(*RegistrationError); !ok || regErr.Kind != KindBadFilepath {
+		t.Errorf("TryServeFiles returned %v, want a bad filepath error", err)
+	}
+
+	// the panic value is the same error
+	recv := catchPanic(func() { router.Get("/user/:id", handlerFunc) })
+	if regErr, ok := recv.(*RegistrationError); !ok || regErr.Kind != KindConflict {
+		t.Errorf("Get panicked with %v, want a conflict error", recv)
+	}
+
+	// conflicts of deferred routes are reported by TryCompile
+	router = New()
+	router.DeferRegistration = true
+	router.Get("/user/:name", handlerFunc)
+	router.Get("/user/:id", handlerFunc)
+	err = router.TryCompile()
+	if regErr, ok := err.(*RegistrationError); !ok || regErr.Kind != KindConflict || regErr.Method != http.MethodGet {
+		t.Errorf("TryCompile returned %v, want a conflict error", err)
+	}
+
+	if s := ErrorKind(0).String(); s != "unknown" {
+		t.Errorf("unexpected name %q for invalid kind", s)
+	}
+}
+
+func TestRouterMaxRoutesPerMethod(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	router := New()
+	router.MaxRoutesPerMethod = 2
+	for _, path := range [...]string{"/a", "/b"} {
+		if err := router.TryHandle(http.MethodGet, path, handlerFunc); err != nil {
+			t.Fatalf("registering %s failed: %v", path, err)
+		}
+	}
+	if err := router.TryHandle(http.MethodPost, "/c", handlerFunc); err != nil {
+		t.Errorf("registering a route for another method failed: %v", err)
+	}
+
+	err := router.TryHandle(http.MethodGet, "/c", handlerFunc)
+	if regErr, ok := err.(*RegistrationError); !ok || regErr.Kind != KindTooManyRoutes || regErr.Method != http.MethodGet {
+		t.Errorf("TryHandle returned %v, want a too many routes error", err)
+	}
+
+	router.Remove(http.MethodGet, "/a")
+	if err := router.TryHandle(http.MethodGet, "/c", handlerFunc); err != nil {
+		t.Errorf("registering a route after removing one failed: %v", err)
+	}
+
+	router = New()
+	router.MaxRoutesPerMethod = 1
+	router.DeferRegistration = true
+	router.Get("/a", handlerFunc)
+	err = router.TryHandle(http.MethodGet, "/b", handlerFunc)
+	if regErr, ok := err.(*RegistrationError); !ok || regErr.Kind != KindTooManyRoutes {
+		t.Errorf("TryHandle with a deferred route returned %v, want a too many routes error", err)
+	}
+}
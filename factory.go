@@ -0,0 +1,74 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// HandleFactory registers a new request handle with the given path and method,
+// like Handle, that is created by calling factory when the route is matched.
+//
+// If cache is true, factory is called on the first match, and the handle is
+// used for all following requests. Concurrent first requests wait for the
+// single call to complete. If factory panics or returns nil, it is called
+// again for the next request. Otherwise factory is called for every request,
+// e.g. to pick up reloaded plugins.
+//
+// A nil handle returned by factory causes a panic while serving the request.
+func (r *Router) HandleFactory(method, path string, factory func() http.Handler, cache bool) {
+	if factory == nil {
+		panic(registrationError(KindNilHandler, path,
+			"factory must not be nil in path '"+path+"'"))
+	}
+
+	r.Handle(method, path, &factoryHandler{path: path, factory: factory, cache: cache})
+}
+
+type factoryHandler struct {
+	path    string
+	factory func() http.Handler
+	cache   bool
+
+	// done is accessed atomically and is non-zero once handle was created
+	// successfully.
+	done   uint32
+	mu     sync.Mutex
+	handle http.Handler
+}
+
+func (h *factoryHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !h.cache {
+		h.create().ServeHTTP(w, req)
+		return
+	}
+
+	if atomic.LoadUint32(&h.done) == 0 {
+		h.createOnce()
+	}
+	h.handle.ServeHTTP(w, req)
+}
+
+// createOnce sets handle, unless another request did already.
+func (h *factoryHandler) createOnce() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.done == 0 {
+		h.handle = h.create()
+		atomic.StoreUint32(&h.done, 1)
+	}
+}
+
+// create calls the factory and panics if it returns nil.
+func (h *factoryHandler) create() http.Handler {
+	handle := h.factory()
+	if handle == nil {
+		panic("httprouter: factory returned a nil handle for path '" + h.path + "'")
+	}
+	return handle
+}
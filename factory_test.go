@@ -0,0 +1,108 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRouterHandleFactory(t *testing.T) {
+	var created, served int32
+	factory := func() http.Handler {
+		atomic.AddInt32(&created, 1)
+		return http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+			atomic.AddInt32(&served, 1)
+		})
+	}
+
+	router := New()
+	router.HandleFactory(http.MethodGet, "/cached", factory, true)
+	router.HandleFactory(http.MethodGet, "/uncached", factory, false)
+
+	if created != 0 {
+		t.Fatalf("factory called %d times before first request", created)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, _ := http.NewRequest(http.MethodGet, "/cached", nil)
+			router.ServeHTTP(httptest.NewRecorder(), r)
+		}()
+	}
+	wg.Wait()
+
+	if created != 1 || served != 10 {
+		t.Errorf("cached factory: created %d handles for %d requests, want 1 for 10", created, served)
+	}
+
+	for i := 0; i < 3; i++ {
+		r, _ := http.NewRequest(http.MethodGet, "/uncached", nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if created != 4 || served != 13 {
+		t.Errorf("uncached factory: created %d handles for %d requests, want 4 for 13", created, served)
+	}
+
+	recv := catchPanic(func() {
+		router.HandleFactory(http.MethodGet, "/nil", nil, true)
+	})
+	if recv == nil {
+		t.Error("registering nil factory did not panic")
+	}
+}
+
+func TestRouterHandleFactoryFailure(t *testing.T) {
+	var calls int
+	factory := func() http.Handler {
+		calls++
+		switch calls {
+		case 1:
+			panic("transient failure")
+		case 2:
+			return nil
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})
+	}
+
+	var panics []interface{}
+	router := New()
+	router.PanicHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panics = append(panics, GetPanic(r.Context()))
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	router.HandleFactory(http.MethodGet, "/cached", factory, true)
+
+	for i, want := range []int{
+		http.StatusInternalServerError,
+		http.StatusInternalServerError,
+		http.StatusTeapot,
+		http.StatusTeapot,
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, "/cached", nil)
+		router.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Errorf("request %d: got %d, want %d", i, w.Code, want)
+		}
+	}
+
+	if calls != 3 {
+		t.Errorf("factory called %d times, want 3", calls)
+	}
+	if len(panics) != 2 || panics[0] != "transient failure" ||
+		panics[1] != "httprouter: factory returned a nil handle for path '/cached'" {
+		t.Errorf("wrong panics: %v", panics)
+	}
+}
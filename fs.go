@@ -0,0 +1,28 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package httprouter
+
+import (
+	"io/fs"
+	"net/http"
+)
+
+// ServeFilesFS serves files from the given fs.FS, e.g. an embed.FS, like
+// ServeFiles. The path must end with "/*filepath".
+// Requests for directories are answered with their index.html file, or by the
+// Router's NotFound handler if they have none, no directory listings are
+// generated.
+//     //go:embed static
+//     var static embed.FS
+//
+//     router.ServeFilesFS("/static/*filepath", static)
+// Note that the paths of an embed.FS include the name of the embedded
+// directory, use fs.Sub to serve its contents at the root.
+func (r *Router) ServeFilesFS(path string, fsys fs.FS) {
+	r.ServeFiles(path, noListingFS{http.FS(fsys)})
+}
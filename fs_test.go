@@ -0,0 +1,57 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRouterServeFilesFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"robots.txt":         {Data: []byte("robots")},
+		"docs/index.html":    {Data: []byte("docs")},
+		"docs/guide.html":    {Data: []byte("guide")},
+		"assets/app.js":      {Data: []byte("app")},
+		"assets/css/app.css": {Data: []byte("css")},
+	}
+
+	router := New()
+	router.ServeFilesFS("/static/*filepath", fsys)
+
+	for _, test := range []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{http.MethodGet, "/static/robots.txt", http.StatusOK, "robots"},
+		{http.MethodHead, "/static/robots.txt", http.StatusOK, ""},
+		{http.MethodGet, "/static/docs/", http.StatusOK, "docs"},
+		{http.MethodGet, "/static/docs/guide.html", http.StatusOK, "guide"},
+		{http.MethodGet, "/static/docs", http.StatusMovedPermanently, ""},
+		{http.MethodGet, "/static/assets/", http.StatusNotFound, ""},
+		{http.MethodGet, "/static/", http.StatusNotFound, ""},
+		{http.MethodGet, "/static/missing.txt", http.StatusNotFound, ""},
+	} {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || (test.body != "" && w.Body.String() != test.body) {
+			t.Errorf("%s %s failed: Code=%d, Body=%q", test.method, test.path, w.Code, w.Body.String())
+		}
+	}
+
+	recv := catchPanic(func() {
+		router.ServeFilesFS("/noFilepath", fsys)
+	})
+	if recv == nil {
+		t.Error("registering path not ending with '*filepath' did not panic")
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import "net/http"
+
+// Use appends middleware to the chain wrapping the handles of all routes
+// registered afterwards. Routes registered before are not affected.
+//
+// Middleware runs in the order it was added, the first one is the outermost.
+// The params of the route are already accessible from the request context when
+// the first middleware runs. Responses to requests not matching any route are
+// only wrapped if UseForUnmatched is enabled.
+func (r *Router) Use(mw ...func(http.Handler) http.Handler) {
+	r.lock("")
+	defer r.mu.Unlock()
+
+	r.middleware = append(r.middleware, mw...)
+}
+
+// middlewareChain returns the middleware added with Use. The result must not
+// be modified.
+func (r *Router) middlewareChain() []func(http.Handler) http.Handler {
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	// limit the capacity, so Use does not append to the returned slice
+	return r.middleware[:len(r.middleware):len(r.middleware)]
+}
+
+// Group returns a group of routes whose paths begin with the given prefix. The
+// prefix must either be empty or begin with '/' and not end with '/'.
+//     api := router.Group("/api")
+//     api.Use(auth)
+//     api.Get("/users/:id", h) // GET /api/users/:id
+func (r *Router) Group(prefix string) *Group {
+	checkPrefix(prefix)
+	return &Group{router: r, prefix: prefix}
+}
+
+// Group is a group of routes sharing a path prefix and middleware, created
+// with Router.Group.
+//
+// The handles of routes registered with a group are wrapped with the
+// middleware of the router first, then with the middleware of the parent
+// groups and finally with the middleware of the group itself, as added by the
+// time the route is registered.
+type Group struct {
+	router     *Router
+	parent     *Group
+	prefix     string
+	middleware []func(http.Handler) http.Handler
+}
+
+// Use appends middleware to the chain wrapping the handles of all routes
+// registered with the group or its subgroups afterwards, like Router.Use.
+func (g *Group) Use(mw ...func(http.Handler) http.Handler) {
+	g.middleware = append(g.middleware, mw...)
+}
+
+// Group returns a subgroup of routes whose paths begin with the prefix of the
+// group followed by the given prefix. The subgroup inherits the middleware of
+// the group.
+func (g *Group) Group(prefix string) *Group {
+	checkPrefix(prefix)
+	return &Group{router: g.router, parent: g, prefix: g.prefix + prefix}
+}
+
+// Handle registers a new request handle with the prefix of the group followed
+// by the given path and the given method, like Router.Handle. The path must
+// begin with '/'.
+func (g *Group) Handle(method, path string, handle http.Handler) *Route {
+	if len(path) < 1 || path[0] != '/' {
+		panic(registrationError(KindBadPath, path,
+			"path must begin with '/' in path '"+path+"'"))
+	}
+
+	path = g.prefix + path
+	cand := g.router.register(registration{
+		method:     method,
+		path:       path,
+		handle:     handle,
+		middleware: g.chain(),
+	})
+	return newRoute(g.router, path, method, cand)
+}
+
+// Get is a shortcut for group.Handle(http.MethodGet, path, handle)
+func (g *Group) Get(path string, handle http.Handler) *Route {
+	return g.Handle(http.MethodGet, path, handle)
+}
+
+// Head is a shortcut for group.Handle(http.MethodHead, path, handle)
+func (g *Group) Head(path string, handle http.Handler) *Route {
+	return g.Handle(http.MethodHead, path, handle)
+}
+
+// Options is a shortcut for group.Handle(http.MethodOptions, path, handle)
+func (g *Group) Options(path string, handle http.Handler) *Route {
+	return g.Handle(http.MethodOptions, path, handle)
+}
+
+// Post is a shortcut for group.Handle(http.MethodPost, path, handle)
+func (g *Group) Post(path string, handle http.Handler) *Route {
+	return g.Handle(http.MethodPost, path, handle)
+}
+
+// Put is a shortcut for group.Handle(http.MethodPut, path, handle)
+func (g *Group) Put(path string, handle http.Handler) *Route {
+	return g.Handle(http.MethodPut, path, handle)
+}
+
+// Patch is a shortcut for group.Handle(http.MethodPatch, path, handle)
+func (g *Group) Patch(path string, handle http.Handler) *Route {
+	return g.Handle(http.MethodPatch, path, handle)
+}
+
+// Delete is a shortcut for group.Handle(http.MethodDelete, path, handle)
+func (g *Group) Delete(path string, handle http.Handler) *Route {
+	return g.Handle(http.MethodDelete, path, handle)
+}
+
+// chain returns the middleware of the router and of the groups from the root
+// group down to g.
+func (g *Group) chain() []func(http.Handler) http.Handler {
+	var chain []func(http.Handler) http.Handler
+	if g.parent != nil {
+		chain = g.parent.chain()
+	} else {
+		chain = g.router.middlewareChain()
+	}
+
+	// copy, so the slices of the router and parent groups are not modified
+	return append(chain[:len(chain):len(chain)], g.middleware...)
+}
+
+func checkPrefix(prefix string) {
+	if prefix != "" && (prefix[0] != '/' || prefix[len(prefix)-1] == '/') {
+		panic(registrationError(KindBadPath, prefix,
+			"prefix must begin with '/' and not end with '/' in prefix '"+prefix+"'"))
+	}
+}
+
+// middlewareHandler is a handle wrapped with middleware. The handle is kept, so
+// it can be found by Router.registered.
+type middlewareHandler struct {
+	handle  http.Handler
+	wrapped http.Handler
+}
+
+func wrapMiddleware(handle http.Handler, mw []func(http.Handler) http.Handler) http.Handler {
+	if len(mw) == 0 {
+		return handle
+	}
+
+	wrapped := handle
+	for i := len(mw) - 1; i >= 0; i-- {
+		wrapped = mw[i](wrapped)
+	}
+	return &middlewareHandler{handle, wrapped}
+}
+
+func (h *middlewareHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.wrapped.ServeHTTP(w, req)
+}
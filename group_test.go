@@ -0,0 +1,196 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRouterUse(t *testing.T) {
+	var calls []string
+	middleware := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name+":"+GetValue(r.Context(), "name"))
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handle:"+GetValue(r.Context(), "name"))
+	})
+
+	router := New()
+	router.Get("/before/:name", handlerFunc)
+	router.Use(middleware("a"), middleware("b"))
+	router.Get("/after/:name", handlerFunc)
+
+	for _, test := range []struct {
+		path  string
+		calls []string
+	}{
+		{"/before/gopher", []string{"handle:gopher"}},
+		{"/after/gopher", []string{"a:gopher", "b:gopher", "handle:gopher"}},
+	} {
+		calls = nil
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if !reflect.DeepEqual(calls, test.calls) {
+			t.Errorf("GET %s: got calls %v, want %v", test.path, calls, test.calls)
+		}
+	}
+}
+
+func TestRouterGroup(t *testing.T) {
+	var calls []string
+	middleware := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handle:"+GetValue(r.Context(), "id"))
+	})
+
+	router := New()
+	router.Use(middleware("router"))
+
+	api := router.Group("/api")
+	api.Use(middleware("api"))
+	api.Get("/status", handlerFunc)
+
+	v1 := api.Group("/v1")
+	v1.Use(middleware("v1"))
+	v1.Get("/users/:id", handlerFunc).Name("user")
+
+	// middleware added later applies to routes registered afterwards only
+	router.Use(middleware("late"))
+	api.Post("/status", handlerFunc)
+
+	for _, test := range []struct {
+		method, path string
+		calls        []string
+	}{
+		{http.MethodGet, "/api/status", []string{"router", "api", "handle:"}},
+		{http.MethodGet, "/api/v1/users/42", []string{"router", "api", "v1", "handle:42"}},
+		{http.MethodPost, "/api/status", []string{"router", "late", "api", "handle:"}},
+	} {
+		calls = nil
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || !reflect.DeepEqual(calls, test.calls) {
+			t.Errorf("%s %s: got %d with calls %v, want calls %v",
+				test.method, test.path, w.Code, calls, test.calls)
+		}
+	}
+
+	if u, err := router.URL("user", "42"); err != nil || u != "/api/v1/users/42" {
+		t.Errorf(`URL("user", "42") = %q, %v; want "/api/v1/users/42"`, u, err)
+	}
+
+	for _, prefix := range []string{"api", "/api/"} {
+		recv := catchPanic(func() {
+			router.Group(prefix)
+		})
+		if err, ok := recv.(*RegistrationError); !ok || err.Kind != KindBadPath {
+			t.Errorf("expected bad path panic for prefix %q, got %v", prefix, recv)
+		}
+	}
+
+	recv := catchPanic(func() {
+		api.Get("status", handlerFunc)
+	})
+	if err, ok := recv.(*RegistrationError); !ok || err.Kind != KindBadPath {
+		t.Errorf("expected bad path panic, got %v", recv)
+	}
+}
+
+func TestRouterUseVariants(t *testing.T) {
+	var wrapped int
+	router := New()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wrapped++
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	// variants are added to the handle wrapped by the middleware
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+	router.HandleContentType(http.MethodPost, "/upload", "application/json", handlerFunc)
+	router.HandleContentType(http.MethodPost, "/upload", "text/plain", handlerFunc)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodPost, "/upload", nil)
+	r.Header.Set("Content-Type", "text/plain")
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || wrapped != 1 {
+		t.Errorf("got %d with middleware called %d times", w.Code, wrapped)
+	}
+}
+
+func TestRouterUseForUnmatched(t *testing.T) {
+	var statuses []int
+	router := New()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &StatusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec.Writer(), r)
+			statuses = append(statuses, rec.Status())
+		})
+	})
+	router.Get("/users", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	router.Get("/b", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	router.MethodNotAllowedFor("/b", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	}))
+
+	requests := []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodGet, "/users", http.StatusOK},
+		{http.MethodGet, "/nope", http.StatusTeapot},
+		{http.MethodPost, "/users", http.StatusMethodNotAllowed},
+		{http.MethodOptions, "/users", http.StatusOK},
+		{http.MethodPost, "/b", http.StatusConflict},
+	}
+	for _, unmatched := range [...]bool{false, true} {
+		router.UseForUnmatched = unmatched
+		statuses = nil
+
+		for _, req := range requests {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(req.method, req.path, nil)
+			router.ServeHTTP(w, r)
+			if w.Code != req.code {
+				t.Errorf("%s %s (UseForUnmatched=%t): got %d, want %d",
+					req.method, req.path, unmatched, w.Code, req.code)
+			}
+		}
+
+		want := []int{http.StatusOK}
+		if unmatched {
+			want = []int{http.StatusOK, http.StatusTeapot, http.StatusMethodNotAllowed, http.StatusOK,
+				http.StatusConflict}
+		}
+		if !reflect.DeepEqual(statuses, want) {
+			t.Errorf("UseForUnmatched=%t: middleware saw %v, want %v", unmatched, statuses, want)
+		}
+	}
+}
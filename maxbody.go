@@ -0,0 +1,33 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import "net/http"
+
+// HandleMaxBody registers a new request handle with the given path and method,
+// like Handle, whose request bodies are limited to maxBytes bytes with
+// http.MaxBytesReader. Reading beyond the limit returns an error and the
+// connection is closed after the response.
+func (r *Router) HandleMaxBody(method, path string, handle http.Handler, maxBytes int64) {
+	if maxBytes < 0 {
+		panic(registrationError(KindInvalidOption, path,
+			"body limit must not be negative in path '"+path+"'"))
+	}
+
+	r.Handle(method, path, &maxBodyHandler{handle, maxBytes})
+}
+
+type maxBodyHandler struct {
+	http.Handler
+	maxBytes int64
+}
+
+func (h *maxBodyHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Body != nil {
+		req.Body = http.MaxBytesReader(w, req.Body, h.maxBytes)
+	}
+
+	h.Handler.ServeHTTP(w, req)
+}
@@ -0,0 +1,48 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouterHandleMaxBody(t *testing.T) {
+	var body string
+	var readErr error
+	router := New()
+	router.HandleMaxBody(http.MethodPost, "/upload", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b []byte
+		b, readErr = ioutil.ReadAll(r.Body)
+		body = string(b)
+	}), 5)
+
+	for _, test := range []struct {
+		body string
+		fail bool
+	}{
+		{"", false},
+		{"small", false},
+		{"too large", true},
+	} {
+		r, _ := http.NewRequest(http.MethodPost, "/upload", strings.NewReader(test.body))
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if (readErr != nil) != test.fail {
+			t.Errorf("reading body %q: unexpected error %v", test.body, readErr)
+		} else if !test.fail && body != test.body {
+			t.Errorf("reading body %q: got %q", test.body, body)
+		}
+	}
+
+	recv := catchPanic(func() {
+		router.HandleMaxBody(http.MethodPost, "/negative", http.NotFoundHandler(), -1)
+	})
+	if recv == nil {
+		t.Error("registering negative body limit did not panic")
+	}
+}
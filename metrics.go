@@ -0,0 +1,51 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"time"
+)
+
+// NewMetricsHandler returns a http.Handler which serves requests with next,
+// usually a *Router, and reports every request to obs once it has been
+// served. The pattern is the registered path of the matched route, e.g.
+// "/users/:id", which unlike the request path is suitable as a metrics label.
+// It is empty if no route matched, e.g. for requests answered by NotFound or
+// redirected. The code is the status code of the response and dur is the time
+// taken to serve the request.
+//
+// The pattern is only known if the http.ResponseWriter passed to next reaches
+// the router, i.e. middleware between the handler and the router must not
+// replace it, other than with the Writer of a StatusRecorder.
+func NewMetricsHandler(next http.Handler, obs func(method, pattern string, code int, dur time.Duration)) http.Handler {
+	return &metricsHandler{next, obs}
+}
+
+type metricsHandler struct {
+	next http.Handler
+	obs  func(method, pattern string, code int, dur time.Duration)
+}
+
+func (h *metricsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	var pattern string
+	rec := &StatusRecorder{ResponseWriter: w, onPattern: func(p string) {
+		pattern = p
+	}}
+	h.next.ServeHTTP(rec.Writer(), req)
+
+	code := rec.Status()
+	if code == 0 {
+		code = http.StatusOK
+	}
+	h.obs(req.Method, pattern, code, time.Since(start))
+}
+
+// patternRecorder is implemented by http.ResponseWriters which record the
+// pattern of the route matched by the router.
+type patternRecorder interface {
+	recordPattern(pattern string)
+}
@@ -0,0 +1,93 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type hijackResponseWriter struct {
+	mockResponseWriter
+	hijacked bool
+}
+
+func (w *hijackResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return nil, nil, nil
+}
+
+func TestMetricsHandler(t *testing.T) {
+	router := New()
+	router.Get("/users/:id", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	router.Post("/users", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	router.Get("/stream", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.(http.Flusher).Flush()
+	}))
+	router.Get("/hijack", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+			return
+		}
+		if _, _, err := hj.Hijack(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+
+	var method, pattern string
+	var code int
+	handler := NewMetricsHandler(router, func(m, p string, c int, dur time.Duration) {
+		method, pattern, code = m, p, c
+		if dur < 0 {
+			t.Errorf("negative duration %v", dur)
+		}
+	})
+
+	for _, test := range []struct {
+		method, path, pattern string
+		code                  int
+	}{
+		{http.MethodGet, "/users/42", "/users/:id", http.StatusOK},
+		{http.MethodPost, "/users", "/users", http.StatusCreated},
+		{http.MethodGet, "/nope", "", http.StatusNotFound},
+		{http.MethodPut, "/users", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/users/42/", "", http.StatusMovedPermanently},
+	} {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if method != test.method || pattern != test.pattern || code != test.code {
+			t.Errorf("%s %s: observed %s %q %d, want %s %q %d",
+				test.method, test.path, method, pattern, code, test.method, test.pattern, test.code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/stream", nil)
+	handler.ServeHTTP(w, r)
+	if !w.Flushed {
+		t.Error("Flush was not passed through")
+	}
+
+	hw := new(hijackResponseWriter)
+	r, _ = http.NewRequest(http.MethodGet, "/hijack", nil)
+	handler.ServeHTTP(hw, r)
+	if !hw.hijacked {
+		t.Error("Hijack was not passed through")
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Hijack of a http.ResponseWriter without support: got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// HandleContentType registers a new request handle with the given path and
+// method that is only used for requests with the given Content-Type. Only the
+// media type is compared, parameters like charset are ignored.
+//
+// Several handles can be registered for the same path and method with
+// different content types. A handle registered with an empty content type is
+// used for requests that match none of the others. If there is no such handle,
+// these requests are answered with 415 Unsupported Media Type.
+func (r *Router) HandleContentType(method, path, contentType string, handle http.Handler) {
+	if handle == nil {
+		panic(registrationError(KindNilHandler, path,
+			"handle must not be nil in path '"+path+"'"))
+	}
+	if contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			panic(registrationError(KindInvalidOption, path,
+				"invalid content type '"+contentType+"' in path '"+path+"'"))
+		}
+		contentType = mediaType
+	}
+
+	mw := r.middlewareChain()
+	r.lock(path)
+	defer r.mu.Unlock()
+
+	h, ok := r.registered(method, path).(*contentTypeHandler)
+	if !ok {
+		h = &contentTypeHandler{handlers: make(map[string]http.Handler)}
+		r.registerLocked(registration{method: method, path: path, handle: h, middleware: mw})
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if contentType == "" {
+		if h.fallback != nil {
+			panic(registrationError(KindConflict, path,
+				"a default handle is already registered for path '"+path+"'"))
+		}
+		h.fallback = handle
+		return
+	}
+
+	if h.handlers[contentType] != nil {
+		panic(registrationError(KindConflict, path,
+			"a handle is already registered for content type '"+contentType+
+				"' in path '"+path+"'"))
+	}
+	h.handlers[contentType] = handle
+}
+
+type contentTypeHandler struct {
+	// mu guards the handles, which may be added while requests are served
+	mu       sync.RWMutex
+	handlers map[string]http.Handler
+	fallback http.Handler
+}
+
+func (h *contentTypeHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if handle := h.handle(req); handle != nil {
+		handle.ServeHTTP(w, req)
+		return
+	}
+
+	http.Error(w,
+		http.StatusText(http.StatusUnsupportedMediaType),
+		http.StatusUnsupportedMediaType,
+	)
+}
+
+// handle returns the handle for the Content-Type of req, or nil if there is
+// none.
+func (h *contentTypeHandler) handle(req *http.Request) http.Handler {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type")); err == nil {
+		if handle := h.handlers[mediaType]; handle != nil {
+			return handle
+		}
+	}
+	return h.fallback
+}
+
+// HandleUA registers a new request handle with the given path and method that
+// is only used for requests whose User-Agent header is accepted by match.
+//
+// Several handles can be registered for the same path and method, their
+// predicates are evaluated in the order of registration. If none of them
+// accepts the User-Agent, the request is handled like a request for which no
+// route was found.
+func (r *Router) HandleUA(method, path string, match func(ua string) bool, handle http.Handler) {
+	if match == nil {
+		panic(registrationError(KindNilHandler, path,
+			"match must not be nil in path '"+path+"'"))
+	}
+	if handle == nil {
+		panic(registrationError(KindNilHandler, path,
+			"handle must not be nil in path '"+path+"'"))
+	}
+	mw := r.middlewareChain()
+	r.lock(path)
+	defer r.mu.Unlock()
+
+	h, ok := r.registered(method, path).(*uaHandler)
+	if !ok {
+		h = &uaHandler{r: r}
+		r.registerLocked(registration{method: method, path: path, handle: h, middleware: mw})
+	}
+
+	h.mu.Lock()
+	h.variants = append(h.variants, uaVariant{match, handle})
+	h.mu.Unlock()
+}
+
+type uaVariant struct {
+	match  func(ua string) bool
+	handle http.Handler
+}
+
+type uaHandler struct {
+	r *Router
+
+	// mu guards variants, which may be added while requests are served
+	mu       sync.RWMutex
+	variants []uaVariant
+}
+
+func (h *uaHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// variants are only appended to, the predicates are called unlocked
+	h.mu.RLock()
+	variants := h.variants
+	h.mu.RUnlock()
+
+	ua := req.UserAgent()
+	for _, v := range variants {
+		if v.match(ua) {
+			v.handle.ServeHTTP(w, req)
+			return
+		}
+	}
+
+	h.r.serveNotFound(w, req)
+}
+
+// HandleEncoding registers a new request handle with the given path and method
+// that is only used for requests accepting the given content encoding, e.g.
+// "br" or "gzip", according to their Accept-Encoding header.
+//
+// Several handles can be registered for the same path and method with
+// different encodings. The encoding with the highest quality value is used,
+// ties are broken by the order of registration. A handle registered with an
+// empty encoding is used for requests accepting none of the others. If there
+// is no such handle, these requests are answered with 406 Not Acceptable.
+// All responses get a "Vary: Accept-Encoding" header.
+func (r *Router) HandleEncoding(method, path, encoding string, handle http.Handler) {
+	if handle == nil {
+		panic(registrationError(KindNilHandler, path,
+			"handle must not be nil in path '"+path+"'"))
+	}
+	encoding = strings.ToLower(encoding)
+
+	mw := r.middlewareChain()
+	r.lock(path)
+	defer r.mu.Unlock()
+
+	h, ok := r.registered(method, path).(*encodingHandler)
+	if !ok {
+		h = &encodingHandler{handlers: make(map[string]http.Handler)}
+		r.registerLocked(registration{method: method, path: path, handle: h, middleware: mw})
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if encoding == "" {
+		if h.fallback != nil {
+			panic(registrationError(KindConflict, path,
+				"a default handle is already registered for path '"+path+"'"))
+		}
+		h.fallback = handle
+		return
+	}
+
+	if h.handlers[encoding] != nil {
+		panic(registrationError(KindConflict, path,
+			"a handle is already registered for encoding '"+encoding+
+				"' in path '"+path+"'"))
+	}
+	h.handlers[encoding] = handle
+	h.encodings = append(h.encodings, encoding)
+}
+
+type encodingHandler struct {
+	// mu guards the handles, which may be added while requests are served
+	mu        sync.RWMutex
+	handlers  map[string]http.Handler
+	encodings []string // in order of registration
+	fallback  http.Handler
+}
+
+func (h *encodingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	if handle := h.handle(req); handle != nil {
+		handle.ServeHTTP(w, req)
+		return
+	}
+
+	http.Error(w,
+		http.StatusText(http.StatusNotAcceptable),
+		http.StatusNotAcceptable,
+	)
+}
+
+// handle returns the handle for the most acceptable encoding of req, or nil
+// if there is none.
+func (h *encodingHandler) handle(req *http.Request) http.Handler {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	accepted := parseAcceptEncoding(req.Header.Get("Accept-Encoding"))
+
+	var best string
+	var bestQ float64
+	for _, encoding := range h.encodings {
+		q, ok := accepted[encoding]
+		if !ok {
+			q = accepted["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	if best != "" {
+		return h.handlers[best]
+	}
+	return h.fallback
+}
+
+// parseAcceptEncoding returns the quality values of the encodings listed in
+// an Accept-Encoding header. Encodings without a valid quality value have a
+// quality of 1.
+func parseAcceptEncoding(header string) map[string]float64 {
+	accepted := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		encoding, params := part, ""
+		if i := strings.IndexByte(part, ';'); i >= 0 {
+			encoding, params = part[:i], part[i+1:]
+		}
+
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding == "" {
+			continue
+		}
+
+		q := 1.0
+		params = strings.TrimSpace(params)
+		if strings.HasPrefix(params, "q=") {
+			if v, err := strconv.ParseFloat(params[2:], 64); err == nil {
+				q = v
+			}
+		}
+		accepted[encoding] = q
+	}
+	return accepted
+}
@@ -0,0 +1,206 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouterHandleContentType(t *testing.T) {
+	var routed string
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			routed = name
+		})
+	}
+
+	router := New()
+	router.HandleContentType(http.MethodPost, "/submit", "application/json", handler("json"))
+	router.HandleContentType(http.MethodPost, "/submit", "application/x-www-form-urlencoded", handler("form"))
+	router.HandleContentType(http.MethodPost, "/upload", "text/plain", handler("text"))
+
+	for _, test := range []struct {
+		path, contentType string
+		code              int
+		routed            string
+	}{
+		{"/submit", "application/json", http.StatusOK, "json"},
+		{"/submit", "Application/JSON; charset=utf-8", http.StatusOK, "json"},
+		{"/submit", "application/x-www-form-urlencoded", http.StatusOK, "form"},
+		{"/submit", "text/plain", http.StatusUnsupportedMediaType, ""},
+		{"/submit", "", http.StatusUnsupportedMediaType, ""},
+		{"/upload", "text/plain", http.StatusOK, "text"},
+	} {
+		routed = ""
+		r, _ := http.NewRequest(http.MethodPost, test.path, nil)
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed {
+			t.Errorf("routing %s with Content-Type %q failed: Code=%d, routed=%q",
+				test.path, test.contentType, w.Code, routed)
+		}
+	}
+
+	router.HandleContentType(http.MethodPost, "/submit", "", handler("default"))
+	r, _ := http.NewRequest(http.MethodPost, "/submit", nil)
+	r.Header.Set("Content-Type", "text/plain")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if routed != "default" {
+		t.Errorf("default handler not used, routed=%q", routed)
+	}
+
+	for _, register := range []func(){
+		func() { router.HandleContentType(http.MethodPost, "/submit", "application/json", handler("dup")) },
+		func() { router.HandleContentType(http.MethodPost, "/submit", "", handler("dup")) },
+		func() { router.HandleContentType(http.MethodPost, "/submit", "invalid/", handler("invalid")) },
+	} {
+		if recv := catchPanic(register); recv == nil {
+			t.Error("registering invalid content type handle did not panic")
+		}
+	}
+
+	router.Post("/plain", handler("plain"))
+	recv := catchPanic(func() {
+		router.HandleContentType(http.MethodPost, "/plain", "text/plain", handler("text"))
+	})
+	if recv == nil {
+		t.Error("registering content type handle for existing route did not panic")
+	}
+}
+
+func TestRouterHandleUA(t *testing.T) {
+	var routed string
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			routed = name
+		})
+	}
+
+	router := New()
+	router.HandleUA(http.MethodGet, "/api", func(ua string) bool {
+		return strings.HasPrefix(ua, "curl/")
+	}, handler("curl"))
+	router.HandleUA(http.MethodGet, "/api", func(ua string) bool {
+		return strings.HasPrefix(ua, "Go-http-client/")
+	}, handler("go"))
+
+	for _, test := range []struct {
+		ua     string
+		code   int
+		routed string
+	}{
+		{"curl/7.64.1", http.StatusOK, "curl"},
+		{"Go-http-client/1.1", http.StatusOK, "go"},
+		{"Mozilla/5.0", http.StatusNotFound, ""},
+		{"", http.StatusNotFound, ""},
+	} {
+		routed = ""
+		r, _ := http.NewRequest(http.MethodGet, "/api", nil)
+		r.Header.Set("User-Agent", test.ua)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed {
+			t.Errorf("routing User-Agent %q failed: Code=%d, routed=%q", test.ua, w.Code, routed)
+		}
+	}
+
+	notFound := false
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		notFound = true
+	})
+	r, _ := http.NewRequest(http.MethodGet, "/api", nil)
+	r.Header.Set("User-Agent", "Mozilla/5.0")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if !notFound {
+		t.Error("NotFound handler not used for rejected User-Agent")
+	}
+}
+
+func TestRouterHandleEncoding(t *testing.T) {
+	var routed string
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			routed = name
+		})
+	}
+
+	router := New()
+	router.HandleEncoding(http.MethodGet, "/app.js", "br", handler("br"))
+	router.HandleEncoding(http.MethodGet, "/app.js", "gzip", handler("gzip"))
+	router.HandleEncoding(http.MethodGet, "/style.css", "gzip", handler("gzip"))
+
+	for _, test := range []struct {
+		path, accept string
+		code         int
+		routed       string
+	}{
+		{"/app.js", "gzip, deflate, br", http.StatusOK, "br"},
+		{"/app.js", "gzip", http.StatusOK, "gzip"},
+		{"/app.js", "br;q=0.5, GZIP;q=0.8", http.StatusOK, "gzip"},
+		{"/app.js", "br;q=0, gzip;q=0", http.StatusNotAcceptable, ""},
+		{"/app.js", "*", http.StatusOK, "br"},
+		{"/app.js", "*;q=0.1, gzip;q=0.5", http.StatusOK, "gzip"},
+		{"/app.js", "", http.StatusNotAcceptable, ""},
+		{"/style.css", "deflate", http.StatusNotAcceptable, ""},
+	} {
+		routed = ""
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		if test.accept != "" {
+			r.Header.Set("Accept-Encoding", test.accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed {
+			t.Errorf("routing %s with Accept-Encoding %q failed: Code=%d, routed=%q",
+				test.path, test.accept, w.Code, routed)
+		}
+		if vary := w.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("wrong Vary header for %s: %q", test.path, vary)
+		}
+	}
+
+	router.HandleEncoding(http.MethodGet, "/app.js", "", handler("identity"))
+	r, _ := http.NewRequest(http.MethodGet, "/app.js", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if routed != "identity" {
+		t.Errorf("default handler not used, routed=%q", routed)
+	}
+
+	for _, register := range []func(){
+		func() { router.HandleEncoding(http.MethodGet, "/app.js", "BR", handler("dup")) },
+		func() { router.HandleEncoding(http.MethodGet, "/app.js", "", handler("dup")) },
+	} {
+		if recv := catchPanic(register); recv == nil {
+			t.Error("registering duplicate encoding handle did not panic")
+		}
+	}
+}
+
+func TestRouterNegotiateNilHandle(t *testing.T) {
+	handler := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	match := func(string) bool { return true }
+
+	router := New()
+	for name, register := range map[string]func(){
+		"HandleContentType": func() { router.HandleContentType(http.MethodPost, "/a", "text/plain", nil) },
+		"HandleUA":          func() { router.HandleUA(http.MethodGet, "/b", match, nil) },
+		"HandleUA match":    func() { router.HandleUA(http.MethodGet, "/c", nil, handler) },
+		"HandleEncoding":    func() { router.HandleEncoding(http.MethodGet, "/d", "gzip", nil) },
+	} {
+		recv := catchPanic(register)
+		if rerr, ok := recv.(*RegistrationError); !ok || rerr.Kind != KindNilHandler {
+			t.Errorf("%s: got panic %v, want a nil handler error", name, recv)
+		}
+	}
+	if routes := router.Routes(); len(routes) != 0 {
+		t.Errorf("rejected handles were registered: %v", routes)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"strings"
+)
+
+// OperationMeta describes the operation of a route for OpenAPIPaths.
+type OperationMeta struct {
+	Summary     string   `json:"summary,omitempty"`
+	Description string   `json:"description,omitempty"`
+	OperationID string   `json:"operationId,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+
+	// Parameters describes the parameters of the operation. The path params
+	// of the route are added automatically, an entry with the same name and
+	// an In of "path" or "" only adds its description.
+	Parameters []ParameterMeta `json:"parameters,omitempty"`
+}
+
+// ParameterMeta describes a parameter of an operation.
+type ParameterMeta struct {
+	Name string `json:"name"`
+
+	// In is the location of the parameter, one of "path", "query", "header"
+	// or "cookie". It defaults to "path".
+	In string `json:"in,omitempty"`
+
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// openAPIMethods are the methods for which OpenAPI defines operations.
+var openAPIMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodPut:     true,
+	http.MethodPost:    true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+	http.MethodHead:    true,
+	http.MethodPatch:   true,
+	http.MethodTrace:   true,
+}
+
+// HandleOp is like Handle, but additionally attaches op to the route, which is
+// included in the output of OpenAPIPaths.
+func (r *Router) HandleOp(method, path string, handle http.Handler, op OperationMeta) *Route {
+	route := r.Handle(method, path, handle)
+
+	r.lock(path)
+	defer r.mu.Unlock()
+
+	if r.operations == nil {
+		r.operations = make(map[string]OperationMeta)
+	}
+
+	// a path with an optional param is registered as two routes
+	plain, _ := splitConstraints(path)
+	if short, long, name := splitOptional(plain); name != "" {
+		r.operations[method+" "+short] = op
+		r.operations[method+" "+long] = op
+	} else {
+		r.operations[method+" "+plain] = op
+	}
+
+	return route
+}
+
+// OpenAPIPaths returns an OpenAPI 3 paths object describing the registered
+// routes, e.g. to be marshaled as JSON. Params are converted to OpenAPI path
+// params, e.g. "/user/:name" is described as "/user/{name}", and the
+// OperationMeta attached with HandleOp is included. The constraint of a param
+// is described as the pattern of its schema, a path with an optional param is
+// described as the two paths with and without it.
+//
+// The result is only a skeleton of a specification: responses and the types
+// of params are not known to the router. Routes of methods without an OpenAPI
+// operation, e.g. PROPFIND, are skipped.
+func (r *Router) OpenAPIPaths() map[string]interface{} {
+	routes := r.walkRoutes()
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	paths := make(map[string]interface{})
+	for _, route := range routes {
+		method := route.method
+		if !openAPIMethods[method] {
+			continue
+		}
+
+		plain, constraints := splitConstraints(route.path)
+		expanded := []string{plain}
+		if short, long, name := splitOptional(plain); name != "" {
+			expanded = []string{long, short}
+		}
+
+		for _, path := range expanded {
+			pattern, names := openAPIPath(path)
+			item, ok := paths[pattern].(map[string]interface{})
+			if !ok {
+				item = make(map[string]interface{})
+				paths[pattern] = item
+			}
+			item[strings.ToLower(method)] = openAPIOperation(names, constraints,
+				r.operations[method+" "+path])
+		}
+	}
+	return paths
+}
+
+// openAPIPath returns the OpenAPI path template of the given plain path and
+// the names of its params.
+func openAPIPath(path string) (string, []string) {
+	var pattern string
+	var names []string
+	for _, part := range splitPattern(path) {
+		pattern += part.literal
+		if part.param == "" {
+			continue
+		}
+
+		// the value of a catch-all includes the '/' before it
+		if part.kind == '*' {
+			pattern += "/"
+		}
+		pattern += "{" + part.param + "}"
+		names = append(names, part.param)
+	}
+	return pattern, names
+}
+
+// openAPIOperation returns the OpenAPI operation object of a route with the
+// given path params and their constraints.
+func openAPIOperation(names []string, constraints map[string]string, op OperationMeta) map[string]interface{} {
+	operation := make(map[string]interface{})
+	if op.Summary != "" {
+		operation["summary"] = op.Summary
+	}
+	if op.Description != "" {
+		operation["description"] = op.Description
+	}
+	if op.OperationID != "" {
+		operation["operationId"] = op.OperationID
+	}
+	if len(op.Tags) > 0 {
+		operation["tags"] = op.Tags
+	}
+
+	descriptions := make(map[string]string)
+	var params []interface{}
+	for _, p := range op.Parameters {
+		if p.In == "" || p.In == "path" {
+			descriptions[p.Name] = p.Description
+			continue
+		}
+
+		param := map[string]interface{}{
+			"name":   p.Name,
+			"in":     p.In,
+			"schema": map[string]interface{}{"type": "string"},
+		}
+		if p.Description != "" {
+			param["description"] = p.Description
+		}
+		if p.Required {
+			param["required"] = true
+		}
+		params = append(params, param)
+	}
+
+	pathParams := make([]interface{}, 0, len(names)+len(params))
+	for _, name := range names {
+		schema := map[string]interface{}{"type": "string"}
+		if expr, ok := constraints[name]; ok {
+			schema["pattern"] = "^(?:" + expr + ")$"
+		}
+
+		param := map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		}
+		if description := descriptions[name]; description != "" {
+			param["description"] = description
+		}
+		pathParams = append(pathParams, param)
+	}
+
+	if params = append(pathParams, params...); len(params) > 0 {
+		operation["parameters"] = params
+	}
+	return operation
+}
@@ -0,0 +1,68 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestRouterOpenAPIPaths(t *testing.T) {
+	router := New()
+	router.HandleOp(http.MethodGet, "/users/:id", http.NotFoundHandler(), OperationMeta{
+		Summary:     "Get a user",
+		OperationID: "getUser",
+		Tags:        []string{"users"},
+		Parameters: []ParameterMeta{
+			{Name: "id", Description: "The user ID"},
+			{Name: "fields", In: "query", Description: "Fields to include"},
+			{Name: "X-Request-ID", In: "header", Required: true},
+		},
+	})
+	router.Delete("/users/:id", http.NotFoundHandler())
+	router.HandleOp(http.MethodGet, "/files/:name.:ext", http.NotFoundHandler(), OperationMeta{
+		Summary: "Get a file",
+	})
+	router.Get("/src/*filepath", http.NotFoundHandler())
+	router.HandleOp(http.MethodGet, `/items/:id([0-9]+)?`, http.NotFoundHandler(), OperationMeta{
+		Summary: "List or get items",
+	})
+	router.Handle("PROPFIND", "/dav/*path", http.NotFoundHandler())
+
+	got, err := json.Marshal(router.OpenAPIPaths())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pathParam := func(name string) string {
+		return `{"in":"path","name":"` + name + `","required":true,"schema":{"type":"string"}}`
+	}
+	want := `{` +
+		`"/files/{name}.{ext}":{"get":{"parameters":[` + pathParam("name") + `,` + pathParam("ext") + `],"summary":"Get a file"}},` +
+		`"/items":{"get":{"summary":"List or get items"}},` +
+		`"/items/{id}":{"get":{"parameters":[` +
+		`{"in":"path","name":"id","required":true,"schema":{"pattern":"^(?:[0-9]+)$","type":"string"}}` +
+		`],"summary":"List or get items"}},` +
+		`"/src/{filepath}":{"get":{"parameters":[` + pathParam("filepath") + `]}},` +
+		`"/users/{id}":{` +
+		`"delete":{"parameters":[` + pathParam("id") + `]},` +
+		`"get":{"operationId":"getUser","parameters":[` +
+		`{"description":"The user ID","in":"path","name":"id","required":true,"schema":{"type":"string"}},` +
+		`{"description":"Fields to include","in":"query","name":"fields","schema":{"type":"string"}},` +
+		`{"in":"header","name":"X-Request-ID","required":true,"schema":{"type":"string"}}` +
+		`],"summary":"Get a user","tags":["users"]}}` +
+		`}`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	router.Remove(http.MethodGet, "/users/:id")
+	router.Get("/users/:id", http.NotFoundHandler())
+	op := router.OpenAPIPaths()["/users/{id}"].(map[string]interface{})["get"].(map[string]interface{})
+	if _, ok := op["summary"]; ok {
+		t.Errorf("operation of a removed route was kept: %v", op)
+	}
+}
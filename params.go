@@ -0,0 +1,189 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strconv"
+)
+
+// ErrMissingParam is the error of a *ParamError for a param that does not
+// exist.
+var ErrMissingParam = errors.New("param is missing")
+
+// ParamError is returned by the typed accessors of Params, e.g. Params.Int,
+// if the value of a param cannot be parsed.
+type ParamError struct {
+	// Name is the name of the param.
+	Name string
+
+	// Value is the value of the param.
+	Value string
+
+	// Type is the type the value was parsed as, e.g. "int".
+	Type string
+
+	// Err is the reason parsing failed, ErrMissingParam if the param does
+	// not exist.
+	Err error
+}
+
+func (e *ParamError) Error() string {
+	if e.Err == ErrMissingParam {
+		return "httprouter: param '" + e.Name + "' is missing"
+	}
+	return "httprouter: param '" + e.Name + "' with value " + strconv.Quote(e.Value) +
+		" is not a valid " + e.Type + ": " + e.Err.Error()
+}
+
+// Unwrap returns the reason parsing failed.
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// value returns the value of the param of the given name, or a *ParamError
+// if there is none.
+func (ps Params) value(name, typ string) (string, error) {
+	for i := range ps {
+		if ps[i].Key == name {
+			return ps[i].Value, nil
+		}
+	}
+	return "", &ParamError{Name: name, Type: typ, Err: ErrMissingParam}
+}
+
+// Int returns the value of the param of the given name parsed as a decimal
+// int. It returns a *ParamError if the param does not exist or its value is
+// not a valid int.
+func (ps Params) Int(name string) (int, error) {
+	v, err := ps.value(name, "int")
+	if err != nil {
+		return 0, err
+	}
+
+	i, err := strconv.ParseInt(v, 10, 0)
+	if err != nil {
+		return 0, &ParamError{name, v, "int", err.(*strconv.NumError).Err}
+	}
+	return int(i), nil
+}
+
+// Int64 returns the value of the param of the given name parsed as a decimal
+// int64. It returns a *ParamError if the param does not exist or its value is
+// not a valid int64.
+func (ps Params) Int64(name string) (int64, error) {
+	v, err := ps.value(name, "int64")
+	if err != nil {
+		return 0, err
+	}
+
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, &ParamError{name, v, "int64", err.(*strconv.NumError).Err}
+	}
+	return i, nil
+}
+
+// Bool returns the value of the param of the given name parsed as a bool, as
+// accepted by strconv.ParseBool, e.g. "true", "false", "1" and "0". It
+// returns a *ParamError if the param does not exist or its value is not a
+// valid bool.
+func (ps Params) Bool(name string) (bool, error) {
+	v, err := ps.value(name, "bool")
+	if err != nil {
+		return false, err
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, &ParamError{name, v, "bool", err.(*strconv.NumError).Err}
+	}
+	return b, nil
+}
+
+// UUID is a universally unique identifier as defined by RFC 4122.
+type UUID [16]byte
+
+// String returns the canonical form of the UUID, e.g.
+// "f47ac10b-58cc-4372-a567-0e02b2c3d479".
+func (u UUID) String() string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+var errInvalidUUID = errors.New("invalid UUID format")
+
+// UUID returns the value of the param of the given name parsed as a UUID in
+// its canonical form, e.g. "f47ac10b-58cc-4372-a567-0e02b2c3d479". Hex digits
+// may be upper or lower case. It returns a *ParamError if the param does not
+// exist or its value is not a valid UUID.
+func (ps Params) UUID(name string) (UUID, error) {
+	var u UUID
+	v, err := ps.value(name, "UUID")
+	if err != nil {
+		return u, err
+	}
+
+	if len(v) != 36 || v[8] != '-' || v[13] != '-' || v[18] != '-' || v[23] != '-' {
+		return u, &ParamError{name, v, "UUID", errInvalidUUID}
+	}
+
+	for j, i := range uuidOffsets {
+		hi, ok1 := unhex(v[i])
+		lo, ok2 := unhex(v[i+1])
+		if !ok1 || !ok2 {
+			return UUID{}, &ParamError{name, v, "UUID", errInvalidUUID}
+		}
+		u[j] = hi<<4 | lo
+	}
+	return u, nil
+}
+
+// uuidOffsets are the offsets of the bytes of a UUID in its canonical form.
+var uuidOffsets = [16]int{0, 2, 4, 6, 9, 11, 14, 16, 19, 21, 24, 26, 28, 30, 32, 34}
+
+// unhex returns the value of the hex digit c.
+func unhex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// GetInt is short-hand for GetParams(ctx).Int(name).
+func GetInt(ctx context.Context, name string) (int, error) {
+	return GetParams(ctx).Int(name)
+}
+
+// GetInt64 is short-hand for GetParams(ctx).Int64(name).
+func GetInt64(ctx context.Context, name string) (int64, error) {
+	return GetParams(ctx).Int64(name)
+}
+
+// GetBool is short-hand for GetParams(ctx).Bool(name).
+func GetBool(ctx context.Context, name string) (bool, error) {
+	return GetParams(ctx).Bool(name)
+}
+
+// GetUUID is short-hand for GetParams(ctx).UUID(name).
+func GetUUID(ctx context.Context, name string) (UUID, error) {
+	return GetParams(ctx).UUID(name)
+}
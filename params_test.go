@@ -0,0 +1,86 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestParamsTyped(t *testing.T) {
+	ps := Params{
+		{"id", "42"},
+		{"neg", "-7"},
+		{"big", "9223372036854775807"},
+		{"flag", "true"},
+		{"uuid", "F47AC10B-58cc-4372-a567-0e02b2c3d479"},
+		{"word", "abc"},
+		{"dash", "f47ac10b-58cc-4372-a567-0e02b2c3d47x"},
+	}
+
+	if i, err := ps.Int("id"); i != 42 || err != nil {
+		t.Errorf("Int(id) = %d, %v", i, err)
+	}
+	if i, err := ps.Int("neg"); i != -7 || err != nil {
+		t.Errorf("Int(neg) = %d, %v", i, err)
+	}
+	if i, err := ps.Int64("big"); i != 9223372036854775807 || err != nil {
+		t.Errorf("Int64(big) = %d, %v", i, err)
+	}
+	if b, err := ps.Bool("flag"); !b || err != nil {
+		t.Errorf("Bool(flag) = %v, %v", b, err)
+	}
+	if u, err := ps.UUID("uuid"); u.String() != "f47ac10b-58cc-4372-a567-0e02b2c3d479" || err != nil {
+		t.Errorf("UUID(uuid) = %s, %v", u, err)
+	}
+
+	for _, test := range []struct {
+		name string
+		fn   func() error
+		err  error
+		msg  string
+	}{
+		{"Int(word)", func() error { _, err := ps.Int("word"); return err },
+			strconv.ErrSyntax, `httprouter: param 'word' with value "abc" is not a valid int: invalid syntax`},
+		{"Int64(word)", func() error { _, err := ps.Int64("word"); return err },
+			strconv.ErrSyntax, `httprouter: param 'word' with value "abc" is not a valid int64: invalid syntax`},
+		{"Int(missing)", func() error { _, err := ps.Int("missing"); return err },
+			ErrMissingParam, `httprouter: param 'missing' is missing`},
+		{"Bool(id)", func() error { _, err := ps.Bool("id"); return err },
+			strconv.ErrSyntax, `httprouter: param 'id' with value "42" is not a valid bool: invalid syntax`},
+		{"UUID(word)", func() error { _, err := ps.UUID("word"); return err },
+			errInvalidUUID, `httprouter: param 'word' with value "abc" is not a valid UUID: invalid UUID format`},
+		{"UUID(dash)", func() error { _, err := ps.UUID("dash"); return err },
+			errInvalidUUID, ""},
+	} {
+		err := test.fn()
+		perr, ok := err.(*ParamError)
+		if !ok || perr.Unwrap() != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if test.msg != "" && err.Error() != test.msg {
+			t.Errorf("%s: got message %q, want %q", test.name, err.Error(), test.msg)
+		}
+	}
+
+	ctx := context.WithValue(context.Background(), ParamsKey, &ps)
+	if i, err := GetInt(ctx, "id"); i != 42 || err != nil {
+		t.Errorf("GetInt(id) = %d, %v", i, err)
+	}
+	if i, err := GetInt64(ctx, "neg"); i != -7 || err != nil {
+		t.Errorf("GetInt64(neg) = %d, %v", i, err)
+	}
+	if b, err := GetBool(ctx, "flag"); !b || err != nil {
+		t.Errorf("GetBool(flag) = %v, %v", b, err)
+	}
+	if _, err := GetUUID(ctx, "uuid"); err != nil {
+		t.Errorf("GetUUID(uuid) = %v", err)
+	}
+	if _, err := GetInt(context.Background(), "id"); err == nil {
+		t.Error("GetInt without params did not fail")
+	}
+}
@@ -17,7 +17,12 @@ package httprouter
 //	4. Eliminate .. elements that begin a rooted path:
 //	   that is, replace "/.." by "/" at the beginning of a path.
 //
-// If the result of this process is an empty string, "/" is returned
+// If the result of this process is an empty string, "/" is returned.
+//
+// Unlike path.Clean, a leading slash is added if p does not start with one,
+// and a trailing slash of p is kept, e.g. "a//b/../c/" becomes "/a/c/".
+// CleanPath is the normalization the router applies to request paths before
+// looking them up case-insensitively for RedirectFixedPath.
 func CleanPath(p string) string {
 	// Turn empty string into "/"
 	if p == "" {
@@ -61,6 +61,7 @@ var cleanTests = []struct {
 	{"abc/./../def", "/def"},
 	{"abc//./../def", "/def"},
 	{"abc/../../././../def", "/def"},
+	{"a//b/../c/", "/a/c/"},
 }
 
 func TestPathClean(t *testing.T) {
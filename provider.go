@@ -0,0 +1,111 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// RouteDef describes a route provided by a RouteProvider.
+type RouteDef struct {
+	Method string
+	Path   string
+	Handle http.Handler
+
+	// Name optionally names the route, like Route.Name.
+	Name string
+}
+
+// RouteProvider provides routes to be registered with a router, e.g. the
+// routes of a module of an application.
+type RouteProvider interface {
+	Routes() []RouteDef
+}
+
+var registry struct {
+	sync.Mutex
+	providers []RouteProvider
+}
+
+// RegisterProvider adds a provider to the package registry, whose routes are
+// registered by every router when its Build method is called. It is meant to be
+// called from the init function of the package providing the routes, so an
+// application does not need to list all of them:
+//     func init() {
+//         httprouter.RegisterProvider(blogRoutes{})
+//     }
+func RegisterProvider(p RouteProvider) {
+	registry.Lock()
+	registry.providers = append(registry.providers, p)
+	registry.Unlock()
+}
+
+// Register adds a provider whose routes are registered when Build or Seal is
+// called. Routes are never registered while serving requests.
+func (r *Router) Register(p RouteProvider) {
+	r.lock("")
+	r.providers = append(r.providers, p)
+	r.mu.Unlock()
+}
+
+// Build registers the routes of the providers added with Register, followed by
+// the routes of the providers of the package registry, see RegisterProvider.
+// The routes of each provider are registered once, so Build may be called
+// again after more providers were added.
+//
+// Like Handle, it panics if any of the routes cannot be registered. The
+// message of the *RegistrationError names the type of the provider. Build
+// should be called before serving requests, so such errors are not first
+// raised by a request.
+//
+// The package registry is only consulted by Build. Routers passed to Mount or
+// returned by Host and Scheme do not register its routes unless they are
+// built themselves.
+func (r *Router) Build() {
+	r.build(true)
+}
+
+// build registers the routes of the providers added with Register and, if
+// global is set, those of the providers of the package registry which have not
+// been registered yet.
+func (r *Router) build(global bool) {
+	r.buildMu.Lock()
+	defer r.buildMu.Unlock()
+
+	r.mu.Lock()
+	providers := r.providers
+	r.providers = nil
+	if global {
+		registry.Lock()
+		providers = append(providers, registry.providers[r.registryBuilt:]...)
+		r.registryBuilt = len(registry.providers)
+		registry.Unlock()
+	}
+	r.mu.Unlock()
+
+	for _, p := range providers {
+		r.registerProvider(p)
+	}
+}
+
+func (r *Router) registerProvider(p RouteProvider) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			if err, ok := rcv.(*RegistrationError); ok {
+				err.Message += fmt.Sprintf(" (route of provider %T)", p)
+			}
+			panic(rcv)
+		}
+	}()
+
+	for _, def := range p.Routes() {
+		route := r.Handle(def.Method, def.Path, def.Handle)
+		if def.Name != "" {
+			route.Name(def.Name)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testProvider []RouteDef
+
+func (p testProvider) Routes() []RouteDef { return p }
+
+func TestRouterRegister(t *testing.T) {
+	var routed string
+	handle := func(name string) http.Handler {
+		return http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+			routed = name
+		})
+	}
+
+	router := New()
+	router.Register(testProvider{
+		{Method: http.MethodGet, Path: "/blog/:post", Handle: handle("post"), Name: "post"},
+		{Method: http.MethodGet, Path: "/blog", Handle: handle("index")},
+	})
+
+	// the routes are not registered while serving requests, only by Build
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/blog/hello", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /blog/hello before Build: got %d", w.Code)
+	}
+
+	router.Build()
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || routed != "post" {
+		t.Errorf("GET /blog/hello: got %d routed to %q", w.Code, routed)
+	}
+
+	if u, err := router.URL("post", "hello"); err != nil || u != "/blog/hello" {
+		t.Errorf(`URL("post", "hello") = %q, %v; want "/blog/hello"`, u, err)
+	}
+
+	// providers added later are registered by the next Build
+	router.Register(testProvider{
+		{Method: http.MethodGet, Path: "/about", Handle: handle("about")},
+	})
+	router.Build()
+	router.Build()
+	if h, _, _ := router.Lookup(http.MethodGet, "/about"); h == nil {
+		t.Error("route of the provider added after the first Build is missing")
+	}
+
+	// Seal registers the routes of pending providers, providers cannot be
+	// added afterwards
+	router.Register(testProvider{
+		{Method: http.MethodGet, Path: "/contact", Handle: handle("contact")},
+	})
+	router.Seal()
+	if h, _, _ := router.Lookup(http.MethodGet, "/contact"); h == nil {
+		t.Error("route of the provider added before Seal is missing")
+	}
+	recv := catchPanic(func() {
+		router.Register(testProvider{
+			{Method: http.MethodGet, Path: "/late", Handle: handle("late")},
+		})
+	})
+	if rerr, ok := recv.(*RegistrationError); !ok || rerr.Kind != KindSealed {
+		t.Errorf("Register after Seal: got panic %v", recv)
+	}
+}
+
+func TestRouterBuildRegistry(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	// the package registry outlives the test, so it is restored for the
+	// routers of other tests
+	registry.Lock()
+	saved := registry.providers
+	registry.Unlock()
+	defer func() {
+		registry.Lock()
+		registry.providers = saved
+		registry.Unlock()
+	}()
+
+	RegisterProvider(testProvider{
+		{Method: http.MethodGet, Path: "/registry/test", Handle: handlerFunc},
+	})
+
+	// routers only register the providers of the registry when built, not
+	// when serving requests or sealed, which includes mounted routers
+	unbuilt, sealed, mounted := New(), New(), New()
+	sealed.Seal()
+	parent := New()
+	parent.Mount("/admin", mounted)
+	parent.Build()
+	for _, test := range []struct {
+		router *Router
+		path   string
+	}{
+		{unbuilt, "/registry/test"},
+		{sealed, "/registry/test"},
+		{parent, "/admin/registry/test"},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		test.router.ServeHTTP(w, r)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("GET %s without Build: got %d", test.path, w.Code)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		router := New()
+		if err := router.TryBuild(); err != nil {
+			t.Fatal(err)
+		}
+		if h, _, _ := router.Lookup(http.MethodGet, "/registry/test"); h == nil {
+			t.Errorf("router %d is missing the registry route", i)
+		}
+	}
+}
+
+func TestRouterBuildConflict(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Get("/users/:id", handlerFunc)
+	router.Register(testProvider{
+		{Method: http.MethodGet, Path: "/users/:name", Handle: handlerFunc},
+	})
+
+	err, ok := router.TryBuild().(*RegistrationError)
+	if !ok || err.Kind != KindConflict {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+	if !strings.Contains(err.Message, "httprouter.testProvider") {
+		t.Errorf("error does not name the provider: %s", err.Message)
+	}
+}
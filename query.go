@@ -0,0 +1,212 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"sort"
+)
+
+// Query restricts the handle of the route to requests whose query has the
+// given key with the given value, e.g.
+//
+//	router.Get("/resource", a).Query("type", "a")
+//	router.Get("/resource", b).Query("type", "b")
+//	router.Get("/resource", other)
+//
+// Calling Query repeatedly restricts the handle to requests matching all of
+// the given keys and values.
+//
+// Once the handle of a route is restricted, further handles can be registered
+// with the same method and path, and restricted with Query in turn. Requests
+// are served by the matching handle with the most restrictions, or the one
+// registered first if several match equally. A request matches a restriction
+// if any of the values of the key equals the value, requests without the key
+// never match. At most one handle of a path should be left unrestricted, it
+// serves the requests matching none of the others. If there is none, these
+// requests are answered by the router's NotFound handler.
+func (rt *Route) Query(key, value string) *Route {
+	r := rt.router
+	r.lock(rt.path)
+	defer r.mu.Unlock()
+
+	r.hasQuery = true
+	for _, method := range rt.methods {
+		r.updateHandle(method, rt.path, func(handle http.Handler) http.Handler {
+			cand := rt.candidates[method]
+			qh, ok := handle.(*queryHandler)
+			if !ok {
+				qh = &queryHandler{router: r}
+				cand = qh.add(handle)
+			}
+			if cand != nil {
+				qh.restrict(cand, key, value)
+				if rt.candidates == nil {
+					rt.candidates = make(map[string]*queryCandidate)
+				}
+				rt.candidates[method] = cand
+			}
+			return qh
+		})
+	}
+	return rt
+}
+
+// addQueryCandidate adds the handle of route to the handle restricted with
+// Route.Query which is registered with the same method and path, if there is
+// one, and returns the candidate it was added as.
+func (r *Router) addQueryCandidate(route registration) *queryCandidate {
+	var cand *queryCandidate
+	r.updateHandle(route.method, route.path, func(handle http.Handler) http.Handler {
+		if qh, ok := handle.(*queryHandler); ok && cand == nil {
+			cand = qh.add(route.handle)
+		}
+		return handle
+	})
+	return cand
+}
+
+// updateHandle replaces the handle registered with exactly the given method and
+// path, including routes not yet added by Compile, with the result of fn.
+func (r *Router) updateHandle(method, path string, fn func(handle http.Handler) http.Handler) {
+	for i := range r.pending {
+		if r.pending[i].method == method && r.pending[i].path == path {
+			r.pending[i].handle = fn(r.pending[i].handle)
+			return
+		}
+	}
+
+	root := r.trees[method]
+	if root == nil {
+		return
+	}
+
+	// a path with an optional param was added as two routes sharing the
+	// handle
+	plain, _ := splitConstraints(path)
+	paths := []string{plain}
+	if short, long, name := splitOptional(plain); name != "" {
+		paths = []string{long, short}
+	}
+
+	var handle http.Handler
+	for _, path := range paths {
+		if leaf := root.findLeaf(path); leaf != nil {
+			if handle == nil {
+				handle = fn(leaf.handle)
+			}
+			leaf.handle = handle
+		}
+	}
+}
+
+// cloneQueryHandlers replaces the handles restricted with Route.Query of a
+// router returned by Clone with copies, so they can be restricted
+// independently.
+func (r *Router) cloneQueryHandlers() {
+	clones := make(map[*queryHandler]*queryHandler)
+	clone := func(handle http.Handler) http.Handler {
+		qh, ok := handle.(*queryHandler)
+		if !ok {
+			return handle
+		}
+		if clones[qh] == nil {
+			clones[qh] = qh.clone(r)
+		}
+		return clones[qh]
+	}
+
+	for i := range r.pending {
+		r.pending[i].handle = clone(r.pending[i].handle)
+	}
+	for _, root := range r.trees {
+		root.walk(func(n *node) {
+			n.handle = clone(n.handle)
+		})
+	}
+}
+
+// queryHandler serves the handles registered for a route restricted with
+// Route.Query.
+type queryHandler struct {
+	router *Router
+
+	// candidates are sorted by the number of restrictions, most first, and
+	// the order of registration.
+	candidates []*queryCandidate
+}
+
+// queryCandidate is a handle restricted to the given query values.
+type queryCandidate struct {
+	handle http.Handler
+	query  [][2]string
+	order  int
+}
+
+// add adds an unrestricted handle and returns its candidate.
+func (h *queryHandler) add(handle http.Handler) *queryCandidate {
+	cand := &queryCandidate{handle: handle, order: len(h.candidates)}
+	h.candidates = append(h.candidates, cand)
+	h.sort()
+	return cand
+}
+
+// restrict restricts the handle of the candidate.
+func (h *queryHandler) restrict(cand *queryCandidate, key, value string) {
+	cand.query = append(cand.query, [2]string{key, value})
+	h.sort()
+}
+
+func (h *queryHandler) sort() {
+	sort.SliceStable(h.candidates, func(i, j int) bool {
+		ci, cj := h.candidates[i], h.candidates[j]
+		if len(ci.query) != len(cj.query) {
+			return len(ci.query) > len(cj.query)
+		}
+		return ci.order < cj.order
+	})
+}
+
+// clone returns a copy of h for the given router.
+func (h *queryHandler) clone(r *Router) *queryHandler {
+	c := &queryHandler{router: r}
+	for _, cand := range h.candidates {
+		cc := *cand
+		cc.query = append([][2]string(nil), cand.query...)
+		c.candidates = append(c.candidates, &cc)
+	}
+	return c
+}
+
+func (h *queryHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if handle := h.handle(req); handle != nil {
+		handle.ServeHTTP(w, req)
+		return
+	}
+
+	h.router.serveNotFound(w, req)
+}
+
+// handle returns the handle of the candidate matching the query of req, or nil
+// if there is none. The candidates are only modified by the router while it
+// is locked.
+func (h *queryHandler) handle(req *http.Request) http.Handler {
+	if h.router.rlock() {
+		defer h.router.mu.RUnlock()
+	}
+
+	query := req.URL.Query()
+
+candidates:
+	for _, cand := range h.candidates {
+		for _, kv := range cand.query {
+			if !contains(query[kv[0]], kv[1]) {
+				continue candidates
+			}
+		}
+		return cand.handle
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouteQuery(t *testing.T) {
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + GetValue(r.Context(), "id")))
+		})
+	}
+
+	router := New()
+	router.Get("/resource", handler("a")).Query("type", "a")
+	router.Get("/resource", handler("b")).Query("type", "b")
+	router.Get("/resource", handler("fallback"))
+	router.Get("/resource", handler("a2")).Query("type", "a").Query("v", "2")
+	router.Get("/items/:id?", handler("item")).Query("full", "1")
+	router.Group("/g").Post("/x", handler("g")).Query("q", "")
+
+	// a route restricted again after another handle was added keeps its own
+	// restrictions
+	later := router.Get("/later", handler("a")).Query("type", "a")
+	router.Get("/later", handler("fallback"))
+	later.Query("v", "1")
+
+	for _, test := range []struct {
+		method, url, want string
+	}{
+		{http.MethodGet, "/resource?type=a", "a"},
+		{http.MethodGet, "/resource?type=b", "b"},
+		{http.MethodGet, "/resource?type=c", "fallback"},
+		{http.MethodGet, "/resource", "fallback"},
+		{http.MethodGet, "/resource?type=a&v=2", "a2"},
+		{http.MethodGet, "/resource?v=2", "fallback"},
+		{http.MethodGet, "/resource?type=c&type=b", "b"},
+		{http.MethodGet, "/items/7?full=1", "item7"},
+		{http.MethodGet, "/items?full=1", "item"},
+		{http.MethodGet, "/items/7", ""},
+		{http.MethodPost, "/g/x?q=", "g"},
+		{http.MethodPost, "/g/x", ""},
+		{http.MethodGet, "/later?type=a&v=1", "a"},
+		{http.MethodGet, "/later?type=a", "fallback"},
+		{http.MethodGet, "/later?v=1", "fallback"},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(test.method, test.url, nil)
+		router.ServeHTTP(w, r)
+		if test.want == "" {
+			if w.Code != http.StatusNotFound {
+				t.Errorf("%s %s: got %d %q, want 404", test.method, test.url, w.Code, w.Body.String())
+			}
+		} else if w.Body.String() != test.want {
+			t.Errorf("%s %s: served by %q, want %q", test.method, test.url, w.Body.String(), test.want)
+		}
+	}
+
+	// registering a handle for a path without restrictions still conflicts
+	router.Get("/plain", handler("plain"))
+	recv := catchPanic(func() {
+		router.Get("/plain", handler("other"))
+	})
+	if rerr, ok := recv.(*RegistrationError); !ok || rerr.Kind != KindConflict {
+		t.Errorf("duplicate unrestricted route: got panic %v", recv)
+	}
+
+	// the restrictions of a clone are independent
+	clone := router.Clone()
+	clone.Get("/resource", handler("c")).Query("type", "c")
+	for _, test := range []struct {
+		router *Router
+		want   string
+	}{
+		{router, "fallback"},
+		{clone, "c"},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, "/resource?type=c", nil)
+		test.router.ServeHTTP(w, r)
+		if w.Body.String() != test.want {
+			t.Errorf("GET /resource?type=c: served by %q, want %q", w.Body.String(), test.want)
+		}
+	}
+}
+
+func TestRouteQueryDeferred(t *testing.T) {
+	router := New()
+	router.DeferRegistration = true
+	router.Get("/r", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("a"))
+	})).Query("type", "a")
+	router.Get("/r", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("other"))
+	}))
+	router.Compile()
+
+	for url, want := range map[string]string{"/r?type=a": "a", "/r": "other"} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, url, nil)
+		router.ServeHTTP(w, r)
+		if w.Body.String() != want {
+			t.Errorf("GET %s: served by %q, want %q", url, w.Body.String(), want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HandleRateLimit registers a new request handle with the given path and
+// method, like Handle, that is limited to rps requests per second with bursts
+// of up to burst requests. Requests exceeding the limit are answered with
+// 429 Too Many Requests and a Retry-After header.
+//
+// The limit applies to all requests for the route, regardless of the client.
+func (r *Router) HandleRateLimit(method, path string, handle http.Handler, rps float64, burst int) {
+	if rps <= 0 || burst < 1 {
+		panic(registrationError(KindInvalidOption, path,
+			"rate limit must be positive in path '"+path+"'"))
+	}
+
+	r.Handle(method, path, &rateLimitHandler{
+		Handler: handle,
+
+		rate:   rps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	})
+}
+
+// rateLimitHandler implements a token bucket in front of a http.Handler.
+type rateLimitHandler struct {
+	http.Handler
+
+	mu     sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64 // bucket size
+	tokens float64
+	last   time.Time
+}
+
+// take removes a token from the bucket. If the bucket is empty it returns
+// false and the time until a token will be available.
+func (h *rateLimitHandler) take(now time.Time) (bool, time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.tokens = math.Min(h.burst, h.tokens+now.Sub(h.last).Seconds()*h.rate)
+	h.last = now
+
+	if h.tokens < 1 {
+		return false, time.Duration((1 - h.tokens) / h.rate * float64(time.Second))
+	}
+
+	h.tokens--
+	return true, 0
+}
+
+func (h *rateLimitHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if ok, wait := h.take(time.Now()); !ok {
+		secs := int64(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+		http.Error(w,
+			http.StatusText(http.StatusTooManyRequests),
+			http.StatusTooManyRequests,
+		)
+		return
+	}
+
+	h.Handler.ServeHTTP(w, req)
+}
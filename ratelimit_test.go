@@ -0,0 +1,65 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouterHandleRateLimit(t *testing.T) {
+	var routed int
+	router := New()
+	router.HandleRateLimit(http.MethodGet, "/limited", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routed++
+	}), 0.5, 2)
+
+	for i := 0; i < 2; i++ {
+		r, _ := http.NewRequest(http.MethodGet, "/limited", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("request within burst was limited: Code=%d", w.Code)
+		}
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/limited", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("request exceeding burst was not limited: Code=%d", w.Code)
+	}
+	if retry := w.Header().Get("Retry-After"); retry != "2" {
+		t.Errorf("unexpected Retry-After header value: %s", retry)
+	}
+
+	if routed != 2 {
+		t.Errorf("handler called %d times, want 2", routed)
+	}
+
+	recv := catchPanic(func() {
+		router.HandleRateLimit(http.MethodGet, "/invalid", nil, 0, 1)
+	})
+	if recv == nil {
+		t.Error("registering non-positive rate limit did not panic")
+	}
+}
+
+func TestRateLimitHandlerRefill(t *testing.T) {
+	now := time.Now()
+	h := &rateLimitHandler{rate: 10, burst: 1, tokens: 1, last: now}
+
+	if ok, _ := h.take(now); !ok {
+		t.Fatal("token not available")
+	}
+	if ok, wait := h.take(now); ok || wait != 100*time.Millisecond {
+		t.Fatalf("unexpected take result: %t, %v", ok, wait)
+	}
+	if ok, _ := h.take(now.Add(100 * time.Millisecond)); !ok {
+		t.Fatal("token not refilled")
+	}
+}
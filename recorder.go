@@ -0,0 +1,234 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// StatusRecorder is a http.ResponseWriter which records the status code and
+// the number of bytes written to the wrapped http.ResponseWriter. It is meant
+// for middleware, e.g. for logging or metrics, which needs to know how a
+// request was answered.
+//
+// The zero value is not usable, ResponseWriter must be set. The
+// http.ResponseWriter returned by Writer should be passed on, as it implements
+// the optional interfaces of the wrapped one:
+//
+//	rec := &httprouter.StatusRecorder{ResponseWriter: w}
+//	next.ServeHTTP(rec.Writer(), req)
+//	log.Println(req.URL, rec.Status(), rec.Written())
+type StatusRecorder struct {
+	http.ResponseWriter
+
+	status  int
+	written int64
+
+	// onPattern receives the pattern of the matched route if it is set.
+	onPattern func(pattern string)
+}
+
+// Writer returns a http.ResponseWriter recording to w which implements
+// http.Flusher, http.Hijacker, http.Pusher and io.ReaderFrom if, and only if,
+// the wrapped http.ResponseWriter implements them, so type assertions for them
+// have the same result as for the wrapped http.ResponseWriter.
+func (w *StatusRecorder) Writer() http.ResponseWriter {
+	var i int
+	if _, ok := w.ResponseWriter.(http.Flusher); ok {
+		i |= 1
+	}
+	if _, ok := w.ResponseWriter.(http.Hijacker); ok {
+		i |= 2
+	}
+	if _, ok := w.ResponseWriter.(http.Pusher); ok {
+		i |= 4
+	}
+	if _, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		i |= 8
+	}
+
+	f, h, p, rf := recorderFlusher{w}, recorderHijacker{w}, recorderPusher{w}, recorderReaderFrom{w}
+	switch i {
+	case 1:
+		return struct {
+			*StatusRecorder
+			http.Flusher
+		}{w, f}
+	case 2:
+		return struct {
+			*StatusRecorder
+			http.Hijacker
+		}{w, h}
+	case 3:
+		return struct {
+			*StatusRecorder
+			http.Flusher
+			http.Hijacker
+		}{w, f, h}
+	case 4:
+		return struct {
+			*StatusRecorder
+			http.Pusher
+		}{w, p}
+	case 5:
+		return struct {
+			*StatusRecorder
+			http.Flusher
+			http.Pusher
+		}{w, f, p}
+	case 6:
+		return struct {
+			*StatusRecorder
+			http.Hijacker
+			http.Pusher
+		}{w, h, p}
+	case 7:
+		return struct {
+			*StatusRecorder
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{w, f, h, p}
+	case 8:
+		return struct {
+			*StatusRecorder
+			io.ReaderFrom
+		}{w, rf}
+	case 9:
+		return struct {
+			*StatusRecorder
+			http.Flusher
+			io.ReaderFrom
+		}{w, f, rf}
+	case 10:
+		return struct {
+			*StatusRecorder
+			http.Hijacker
+			io.ReaderFrom
+		}{w, h, rf}
+	case 11:
+		return struct {
+			*StatusRecorder
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{w, f, h, rf}
+	case 12:
+		return struct {
+			*StatusRecorder
+			http.Pusher
+			io.ReaderFrom
+		}{w, p, rf}
+	case 13:
+		return struct {
+			*StatusRecorder
+			http.Flusher
+			http.Pusher
+			io.ReaderFrom
+		}{w, f, p, rf}
+	case 14:
+		return struct {
+			*StatusRecorder
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{w, h, p, rf}
+	case 15:
+		return struct {
+			*StatusRecorder
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{w, f, h, p, rf}
+	}
+	return w
+}
+
+// Status returns the status code of the response. It is http.StatusOK if the
+// response was written without an explicit call to WriteHeader, and 0 if
+// nothing has been written yet.
+func (w *StatusRecorder) Status() int {
+	return w.status
+}
+
+// Written returns the number of bytes of the response body that have been
+// written.
+func (w *StatusRecorder) Written() int64 {
+	return w.written
+}
+
+// Unwrap returns the wrapped http.ResponseWriter.
+func (w *StatusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// WriteHeader implements http.ResponseWriter. Only the first status code is
+// recorded, as that is the one sent to the client.
+func (w *StatusRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements http.ResponseWriter.
+func (w *StatusRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// recordPattern passes the pattern of the matched route on, so a
+// StatusRecorder between NewMetricsHandler and the router does not hide it.
+func (w *StatusRecorder) recordPattern(pattern string) {
+	if w.onPattern != nil {
+		w.onPattern(pattern)
+	} else if pr, ok := w.ResponseWriter.(patternRecorder); ok {
+		pr.recordPattern(pattern)
+	}
+}
+
+// recorderFlusher implements http.Flusher for StatusRecorder.Writer.
+type recorderFlusher struct{ w *StatusRecorder }
+
+func (f recorderFlusher) Flush() {
+	if f.w.status == 0 {
+		f.w.status = http.StatusOK
+	}
+	f.w.ResponseWriter.(http.Flusher).Flush()
+}
+
+// recorderHijacker implements http.Hijacker for StatusRecorder.Writer.
+type recorderHijacker struct{ w *StatusRecorder }
+
+func (h recorderHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// recorderPusher implements http.Pusher for StatusRecorder.Writer.
+type recorderPusher struct{ w *StatusRecorder }
+
+func (p recorderPusher) Push(target string, opts *http.PushOptions) error {
+	return p.w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// recorderReaderFrom implements io.ReaderFrom for StatusRecorder.Writer.
+type recorderReaderFrom struct{ w *StatusRecorder }
+
+func (rf recorderReaderFrom) ReadFrom(r io.Reader) (int64, error) {
+	if rf.w.status == 0 {
+		rf.w.status = http.StatusOK
+	}
+	n, err := rf.w.ResponseWriter.(io.ReaderFrom).ReadFrom(r)
+	rf.w.written += n
+	return n, err
+}
@@ -0,0 +1,141 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type pushResponseWriter struct {
+	mockResponseWriter
+	target string
+}
+
+func (w *pushResponseWriter) Push(target string, opts *http.PushOptions) error {
+	w.target = target
+	return nil
+}
+
+type readerFromResponseWriter struct {
+	mockResponseWriter
+	readFrom bool
+}
+
+func (w *readerFromResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.readFrom = true
+	return io.Copy(ioutil.Discard, r)
+}
+
+func TestStatusRecorder(t *testing.T) {
+	rec := &StatusRecorder{ResponseWriter: httptest.NewRecorder()}
+	if rec.Status() != 0 {
+		t.Errorf("Status before writing: got %d, want 0", rec.Status())
+	}
+	rec.Write([]byte("hello"))
+	rec.WriteHeader(http.StatusNotFound)
+	if rec.Status() != http.StatusOK {
+		t.Errorf("Status after Write: got %d, want %d", rec.Status(), http.StatusOK)
+	}
+	if rec.Written() != 5 {
+		t.Errorf("Written: got %d, want 5", rec.Written())
+	}
+
+	w := httptest.NewRecorder()
+	rec = &StatusRecorder{ResponseWriter: w}
+	rec.WriteHeader(http.StatusTeapot)
+	rec.WriteHeader(http.StatusOK)
+	io.WriteString(rec, "short and stout")
+	if rec.Status() != http.StatusTeapot {
+		t.Errorf("Status: got %d, want %d", rec.Status(), http.StatusTeapot)
+	}
+	if rec.Written() != 15 || w.Body.String() != "short and stout" {
+		t.Errorf("Written: got %d (%q), want 15", rec.Written(), w.Body.String())
+	}
+	if rec.Unwrap() != w {
+		t.Error("Unwrap did not return the wrapped http.ResponseWriter")
+	}
+}
+
+func TestStatusRecorderPassThrough(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := &StatusRecorder{ResponseWriter: w}
+	rw := rec.Writer()
+	rw.(http.Flusher).Flush()
+	if !w.Flushed {
+		t.Error("Flush was not passed through")
+	}
+	if rec.Status() != http.StatusOK {
+		t.Errorf("Status after Flush: got %d, want %d", rec.Status(), http.StatusOK)
+	}
+	if _, ok := rw.(interface{ Unwrap() http.ResponseWriter }); !ok {
+		t.Error("Writer does not implement Unwrap")
+	}
+
+	// the Writer implements only the optional interfaces of the wrapped one
+	rec = &StatusRecorder{ResponseWriter: new(mockResponseWriter)}
+	rw = rec.Writer()
+	if _, ok := rw.(http.Flusher); ok {
+		t.Error("Writer of a http.ResponseWriter without support implements http.Flusher")
+	}
+	if _, ok := rw.(http.Hijacker); ok {
+		t.Error("Writer of a http.ResponseWriter without support implements http.Hijacker")
+	}
+	if _, ok := rw.(http.Pusher); ok {
+		t.Error("Writer of a http.ResponseWriter without support implements http.Pusher")
+	}
+	if _, ok := rw.(io.ReaderFrom); ok {
+		t.Error("Writer of a http.ResponseWriter without support implements io.ReaderFrom")
+	}
+	if n, err := io.Copy(rw, strings.NewReader("copied")); n != 6 || err != nil {
+		t.Errorf("copy to a http.ResponseWriter without support: got %d, %v", n, err)
+	}
+	if rec.Written() != 6 {
+		t.Errorf("Written after copy: got %d, want 6", rec.Written())
+	}
+
+	hw := new(hijackResponseWriter)
+	rec = &StatusRecorder{ResponseWriter: hw}
+	rw = rec.Writer()
+	if _, ok := rw.(http.Pusher); ok {
+		t.Error("Writer of a http.Hijacker implements http.Pusher")
+	}
+	if hj, ok := rw.(http.Hijacker); !ok {
+		t.Error("Writer of a http.Hijacker does not implement it")
+	} else if _, _, err := hj.Hijack(); err != nil || !hw.hijacked {
+		t.Errorf("Hijack was not passed through: %v", err)
+	}
+
+	pw := new(pushResponseWriter)
+	rec = &StatusRecorder{ResponseWriter: pw}
+	rw = rec.Writer()
+	if _, ok := rw.(http.Hijacker); ok {
+		t.Error("Writer of a http.Pusher implements http.Hijacker")
+	}
+	if p, ok := rw.(http.Pusher); !ok {
+		t.Error("Writer of a http.Pusher does not implement it")
+	} else if err := p.Push("/style.css", nil); err != nil || pw.target != "/style.css" {
+		t.Errorf("Push was not passed through: %v", err)
+	}
+
+	rfw := new(readerFromResponseWriter)
+	rec = &StatusRecorder{ResponseWriter: rfw}
+	rw = rec.Writer()
+	if _, ok := rw.(http.Flusher); ok {
+		t.Error("Writer of a io.ReaderFrom implements http.Flusher")
+	}
+	if rf, ok := rw.(io.ReaderFrom); !ok {
+		t.Error("Writer of a io.ReaderFrom does not implement it")
+	} else if n, err := rf.ReadFrom(strings.NewReader("copied")); n != 6 || err != nil || !rfw.readFrom {
+		t.Errorf("ReadFrom was not passed through: %d, %v", n, err)
+	}
+	if rec.Written() != 6 || rec.Status() != http.StatusOK {
+		t.Errorf("after ReadFrom: got written %d, status %d", rec.Written(), rec.Status())
+	}
+}
@@ -54,6 +54,39 @@
 //   /blog/go/                           no match
 //   /blog/go/request-routers/comments   no match
 //
+// A named parameter can be followed by a dot and a second named parameter, the
+// extension, in the same path segment. The segment is then split at its last
+// dot:
+//  Path: /files/:name.:ext
+//
+//  Requests:
+//   /files/report.json                  match: name="report", ext="json"
+//   /files/report.tar.gz                match: name="report.tar", ext="gz"
+//   /files/report                       no match
+//
+// A named parameter which is the last path segment can be made optional with a
+// trailing '?'. The path then also matches without the segment, with the value
+// of the parameter set to the empty string:
+//  Path: /items/:id?
+//
+//  Requests:
+//   /items/42                           match: id="42"
+//   /items                              match: id=""
+//   /items/                             no match, but the router would redirect
+//
+// A named parameter can be constrained with a regular expression in
+// parentheses after its name. The expression must match the whole value,
+// otherwise the path does not match:
+//  Path: /users/:id(\d+)
+//
+//  Requests:
+//   /users/42                           match: id="42"
+//   /users/gopher                       no match
+//
+// Routes sharing a parameter, e.g. /users/:id and /users/:id/edit, must all
+// declare the same constraint for it, or none. Registering a route otherwise
+// panics.
+//
 // Catch-all parameters match anything until the path end, including the
 // directory index (the '/' before the catch-all). Since they match anything
 // until the end, catch-all parameters must always be the final path element.
@@ -65,6 +98,14 @@
 //   /files/templates/article.html       match: filepath="/templates/article.html"
 //   /files                              no match, but the router would redirect
 //
+// A backslash before ':' or '*' escapes it, the path then contains the literal
+// character instead of a parameter:
+//  Path: /ratio/\:1
+//
+//  Requests:
+//   /ratio/:1                           match
+//   /ratio/1                            no match
+//
 // The value of parameters is saved as a slice of the Param struct, consisting
 // each of a key and a value. The slice is accessable with the GetParams method.
 //
@@ -79,19 +120,21 @@ package httprouter
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
-)
-
-// contextKey is a value for use with context.WithValue. It's used as
-// a pointer so it fits in an interface{} without allocation.
-type contextKey struct{ name string }
-
-func (k *contextKey) String() string { return "httprouter context value " + k.name }
-
-var (
-	paramKey = &contextKey{"param"}
-	panicKey = &contextKey{"panic"}
+	"net/url"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // Param is a single URL parameter, consisting of a key and a value.
@@ -116,40 +159,15 @@ func (ps Params) ByName(name string) string {
 	return ""
 }
 
-// GetParams returns the Param-slice associated with a context.Context
-// if there is one, otherwise it returns nil.
-func GetParams(ctx context.Context) Params {
-	if ps := ctx.Value(paramKey); ps != nil {
-		return *ps.(*Params)
-	}
-	return nil
-}
-
-// GetValue is short-hand for GetParams(ctx).ByName(name).
-func GetValue(ctx context.Context, name string) string {
-	return GetParams(ctx).ByName(name)
-}
-
-type paramsContext struct {
-	context.Context
-	ps Params
-}
-
-func (c *paramsContext) String() string {
-	return fmt.Sprintf("%v.WithValue(%#v, %#v)", c.Context, paramKey, &c.ps)
-}
-
-func (c *paramsContext) Value(key interface{}) interface{} {
-	if key == paramKey {
-		return &c.ps
+// Has reports whether a Param with the given name exists, even if its value is
+// empty.
+func (ps Params) Has(name string) bool {
+	for i := range ps {
+		if ps[i].Key == name {
+			return true
+		}
 	}
-	return c.Context.Value(key)
-}
-
-// GetPanic returns the recovered panic value associated with a
-// context.Context.
-func GetPanic(ctx context.Context) interface{} {
-	return ctx.Value(panicKey)
+	return false
 }
 
 // PathHandler wraps a http.Handler and replaces the request URLs path with
@@ -175,9 +193,74 @@ func (h *pathHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 // Router is a http.Handler which can be used to dispatch requests to different
 // handler functions via configurable routes
+//
+// Routes may be registered concurrently, also while the router is serving
+// requests, until the router is sealed with Seal. Registration and routing are
+// serialized by a lock, which sealed routers no longer take. The options of
+// the router must not be changed while it is serving requests.
 type Router struct {
 	trees map[string]*node
 
+	schemes map[string]*Router
+
+	hosts map[string]*Router
+
+	pending []registration
+
+	names     map[string]*namedRoute
+	pathNames map[string]string
+
+	// notAllowed holds the MethodNotAllowed handlers of single paths,
+	// regardless of the method.
+	notAllowed *node
+
+	middleware []func(http.Handler) http.Handler
+
+	// barePrefixRedirects maps a method and catch-all path, separated by a
+	// space, to the target set with RedirectBarePrefix.
+	barePrefixRedirects map[string]string
+
+	// operations maps a method and plain path, separated by a space, to the
+	// metadata set with HandleOp.
+	operations map[string]OperationMeta
+
+	// paramsPool holds the params buffers used if PoolParams is enabled,
+	// maxParams is the capacity they need.
+	paramsPool sync.Pool
+	maxParams  uint8
+
+	// hasAny is set once a route is registered with Any, whose handles other
+	// routes may replace.
+	hasAny bool
+
+	// hasQuery is set once a route is restricted with Route.Query, whose
+	// handles other routes may be added to.
+	hasQuery bool
+
+	// providers holds the providers added by Register until Build or Seal
+	// registers their routes. registryBuilt is the number of providers of
+	// the package registry whose routes have been registered.
+	providers     []RouteProvider
+	registryBuilt int
+	buildMu       sync.Mutex
+
+	// mu guards the routes against concurrent registration until the router
+	// is sealed, registration takes it for writing and routing for reading.
+	mu     sync.RWMutex
+	sealed uint32 // accessed atomically
+
+	// If enabled, Handle only records new routes and the trees are built once
+	// all routes are known by calling Compile. The resulting trees do not
+	// depend on the order in which routes were registered.
+	// Routes are not served until Compile is called.
+	DeferRegistration bool
+
+	// If positive, registering more than MaxRoutesPerMethod routes for a
+	// single method panics with a KindTooManyRoutes *RegistrationError, or
+	// returns it from TryHandle. A path with an optional param counts as two
+	// routes. Routes removed with Remove no longer count.
+	MaxRoutesPerMethod int
+
 	// Enables automatic redirection if the current route can't be matched but a
 	// handler for the path with (without) the trailing slash exists.
 	// For example if /foo/ is requested but a route only exists for /foo, the
@@ -196,6 +279,66 @@ type Router struct {
 	// RedirectTrailingSlash is independent of this option.
 	RedirectFixedPath bool
 
+	// If enabled, percent-encodings in the targets of redirects caused by
+	// RedirectTrailingSlash or RedirectFixedPath use uppercase hexadecimal
+	// digits, as recommended by RFC 3986, e.g. ?q=%2f becomes ?q=%2F. This
+	// keeps the URLs consistent for caches. The path is always encoded with
+	// uppercase digits, this affects the query which is otherwise kept as
+	// requested.
+	NormalizeRedirectEscapes bool
+
+	// Maps request methods to the status code used for redirects caused by
+	// RedirectTrailingSlash or RedirectFixedPath, e.g. PUT to 308.
+	// Methods without an entry are redirected with 301 for GET requests and
+	// 307 for all other request methods.
+	RedirectCodes map[string]int
+
+	// If enabled, trailing slash redirects of requests with methods other
+	// than GET use 308 Permanent Redirect instead of 307 Temporary Redirect.
+	// Both preserve the method and body of the request, unlike 301 and 302
+	// which browsers follow with a GET request, but some older browsers drop
+	// the body when following a 307 redirect. As 308 is permanent, clients
+	// may also remember the corrected path. Entries in RedirectCodes take
+	// precedence.
+	PermanentTrailingSlashRedirect bool
+
+	// If enabled, redirects of GET requests caused by RedirectTrailingSlash
+	// or RedirectFixedPath use 308 Permanent Redirect instead of 301 Moved
+	// Permanently, so the client is not allowed to change the method.
+	// Entries in RedirectCodes take precedence.
+	UsePermanentRedirect bool
+
+	// The status codes used for redirects caused by RedirectTrailingSlash
+	// and RedirectFixedPath respectively, regardless of the request method.
+	// Codes outside of the 3xx range, including the zero value, are ignored
+	// and the code is derived from the request method as described above.
+	// Entries in RedirectCodes take precedence.
+	RedirectTrailingSlashCode int
+	RedirectFixedPathCode     int
+
+	// If enabled, the static parts of the request path are matched against
+	// the registered paths ignoring case, e.g. /USERS/Gopher is served by
+	// /users/:name directly, without the redirect of RedirectFixedPath. The
+	// param values keep the case of the request path, e.g. "Gopher". Paths
+	// matching a route exactly take priority.
+	// Case-insensitive matching is only attempted if no route matches
+	// exactly, so it does not slow down requests for the registered paths.
+	// It is disabled if Strict is enabled.
+	CaseInsensitive bool
+
+	// If enabled, only requests for exactly the registered paths are
+	// matched. All automatic corrections of the request path are disabled,
+	// regardless of RedirectTrailingSlash and RedirectFixedPath. So are
+	// CaseInsensitive, FormatSuffixes and VersionPrefix, which match paths
+	// other than the registered ones.
+	Strict bool
+
+	// If enabled, requests with a path containing control characters
+	// (0x00-0x1F) are rejected with http status code 400 before routing.
+	// The decoded path is checked, so e.g. %00 is rejected as well, even if
+	// UseRawPath is enabled.
+	RejectControlChars bool
+
 	// If enabled, the router checks if another method is allowed for the
 	// current route, if the current request can not be routed.
 	// If this is the case, the request is answered with 'Method Not Allowed'
@@ -205,26 +348,237 @@ type Router struct {
 	HandleMethodNotAllowed bool
 
 	// If enabled, the router automatically replies to OPTIONS requests.
-	// Custom OPTIONS handlers take priority over automatic replies.
+	// Custom OPTIONS handlers take priority over automatic replies. The
+	// "Allow" header is set before they are called, so they can read or
+	// modify it, and the allowed methods are accessible with GetAllow.
+	// If disabled, OPTIONS is handled exactly like any other method.
 	HandleOptions bool
 
+	// If enabled, the middleware added with Use also wraps the responses to
+	// requests not matching any route: the NotFound and MethodNotAllowed
+	// handlers, including those registered with MethodNotAllowedFor, the
+	// automatic OPTIONS and 400 responses and their defaults.
+	// Unlike for routes, all middleware added with Use applies, regardless of
+	// when it was added. Redirects are not wrapped.
+	UseForUnmatched bool
+
+	// Function to filter the methods listed in the "Allow" header of automatic
+	// OPTIONS replies. Only methods for which it returns true are listed.
+	// This can be used to avoid exposing internal methods to CORS preflight
+	// requests. If it is not set, all registered methods are listed.
+	OptionsMethodFilter func(method string) bool
+
+	// Status code used for automatic replies to OPTIONS requests, e.g.
+	// http.StatusNoContent to make clear the reply has no body.
+	// If it is not set, http.StatusOK is used.
+	OptionsStatus int
+
+	// If set, the router answers CORS preflight requests, i.e. OPTIONS
+	// requests with an Origin and an Access-Control-Request-Method header,
+	// with 204 No Content and the Access-Control-Allow-* headers for the
+	// methods registered for the path, regardless of HandleOptions and
+	// custom OPTIONS handlers. Preflight requests for paths without any
+	// route are handled like other OPTIONS requests.
+	CORS *CORSConfig
+
+	// If enabled, the router counts how often each route is matched. The
+	// counts can be retrieved with MatchCounts.
+	// Counters are updated atomically and never serialize requests. Every
+	// node of the trees carries an 8 byte counter, whether or not counting
+	// is enabled.
+	CountMatches bool
+
 	// Configurable http.Handler which is called when no matching route is
 	// found. If it is not set, http.NotFound is used.
 	NotFound http.Handler
 
+	// If enabled, the request path is passed to the NotFound handler as the
+	// "path" param. This mirrors the value a "/*path" catch-all route would
+	// receive, so unmatched requests can be handled like catch-all routes.
+	NotFoundPathParam bool
+
+	// Function which is called right before the NotFound handler (or
+	// http.NotFound) handles a request for which no matching route was found.
+	// It is meant for observation only, e.g. to count requests for missing
+	// routes, and cannot write a response.
+	OnNotFound func(req *http.Request)
+
+	// Configurable http.Handler which is called instead of the NotFound
+	// handler when RedirectTrailingSlash is disabled, but a handle exists
+	// with an extra (without the) trailing slash for the request path.
+	// The path of that handle is accessible with GetCanonicalPath, so the
+	// handler can e.g. explain the mismatch or serve the handle itself.
+	SlashMismatchHandler http.Handler
+
+	// Configurable http.Handler which is called instead of http.Redirect
+	// when a request is redirected because of RedirectTrailingSlash or
+	// RedirectFixedPath, e.g. to log the redirect, add headers or rewrite
+	// the target for load-balanced setups. The request path and the
+	// redirect target are accessible with GetRedirect.
+	RedirectHandler http.Handler
+
 	// Configurable http.Handler which is called when a request
 	// cannot be routed and HandleMethodNotAllowed is true.
+	// Handlers registered for the path with MethodNotAllowedFor take
+	// precedence.
 	// If it is not set, http.Error with http.StatusMethodNotAllowed is used.
 	// The "Allow" header with allowed request methods is set before the handler
 	// is called.
 	MethodNotAllowed http.Handler
 
+	// Function to transform the path parameters of a matched route before
+	// they are passed to the handler. It may modify and return the given
+	// slice, which is nil for routes without parameters.
+	TransformParams func(ps Params) Params
+
+	// If enabled, the values of params are percent-decoded with
+	// url.PathUnescape before they are passed to TransformParams and the
+	// handler, e.g. a%20b becomes "a b". Values which are not valid
+	// percent-encodings are kept as they are, unless StrictUnescapeParams is
+	// enabled, in which case the request is answered by NotFound.
+	//
+	// Routes are matched against URL.Path, which net/http has already
+	// decoded, so its params only contain escapes if the path was encoded
+	// twice, e.g. a%2520b, or URL.Path was set from the still encoded
+	// URL.RawPath by a handler earlier in the chain. The escaped slash %2F is
+	// decoded to '/' in URL.Path and cannot be told apart from a literal '/'.
+	UnescapeParams       bool
+	StrictUnescapeParams bool
+
+	// If enabled, routes are matched against the escaped path of the request
+	// as returned by URL.EscapedPath, which is URL.RawPath if it is set,
+	// instead of the decoded URL.Path. Params then hold the escaped values,
+	// e.g. a catch-all param keeps an escaped slash %2F apart from '/', and
+	// can be decoded selectively with url.PathUnescape, or all at once with
+	// UnescapeParams. Static parts of registered paths must be registered in
+	// their escaped form to match.
+	// The paths RedirectFixedPath redirects to are also cleaned and corrected
+	// in their escaped form, so escaped dots and slashes are not treated as
+	// path elements by CleanPath.
+	UseRawPath bool
+
+	// Function called synchronously right after a route was matched, with
+	// the request context, the registered path of the route and its params.
+	// The returned context is passed to the handler, returning ctx unchanged
+	// leaves the request as it is.
+	OnMatch func(ctx context.Context, pattern string, ps Params) context.Context
+
+	// If enabled, the registered path of a matched route without params is
+	// not stored in the request context, so GetMatchedPattern returns an
+	// empty string for these routes. Requests for them are then served
+	// without any allocation by the router, storing the path costs two.
+	SkipStaticPattern bool
+
+	// If set, the registered path of a matched route is written to the
+	// response header of this name, e.g. "X-Route-Pattern", before the
+	// handler is called. Middleware wrapping the router, e.g. for access
+	// logs, can read it after the request was served to log the route
+	// instead of the request path.
+	// Middleware which must not expose the header to clients can remove it
+	// when the response is written, or record the pattern with OnMatch
+	// instead.
+	PatternHeader string
+
+	// If enabled, a leading version segment of the request path, e.g. /v2 in
+	// /v2/users/42, is matched like a param named "apiVersion". Routes
+	// registered with the version segment, e.g. /v2/users/:id, take
+	// priority, otherwise the segment is stripped and the rest of the path is
+	// matched against the routes without one, e.g. /users/:id. Either way the
+	// segment without the slash, e.g. "v2", is accessible with
+	// GetValue(ctx, VersionParam).
+	// A version segment is a "v" followed by one or more digits.
+	// It is disabled if Strict is enabled.
+	VersionPrefix bool
+
+	// Format suffixes, e.g. ".json" and ".xml", which are accepted at the
+	// end of the request path of every route. The suffix is stripped and the
+	// rest of the path is matched against the routes, e.g. /users/42.json is
+	// matched by /users/:id. The format without the dot, e.g. "json", is
+	// accessible with GetValue(ctx, FormatParam). If the rest of the path
+	// does not match any route, the full path is matched instead.
+	// They are ignored if Strict is enabled.
+	FormatSuffixes []string
+
+	// If enabled, the params of matched requests are stored in buffers which
+	// are reused once the handle returns, avoiding an allocation per request.
+	// Handles must then not retain the params, or the request context they
+	// are stored in, after returning, e.g. by accessing them from another
+	// goroutine. The same applies to OnMatch and TransformParams.
+	PoolParams bool
+
+	// If enabled, requests matching a route with a path other than its
+	// canonical path get a Link header pointing to the canonical path. The
+	// canonical path is the registered path with the params substituted,
+	// after they were modified by TransformParams.
+	EmitCanonicalLink bool
+
+	// If enabled, the X-Forwarded-Proto header is used to determine the
+	// scheme of requests served by routers registered with Scheme. Only
+	// enable this behind a proxy that sets or strips the header.
+	TrustForwardedProto bool
+
+	// Configurable http.Handler which is called for requests whose host
+	// matches none of the routers registered with Host, if there is no
+	// wildcard "*" router. If it is not set, these requests are served by
+	// the routes registered with the router itself.
+	UnknownHost http.Handler
+
+	// Functions called in order before the router redirects a request because
+	// of RedirectTrailingSlash or RedirectFixedPath. They receive the request
+	// and the redirect target. If any of them returns false, the redirect is
+	// cancelled and the request is handled as if no redirect was possible.
+	RedirectInterceptors []func(req *http.Request, target string) bool
+
+	// Maps request methods to the method whose routes are used if no route
+	// is registered for the request method and path, e.g. HEAD to GET.
+	// Routes registered for the request method always take priority.
+	// The method of the route used is available from GetEffectiveMethod.
+	MethodFallback map[string]string
+
+	// If enabled, HEAD requests for which no HEAD route is registered are
+	// served by the matching GET route, if any, and the body written by its
+	// handle is discarded. Registered HEAD routes and entries for HEAD in
+	// MethodFallback take priority. HEAD is then listed in the "Allow"
+	// header of every path with a GET route.
+	HandleHEADForGET bool
+
+	// Logger receives diagnostics about registered routes, e.g. when a
+	// catch-all route is registered above static routes of its method,
+	// which is reported before the conflict panics, or hides routes of its
+	// MethodFallback method for requests with its own method. If it is nil,
+	// nothing is reported.
+	Logger *log.Logger
+
+	// Status code used to answer requests for routes disabled with Disable.
+	// If it is not set, http.StatusServiceUnavailable is used.
+	DisabledStatus int
+
+	// Response body used to answer requests for routes disabled with Disable.
+	// If it is not set, the status text of DisabledStatus is used.
+	DisabledBody string
+
 	// Function to handle panics recovered from http handlers.
 	// It should be used to generate a error page and return the http error code
 	// 500 (Internal Server Error).
 	// The handler can be used to keep your server from crashing because of
 	// unrecovered panics.
+	// The recovered value and the stack trace of the panic are accessible
+	// with GetPanic and GetPanicStack.
 	PanicHandler http.Handler
+
+	// Function to render the response to requests whose handler panicked,
+	// if no PanicHandler is set. It receives the recovered value, the stack
+	// trace is accessible with GetPanicStack. Setting it also keeps your
+	// server from crashing because of unrecovered panics.
+	PanicResponse func(w http.ResponseWriter, req *http.Request, recovered interface{})
+
+	// If enabled and neither PanicHandler nor PanicResponse is set, panics
+	// recovered from http handlers are logged with their stack trace to
+	// Logger, or the standard logger if it is nil, and answered with 500
+	// Internal Server Error. Panics with http.ErrAbortHandler are not
+	// logged and abort the response as usual.
+	// If disabled, panics propagate to the caller of ServeHTTP.
+	RecoverPanics bool
 }
 
 // Make sure the Router conforms with the http.Handler interface
@@ -234,243 +588,2267 @@ var _ http.Handler = New()
 // Path auto-correction, including trailing slashes, is enabled by default.
 func New() *Router {
 	return &Router{
-		RedirectTrailingSlash:  true,
-		RedirectFixedPath:      true,
-		HandleMethodNotAllowed: true,
-		HandleOptions:          true,
+		RedirectTrailingSlash:    true,
+		RedirectFixedPath:        true,
+		NormalizeRedirectEscapes: true,
+		HandleMethodNotAllowed:   true,
+		HandleOptions:            true,
 	}
 }
 
 // Get is a shortcut for router.Handle(http.MethodGet, path, handle)
-func (r *Router) Get(path string, handle http.Handler) {
-	r.Handle(http.MethodGet, path, handle)
+func (r *Router) Get(path string, handle http.Handler) *Route {
+	return r.Handle(http.MethodGet, path, handle)
 }
 
 // Head is a shortcut for router.Handle(http.MethodHead, path, handle)
-func (r *Router) Head(path string, handle http.Handler) {
-	r.Handle(http.MethodHead, path, handle)
+func (r *Router) Head(path string, handle http.Handler) *Route {
+	return r.Handle(http.MethodHead, path, handle)
 }
 
 // Options is a shortcut for router.Handle(http.MethodOptions, path, handle)
-func (r *Router) Options(path string, handle http.Handler) {
-	r.Handle(http.MethodOptions, path, handle)
+func (r *Router) Options(path string, handle http.Handler) *Route {
+	return r.Handle(http.MethodOptions, path, handle)
 }
 
 // Post is a shortcut for router.Handle(http.MethodPost, path, handle)
-func (r *Router) Post(path string, handle http.Handler) {
-	r.Handle(http.MethodPost, path, handle)
+func (r *Router) Post(path string, handle http.Handler) *Route {
+	return r.Handle(http.MethodPost, path, handle)
 }
 
 // Put is a shortcut for router.Handle(http.MethodPut, path, handle)
-func (r *Router) Put(path string, handle http.Handler) {
-	r.Handle(http.MethodPut, path, handle)
+func (r *Router) Put(path string, handle http.Handler) *Route {
+	return r.Handle(http.MethodPut, path, handle)
 }
 
 // Patch is a shortcut for router.Handle(http.MethodPatch, path, handle)
-func (r *Router) Patch(path string, handle http.Handler) {
-	r.Handle(http.MethodPatch, path, handle)
+func (r *Router) Patch(path string, handle http.Handler) *Route {
+	return r.Handle(http.MethodPatch, path, handle)
 }
 
 // Delete is a shortcut for router.Handle(http.MethodDelete, path, handle)
-func (r *Router) Delete(path string, handle http.Handler) {
-	r.Handle(http.MethodDelete, path, handle)
+func (r *Router) Delete(path string, handle http.Handler) *Route {
+	return r.Handle(http.MethodDelete, path, handle)
 }
 
 // GetAndHead is a shortcut for router.Get(path, handle) and router.Head(path, handle)
-func (r *Router) GetAndHead(path string, handle http.Handler) {
+func (r *Router) GetAndHead(path string, handle http.Handler) *Route {
 	r.Handle(http.MethodGet, path, handle)
-	r.Handle(http.MethodHead, path, handle)
+	return r.Handle(http.MethodHead, path, handle)
 }
 
-// Handle registers a new request handle with the given path and method.
-//
-// For GET, POST, PUT, PATCH and DELETE requests the respective shortcut
-// functions can be used.
+// anyMethods are the methods Any registers a handle for.
+var anyMethods = [...]string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+// Any registers a new request handle with the given path for the methods GET,
+// HEAD, POST, PUT, PATCH, DELETE and OPTIONS, like Handle. CONNECT, TRACE and
+// non-standard methods are not covered, requests with these methods are
+// answered like requests for other methods without a route.
 //
-// This function is intended for bulk loading and to allow the usage of less
-// frequently used, non-standardized or custom methods (e.g. for internal
-// communication with a proxy).
-func (r *Router) Handle(method, path string, handle http.Handler) {
-	if path[0] != '/' {
-		panic("path must begin with '/' in path '" + path + "'")
+// A route registered for the same path with one of the methods, either before
+// or after Any, takes priority over the handle of Any for this method only.
+// For example, a later router.Post(path, other) replaces the handle for POST
+// requests, while requests with the other methods are still served by handle.
+func (r *Router) Any(path string, handle http.Handler) *Route {
+	if handle == nil {
+		panic(registrationError(KindNilHandler, path,
+			"handle must not be nil in path '"+path+"'"))
 	}
 
-	if r.trees == nil {
-		r.trees = make(map[string]*node)
+	r.lock(path)
+	r.hasAny = true
+	var methods []string
+	for _, method := range anyMethods {
+		if r.registered(method, path) == nil {
+			methods = append(methods, method)
+		}
 	}
+	r.mu.Unlock()
 
-	root := r.trees[method]
-	if root == nil {
-		root = new(node)
-		r.trees[method] = root
+	rt := &Route{router: r, path: path}
+	for _, method := range methods {
+		rt.merge(r.Handle(method, path, &anyHandler{handle}))
 	}
+	return rt
+}
 
-	root.addRoute(path, handle)
+// anyHandler marks the handles registered by Any.
+type anyHandler struct {
+	http.Handler
 }
 
-// HandlerFunc is an adapter which allows the usage of an http.HandlerFunc as a
-// request handle.
-func (r *Router) HandlerFunc(method, path string, handler http.HandlerFunc) {
-	r.Handle(method, path, handler)
+// replaceAny replaces the handle registered by Any with the same method and
+// path as route, if there is one, and reports whether it did.
+func (r *Router) replaceAny(route registration) bool {
+	if _, ok := r.registered(route.method, route.path).(*anyHandler); !ok {
+		return false
+	}
+
+	for i := range r.pending {
+		if r.pending[i].method == route.method && r.pending[i].path == route.path {
+			r.pending[i] = route
+			return true
+		}
+	}
+
+	r.trees[route.method].findLeaf(route.path).handle = route.handle
+	return true
 }
 
-// ServeFiles serves files from the given file system root.
-// The path must end with "/*filepath", files are then served from the local
-// path /defined/root/dir/*filepath.
-// For example if root is "/etc" and *filepath is "passwd", the local file
-// "/etc/passwd" would be served.
-// Internally a http.FileServer is used, therefore http.NotFound is used instead
-// of the Router's NotFound handler.
-// To use the operating system's file system implementation,
-// use http.Dir:
-//     router.ServeFiles("/src/*filepath", http.Dir("/var/www"))
-func (r *Router) ServeFiles(path string, root http.FileSystem) {
-	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
-		panic("path must end with /*filepath in path '" + path + "'")
+// Handles registers a new request handle with the given path for each of the
+// given methods, like Handle. Methods listed more than once are registered
+// once. It panics if no method is given or a method is not a valid token, e.g.
+// empty or containing spaces.
+//
+// The returned Route refers to the routes of all methods.
+func (r *Router) Handles(methods []string, path string, handle http.Handler) *Route {
+	if len(methods) == 0 {
+		panic(registrationError(KindInvalidOption, path,
+			"no methods given for path '"+path+"'"))
+	}
+
+	var unique []string
+	for _, method := range methods {
+		if !validMethod(method) {
+			panic(registrationError(KindInvalidOption, path,
+				"invalid method '"+method+"' in path '"+path+"'"))
+		}
+		if !contains(unique, method) {
+			unique = append(unique, method)
+		}
 	}
 
-	r.GetAndHead(path, PathHandler(http.FileServer(root)))
+	rt := &Route{router: r, path: path}
+	for _, method := range unique {
+		rt.merge(r.Handle(method, path, handle))
+	}
+	return rt
 }
 
-func (r *Router) recv(w http.ResponseWriter, req *http.Request) {
-	if rcv := recover(); rcv != nil {
-		ctx := context.WithValue(req.Context(), panicKey, rcv)
-		r.PanicHandler.ServeHTTP(w, req.WithContext(ctx))
+// validMethod reports whether method is a valid HTTP method, i.e. a token as
+// defined by RFC 7230.
+func validMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+	for i := 0; i < len(method); i++ {
+		c := method[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"(),/:;<=>?@[\]{}`, c) >= 0 {
+			return false
+		}
 	}
+	return true
 }
 
-// Lookup allows the manual lookup of a method + path combo.
-// This is e.g. useful to build a framework around this router.
-// If the path was found, it returns the handle function and the path parameter
-// values. Otherwise the third return value indicates whether a redirection to
-// the same path with an extra / without the trailing slash should be performed.
-func (r *Router) Lookup(method, path string) (http.Handler, Params, bool) {
-	if root := r.trees[method]; root != nil {
-		return root.getValue(path)
+// Update is a shortcut for router.Put(path, handle) and router.Patch(path, handle)
+//
+// The returned Route refers to the routes of both methods.
+func (r *Router) Update(path string, handle http.Handler) *Route {
+	rt := &Route{router: r, path: path}
+	rt.merge(r.Handle(http.MethodPut, path, handle))
+	rt.merge(r.Handle(http.MethodPatch, path, handle))
+	return rt
+}
+
+// Scheme returns a Router for routes that only match requests made with the
+// given scheme, either "http" or "https". These routes take priority over the
+// routes registered with r, which continue to serve requests that the
+// returned Router does not match.
+//
+// The returned Router has all automatic redirects and replies disabled, its
+// NotFound handler falls back to r.
+func (r *Router) Scheme(scheme string) *Router {
+	scheme = strings.ToLower(scheme)
+	if scheme != "http" && scheme != "https" {
+		panic(registrationError(KindInvalidOption, "",
+			"scheme must be either http or https, has: '"+scheme+"'"))
+	}
+
+	r.lock("")
+	defer r.mu.Unlock()
+
+	if sr := r.schemes[scheme]; sr != nil {
+		return sr
+	}
+
+	if r.schemes == nil {
+		r.schemes = make(map[string]*Router)
 	}
-	return nil, nil, false
+
+	sr := &Router{NotFound: http.HandlerFunc(r.serveHTTP)}
+	r.schemes[scheme] = sr
+	return sr
 }
 
-func (r *Router) allowed(path, reqMethod string) (allow string) {
-	if path == "*" { // server-wide
-		for method := range r.trees {
-			if method == http.MethodOptions {
-				continue
-			}
+// Host returns a Router for the requests made to the given host, e.g.
+// "api.example.com". The host "*" matches all requests made to hosts without a
+// Router of their own. The host of a request is compared without its port,
+// unless a Router is registered for the host including the port.
+//
+// The returned Router is independent of r and configured like a Router
+// returned by New. Requests to a host with a Router are never served by the
+// routes registered with r, see UnknownHost for requests to other hosts.
+func (r *Router) Host(host string) *Router {
+	host = strings.ToLower(host)
+	if host == "" {
+		panic(registrationError(KindInvalidOption, "",
+			"host must not be empty"))
+	}
 
-			// add request method to list of allowed methods
-			if len(allow) == 0 {
-				allow = method
-			} else {
-				allow += ", " + method
-			}
+	r.lock("")
+	defer r.mu.Unlock()
+
+	if hr := r.hosts[host]; hr != nil {
+		return hr
+	}
+
+	if r.hosts == nil {
+		r.hosts = make(map[string]*Router)
+	}
+
+	hr := New()
+	r.hosts[host] = hr
+	return hr
+}
+
+// hostRouter returns the Router registered with Host for the host of req, or
+// nil if there is none.
+func (r *Router) hostRouter(req *http.Request) *Router {
+	host := strings.ToLower(req.Host)
+	if hr := r.hosts[host]; hr != nil {
+		return hr
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		if hr := r.hosts[h]; hr != nil {
+			return hr
 		}
-	} else { // specific path
-		for method := range r.trees {
-			// Skip the requested method - we already tried this one
-			if method == reqMethod || method == http.MethodOptions {
-				continue
-			}
+	}
 
-			handle, _, _ := r.trees[method].getValue(path)
-			if handle != nil {
-				// add request method to list of allowed methods
-				if len(allow) == 0 {
-					allow = method
-				} else {
-					allow += ", " + method
-				}
-			}
+	return r.hosts["*"]
+}
+
+func (r *Router) requestScheme(req *http.Request) string {
+	if r.TrustForwardedProto {
+		if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+			return strings.ToLower(proto)
 		}
 	}
-	if len(allow) > 0 {
-		allow += ", OPTIONS"
+
+	if req.TLS != nil {
+		return "https"
 	}
-	return
+	return "http"
 }
 
-// ServeHTTP makes the router implement the http.Handler interface.
-func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	if r.PanicHandler != nil {
-		defer r.recv(w, req)
+// Handle registers a new request handle with the given path and method.
+//
+// For GET, POST, PUT, PATCH and DELETE requests the respective shortcut
+// functions can be used.
+//
+// This function is intended for bulk loading and to allow the usage of less
+// frequently used, non-standardized or custom methods (e.g. for internal
+// communication with a proxy).
+//
+// The returned Route can be used to name the route.
+func (r *Router) Handle(method, path string, handle http.Handler) *Route {
+	cand := r.register(registration{
+		method:     method,
+		path:       path,
+		handle:     handle,
+		middleware: r.middlewareChain(),
+	})
+	return newRoute(r, path, method, cand)
+}
+
+// HandleMatch registers a new request handle with the given path and method,
+// like Handle. Additionally the values of the named params of the path are
+// checked with the matcher of the same name. If a matcher returns false, the
+// path does not match the route.
+//
+// Matchers are stored with the params in the tree, so they also apply to all
+// other routes sharing the param, e.g. a matcher for "id" registered with
+// /users/:id/posts also applies to /users/:id. Only one matcher can be
+// registered for each param.
+func (r *Router) HandleMatch(method, path string, matchers map[string]func(string) bool, handle http.Handler) {
+	r.register(registration{
+		method:     method,
+		path:       path,
+		handle:     handle,
+		matchers:   matchers,
+		middleware: r.middlewareChain(),
+	})
+}
+
+// HandleCatchAllLimit registers a new request handle with the given path and
+// method, like Handle, whose catch-all parameter matches at most maxSegments
+// path segments. Requests with deeper paths do not match the route and are
+// usually answered with 404 Not Found. The value "/a/b/" has 3 segments, the
+// last of which is empty.
+//
+// The limit bounds the number of segments only, not their length.
+func (r *Router) HandleCatchAllLimit(method, path string, handle http.Handler, maxSegments int) {
+	plain, _ := splitConstraints(path)
+	i := findCatchAll(plain)
+	if i < 0 {
+		panic(registrationError(KindBadPath, path,
+			"no catch-all parameter in path '"+path+"'"))
+	}
+	if maxSegments < 1 {
+		panic(registrationError(KindInvalidOption, path,
+			"catch-all limit must be positive in path '"+path+"'"))
 	}
 
-	path := req.URL.Path
+	r.HandleMatch(method, path, map[string]func(string) bool{
+		plain[i+1:]: func(value string) bool {
+			return strings.Count(value, "/") <= maxSegments
+		},
+	}, handle)
+}
 
-	if root := r.trees[req.Method]; root != nil {
-		if handler, ps, tsr := root.getValue(path); handler != nil {
-			if ps != nil {
-				req = req.WithContext(&paramsContext{req.Context(), ps})
-			}
+type registration struct {
+	method, path string
+	handle       http.Handler
+	matchers     map[string]func(string) bool
+	middleware   []func(http.Handler) http.Handler
+}
 
-			handler.ServeHTTP(w, req)
-			return
-		} else if req.Method != http.MethodConnect && path != "/" {
-			code := http.StatusMovedPermanently // Permanent redirect, request with GET method
-			if req.Method != http.MethodGet {
-				// Temporary redirect, request with same method
-				// As of Go 1.3, Go does not support status code 308.
-				code = http.StatusTemporaryRedirect
-			}
+// register registers the route. If its handle was added to a handle restricted
+// with Route.Query, it returns the candidate of the handle.
+func (r *Router) register(route registration) *queryCandidate {
+	defer setRegistrationMethod(route.method)
 
-			if tsr && r.RedirectTrailingSlash {
-				u := *req.URL
+	r.lock(route.path)
+	defer r.mu.Unlock()
 
-				if len(path) > 1 && path[len(path)-1] == '/' {
-					u.Path = path[:len(path)-1]
-				} else {
-					u.Path = path + "/"
-				}
+	return r.registerLocked(route)
+}
 
-				http.Redirect(w, req, u.String(), code)
-				return
-			}
+// registerLocked is register for callers holding the lock.
+func (r *Router) registerLocked(route registration) *queryCandidate {
+	defer setRegistrationMethod(route.method)
 
-			// Try to fix the request path
-			if r.RedirectFixedPath {
-				fixedPath, found := root.findCaseInsensitivePath(
-					CleanPath(path),
-					r.RedirectTrailingSlash,
-				)
-				if found {
-					u := *req.URL
-					u.Path = string(fixedPath)
+	if len(route.path) < 1 || route.path[0] != '/' {
+		panic(registrationError(KindBadPath, route.path,
+			"path must begin with '/' in path '"+route.path+"'"))
+	}
+	if route.handle == nil {
+		panic(registrationError(KindNilHandler, route.path,
+			"handle must not be nil in path '"+route.path+"'"))
+	}
 
-					http.Redirect(w, req, u.String(), code)
-					return
-				}
-			}
+	_, isAny := route.handle.(*anyHandler)
+	route.handle = wrapMiddleware(route.handle, route.middleware)
+
+	if r.hasAny && !isAny && len(route.matchers) == 0 && r.replaceAny(route) {
+		return nil
+	}
+	if r.hasQuery && len(route.matchers) == 0 {
+		if cand := r.addQueryCandidate(route); cand != nil {
+			return cand
 		}
 	}
 
-	if req.Method == http.MethodOptions {
-		// Handle OPTIONS requests
-		if r.HandleOptions {
-			if allow := r.allowed(path, req.Method); len(allow) > 0 {
-				w.Header().Set("Allow", allow)
-				return
-			}
+	if r.MaxRoutesPerMethod > 0 && r.routeCount(route.method) >= r.MaxRoutesPerMethod {
+		panic(registrationError(KindTooManyRoutes, route.path,
+			"more than "+strconv.Itoa(r.MaxRoutesPerMethod)+" routes for method '"+
+				route.method+"' in path '"+route.path+"'"))
+	}
+
+	if r.DeferRegistration {
+		r.pending = append(r.pending, route)
+		return nil
+	}
+
+	r.reportShadowing(route.method, route.path, nil)
+	r.addRoute(route)
+	return nil
+}
+
+// routeCount returns the number of routes registered for method, including
+// routes not yet added by Compile.
+func (r *Router) routeCount(method string) int {
+	var count int
+	if root := r.trees[method]; root != nil {
+		// the priority of a node is the number of handles below it
+		count = int(root.priority)
+	}
+	for _, route := range r.pending {
+		if route.method == method {
+			count++
 		}
-	} else {
-		// Handle 405
-		if r.HandleMethodNotAllowed {
-			if allow := r.allowed(path, req.Method); len(allow) > 0 {
-				w.Header().Set("Allow", allow)
-				if r.MethodNotAllowed != nil {
-					r.MethodNotAllowed.ServeHTTP(w, req)
-				} else {
-					http.Error(w,
-						http.StatusText(http.StatusMethodNotAllowed),
-						http.StatusMethodNotAllowed,
-					)
-				}
-				return
-			}
+	}
+	return count
+}
+
+// Compile builds the trees from all routes registered since DeferRegistration
+// was enabled. Routes are added sorted by method and path, so the trees
+// do not depend on the order of registration.
+// Like Handle, it panics if any of the routes conflict.
+func (r *Router) Compile() {
+	r.lock("")
+	defer r.mu.Unlock()
+
+	r.compile()
+}
+
+func (r *Router) compile() {
+	pending := r.pending
+	r.pending = nil
+
+	sort.SliceStable(pending, func(i, j int) bool {
+		if pending[i].method != pending[j].method {
+			return pending[i].method < pending[j].method
 		}
+		return pending[i].path < pending[j].path
+	})
+
+	for _, route := range pending {
+		r.reportShadowing(route.method, route.path, pending)
 	}
 
-	// Handle 404
-	if r.NotFound != nil {
+	for _, route := range pending {
+		r.addRoute(route)
+	}
+}
+
+// Clone returns a copy of the router with the same routes and options, which
+// can be modified independently, e.g. to replace a few routes of a variant of
+// the router. The trees of the routes are copied, the handles are shared.
+// Routers returned by Host and Scheme are cloned as well. Options of reference
+// types, e.g. RedirectCodes, FormatSuffixes and CORS, share their contents
+// with the router.
+//
+// The clone is not sealed, even if the router is.
+func (r *Router) Clone() *Router {
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	c := &Router{
+		pending:       append([]registration(nil), r.pending...),
+		middleware:    append([]func(http.Handler) http.Handler(nil), r.middleware...),
+		maxParams:     r.maxParams,
+		hasAny:        r.hasAny,
+		hasQuery:      r.hasQuery,
+		providers:     append([]RouteProvider(nil), r.providers...),
+		registryBuilt: r.registryBuilt,
+
+		DeferRegistration:              r.DeferRegistration,
+		MaxRoutesPerMethod:             r.MaxRoutesPerMethod,
+		RedirectTrailingSlash:          r.RedirectTrailingSlash,
+		RedirectFixedPath:              r.RedirectFixedPath,
+		NormalizeRedirectEscapes:       r.NormalizeRedirectEscapes,
+		RedirectCodes:                  r.RedirectCodes,
+		PermanentTrailingSlashRedirect: r.PermanentTrailingSlashRedirect,
+		UsePermanentRedirect:           r.UsePermanentRedirect,
+		RedirectTrailingSlashCode:      r.RedirectTrailingSlashCode,
+		RedirectFixedPathCode:          r.RedirectFixedPathCode,
+		CaseInsensitive:                r.CaseInsensitive,
+		Strict:                         r.Strict,
+		RejectControlChars:             r.RejectControlChars,
+		HandleMethodNotAllowed:         r.HandleMethodNotAllowed,
+		HandleOptions:                  r.HandleOptions,
+		UseForUnmatched:                r.UseForUnmatched,
+		OptionsMethodFilter:            r.OptionsMethodFilter,
+		OptionsStatus:                  r.OptionsStatus,
+		CORS:                           r.CORS,
+		CountMatches:                   r.CountMatches,
+		NotFound:                       r.NotFound,
+		NotFoundPathParam:              r.NotFoundPathParam,
+		OnNotFound:                     r.OnNotFound,
+		SlashMismatchHandler:           r.SlashMismatchHandler,
+		RedirectHandler:                r.RedirectHandler,
+		MethodNotAllowed:               r.MethodNotAllowed,
+		TransformParams:                r.TransformParams,
+		UnescapeParams:                 r.UnescapeParams,
+		StrictUnescapeParams:           r.StrictUnescapeParams,
+		UseRawPath:                     r.UseRawPath,
+		OnMatch:                        r.OnMatch,
+		SkipStaticPattern:              r.SkipStaticPattern,
+		PatternHeader:                  r.PatternHeader,
+		VersionPrefix:                  r.VersionPrefix,
+		FormatSuffixes:                 r.FormatSuffixes,
+		PoolParams:                     r.PoolParams,
+		EmitCanonicalLink:              r.EmitCanonicalLink,
+		TrustForwardedProto:            r.TrustForwardedProto,
+		UnknownHost:                    r.UnknownHost,
+		RedirectInterceptors:           r.RedirectInterceptors,
+		MethodFallback:                 r.MethodFallback,
+		HandleHEADForGET:               r.HandleHEADForGET,
+		Logger:                         r.Logger,
+		DisabledStatus:                 r.DisabledStatus,
+		DisabledBody:                   r.DisabledBody,
+		PanicHandler:                   r.PanicHandler,
+		PanicResponse:                  r.PanicResponse,
+		RecoverPanics:                  r.RecoverPanics,
+	}
+
+	if r.trees != nil {
+		c.trees = make(map[string]*node, len(r.trees))
+		for method, root := range r.trees {
+			c.trees[method] = root.clone()
+		}
+	}
+	if r.notAllowed != nil {
+		c.notAllowed = r.notAllowed.clone()
+	}
+
+	if r.schemes != nil {
+		c.schemes = make(map[string]*Router, len(r.schemes))
+		for scheme, sr := range r.schemes {
+			sr = sr.Clone()
+			sr.NotFound = http.HandlerFunc(c.serveHTTP)
+			c.schemes[scheme] = sr
+		}
+	}
+	if r.hosts != nil {
+		c.hosts = make(map[string]*Router, len(r.hosts))
+		for host, hr := range r.hosts {
+			c.hosts[host] = hr.Clone()
+		}
+	}
+
+	if r.names != nil {
+		c.names = make(map[string]*namedRoute, len(r.names))
+		for name, named := range r.names {
+			c.names[name] = named
+		}
+		c.pathNames = make(map[string]string, len(r.pathNames))
+		for path, name := range r.pathNames {
+			c.pathNames[path] = name
+		}
+	}
+	if r.barePrefixRedirects != nil {
+		c.barePrefixRedirects = make(map[string]string, len(r.barePrefixRedirects))
+		for key, target := range r.barePrefixRedirects {
+			c.barePrefixRedirects[key] = target
+		}
+	}
+	if r.operations != nil {
+		c.operations = make(map[string]OperationMeta, len(r.operations))
+		for key, op := range r.operations {
+			c.operations[key] = op
+		}
+	}
+
+	if r.hasQuery {
+		c.cloneQueryHandlers()
+	}
+	return c
+}
+
+// Seal marks the routes of the router and of the Routers returned by Host and
+// Scheme as complete. The routes of the providers added with Register and
+// routes registered with DeferRegistration are added first, the package
+// registry is not consulted. Afterwards requests are routed without taking the lock which
+// guards the routes against concurrent registration, and registering or
+// removing routes panics with a KindSealed *RegistrationError.
+//
+// Seal is meant to be called once all routes are registered, before the
+// router starts serving requests.
+func (r *Router) Seal() {
+	r.build(false)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if atomic.LoadUint32(&r.sealed) != 0 {
+		return
+	}
+	if len(r.pending) > 0 {
+		r.compile()
+	}
+
+	for _, sr := range r.schemes {
+		sr.Seal()
+	}
+	for _, hr := range r.hosts {
+		hr.Seal()
+	}
+	atomic.StoreUint32(&r.sealed, 1)
+}
+
+// lock locks the router for registering the route with the given path, which
+// may be empty. It panics if the router is sealed.
+func (r *Router) lock(path string) {
+	r.mu.Lock()
+	if atomic.LoadUint32(&r.sealed) != 0 {
+		r.mu.Unlock()
+
+		msg := "router is sealed"
+		if path != "" {
+			msg += " in path '" + path + "'"
+		}
+		panic(registrationError(KindSealed, path, msg))
+	}
+}
+
+// rlock locks the router for reading, unless it is sealed, and reports
+// whether it did. The caller must then unlock it with r.mu.RUnlock.
+func (r *Router) rlock() bool {
+	if atomic.LoadUint32(&r.sealed) != 0 {
+		return false
+	}
+	r.mu.RLock()
+	return true
+}
+
+func (r *Router) addRoute(route registration) {
+	defer setRegistrationMethod(route.method)
+
+	if r.trees == nil {
+		r.trees = make(map[string]*node)
+	}
+
+	root := r.trees[route.method]
+	if root == nil {
+		root = new(node)
+		r.trees[route.method] = root
+	}
+
+	root.addRoute(route.path, route.handle)
+	if root.maxParams > r.maxParams {
+		r.maxParams = root.maxParams
+	}
+
+	if len(route.matchers) > 0 {
+		// the params of a path with an optional param are all in the long path
+		plain, _ := splitConstraints(route.path)
+		_, long, _ := splitOptional(plain)
+		root.setMatchers(long, route.matchers)
+	}
+}
+
+// reportShadowing logs how many routes the catch-all route about to be
+// registered with the given method and path sits above: the static routes
+// below its parent with the same method, which conflict with it, and the
+// routes of the MethodFallback method of the given method, which can no longer
+// be reached by requests with that method because the catch-all matches them
+// first. The routes of pending, which are about to be added too, are counted
+// as well.
+func (r *Router) reportShadowing(method, path string, pending []registration) {
+	if r.Logger == nil {
+		return
+	}
+
+	path, _ = splitConstraints(path)
+	i := findCatchAll(path)
+	if i < 0 {
+		return
+	}
+
+	if static := r.countShadowed(method, path[:i], pending, true); static > 0 {
+		r.Logger.Printf("httprouter: catch-all route %s %s shadows %d static %s route(s)",
+			method, path, static, method)
+	}
+
+	fallback, ok := r.fallbackMethod(method)
+	if !ok {
+		return
+	}
+	if shadowed := r.countShadowed(fallback, path[:i], pending, false); shadowed > 0 {
+		r.Logger.Printf("httprouter: catch-all route %s %s shadows %d %s route(s) for %s requests",
+			method, path, shadowed, fallback, method)
+	}
+}
+
+// countShadowed returns the number of routes registered or pending for method
+// whose path starts with prefix. If static is true, only routes without
+// params are counted.
+func (r *Router) countShadowed(method, prefix string, pending []registration, static bool) int {
+	shadowed := 0
+	count := func(path string) {
+		if strings.HasPrefix(path, prefix) && (!static || !strings.ContainsAny(path, ":*")) {
+			shadowed++
+		}
+	}
+
+	if root := r.trees[method]; root != nil {
+		root.walk(func(n *node) {
+			count(n.fullPath)
+		})
+	}
+	for _, route := range pending {
+		if route.method == method {
+			path, _ := splitConstraints(route.path)
+			count(path)
+		}
+	}
+	return shadowed
+}
+
+// MethodNotAllowedFor registers a handler which is called instead of the
+// MethodNotAllowed handler for requests matching the given path, if
+// HandleMethodNotAllowed is true. Like the MethodNotAllowed handler, it is only
+// called if a handle is registered for the path with another method and the
+// "Allow" header is set before. The values of the params of the path are
+// accessible as for any handle.
+func (r *Router) MethodNotAllowedFor(path string, handler http.Handler) {
+	if len(path) < 1 || path[0] != '/' {
+		panic(registrationError(KindBadPath, path,
+			"path must begin with '/' in path '"+path+"'"))
+	}
+	if handler == nil {
+		panic(registrationError(KindNilHandler, path,
+			"handle must not be nil in path '"+path+"'"))
+	}
+
+	r.lock(path)
+	defer r.mu.Unlock()
+
+	if r.notAllowed == nil {
+		r.notAllowed = new(node)
+	}
+	r.notAllowed.addRoute(path, handler)
+}
+
+// RedirectBarePrefix sets the target of the redirect for requests to the bare
+// prefix of the catch-all route registered with the given method and path,
+// e.g. /docs for /docs/*path. By default these requests are redirected to the
+// prefix with a trailing slash, where the catch-all parameter is "/", if
+// RedirectTrailingSlash is enabled.
+// The target may contain the named parameters of the path, which are replaced
+// by their values:
+//     router.RedirectBarePrefix(http.MethodGet, "/docs/*path", "/docs/index")
+//     router.RedirectBarePrefix(http.MethodGet, "/users/:id/files/*path", "/users/:id/files/home")
+func (r *Router) RedirectBarePrefix(method, path, target string) {
+	plain, _ := splitConstraints(path)
+	if findCatchAll(plain) < 0 {
+		panic(registrationError(KindBadPath, path,
+			"no catch-all parameter in path '"+path+"'"))
+	}
+	if len(target) < 1 || target[0] != '/' {
+		panic(registrationError(KindInvalidOption, path,
+			"redirect target must begin with '/' in path '"+path+"'"))
+	}
+
+	r.lock(path)
+	defer r.mu.Unlock()
+
+	if r.barePrefixRedirects == nil {
+		r.barePrefixRedirects = make(map[string]string)
+	}
+	r.barePrefixRedirects[method+" "+plain] = target
+}
+
+// barePrefixTarget returns the target set with RedirectBarePrefix if path is
+// the bare prefix of a catch-all route, otherwise it returns an empty string.
+func (r *Router) barePrefixTarget(root *node, method, path string) string {
+	if r.barePrefixRedirects == nil || strings.HasSuffix(path, "/") {
+		return ""
+	}
+
+	leaf, ps, _ := root.getLeaf(path + "/")
+	if leaf == nil || leaf.nType != catchAll {
+		return ""
+	}
+
+	target, ok := r.barePrefixRedirects[method+" "+leaf.fullPath]
+	if !ok {
+		return ""
+	}
+	return expandPath(target, ps)
+}
+
+// Disable temporarily disables the handle registered with the given method and
+// path. Requests matching the route are answered with DisabledStatus and
+// DisabledBody until it is re-enabled with Enable. The path is the one the
+// route was registered with, e.g. "/items/:id?" disables requests for both
+// /items and /items/:id. It panics with a KindNotFound *RegistrationError if no
+// such route is registered.
+//
+// Disable is safe to call while the router is serving requests.
+func (r *Router) Disable(method, path string) {
+	for _, leaf := range r.mustFindLeaves(method, path) {
+		atomic.StoreUint32(&leaf.disabled, 1)
+	}
+}
+
+// Enable re-enables a handle previously disabled with Disable.
+//
+// Enable is safe to call while the router is serving requests.
+func (r *Router) Enable(method, path string) {
+	for _, leaf := range r.mustFindLeaves(method, path) {
+		atomic.StoreUint32(&leaf.disabled, 0)
+	}
+}
+
+// Remove removes the handle registered with exactly the given method and path,
+// e.g. "/user/:name", and reports whether there was one. Afterwards requests
+// are routed as if the handle had never been registered, including redirects
+// because of RedirectTrailingSlash and RedirectFixedPath.
+//
+// Like Handle, Remove is safe to call while the router is serving requests
+// and panics once the router is sealed.
+func (r *Router) Remove(method, path string) bool {
+	r.lock(path)
+	defer r.mu.Unlock()
+
+	var removed bool
+	for i := 0; i < len(r.pending); i++ {
+		if r.pending[i].method == method && r.pending[i].path == path {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			removed = true
+			i--
+		}
+	}
+
+	root := r.trees[method]
+	if root == nil {
+		return removed
+	}
+
+	// a path with an optional param was added as two routes
+	plain, _ := splitConstraints(path)
+	paths := []string{plain}
+	if short, long, name := splitOptional(plain); name != "" {
+		paths = []string{long, short}
+	}
+
+	for _, path := range paths {
+		if root.remove(path) {
+			delete(r.barePrefixRedirects, method+" "+path)
+			delete(r.operations, method+" "+path)
+			removed = true
+		}
+	}
+
+	if root.handle == nil && len(root.children) == 0 {
+		delete(r.trees, method)
+	}
+	if removed {
+		r.removeName(path)
+	}
+	return removed
+}
+
+// registered returns the handle registered with exactly the given method and
+// path, including routes not yet added by Compile, or nil if there is none.
+func (r *Router) registered(method, path string) http.Handler {
+	var handle http.Handler
+	for _, route := range r.pending {
+		if route.method == method && route.path == path {
+			handle = route.handle
+			break
+		}
+	}
+
+	if root := r.trees[method]; root != nil && handle == nil {
+		if leaf := root.findLeaf(path); leaf != nil {
+			handle = leaf.handle
+		}
+	}
+
+	// the handle without the middleware it was registered with
+	if h, ok := handle.(*middlewareHandler); ok {
+		return h.handle
+	}
+	return handle
+}
+
+// mustFindLeaves returns the leaves of the route registered with exactly the
+// given method and path, both leaves of a path with an optional param. It
+// panics if there is no such route.
+func (r *Router) mustFindLeaves(method, path string) []*node {
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	if root := r.trees[method]; root != nil {
+		if leaves := root.findLeaves(path); len(leaves) > 0 {
+			return leaves
+		}
+	}
+	err := registrationError(KindNotFound, path,
+		"no handle is registered for method '"+method+"' and path '"+path+"'")
+	err.Method = method
+	panic(err)
+}
+
+// HandlerFunc is an adapter which allows the usage of an http.HandlerFunc as a
+// request handle.
+func (r *Router) HandlerFunc(method, path string, handler http.HandlerFunc) *Route {
+	return r.Handle(method, path, handler)
+}
+
+// ServeFiles serves files from the given file system root.
+// The path must end with "/*filepath", files are then served from the local
+// path /defined/root/dir/*filepath.
+// For example if root is "/etc" and *filepath is "passwd", the local file
+// "/etc/passwd" would be served.
+// Internally a http.FileServer is used, requests for files which do not exist
+// are answered by the Router's NotFound handler, as requests not matching any
+// route. Use ServeFilesWithOptions to disable directory listings.
+// To use the operating system's file system implementation,
+// use http.Dir:
+//     router.ServeFiles("/src/*filepath", http.Dir("/var/www"))
+func (r *Router) ServeFiles(path string, root http.FileSystem) {
+	r.ServeFilesWithOptions(path, root, FileServeOptions{})
+}
+
+// FileServeOptions configures the file server registered by
+// ServeFilesWithOptions.
+type FileServeOptions struct {
+	// If enabled, requests for directories without an index.html file are
+	// answered with 404 Not Found instead of a directory listing.
+	DisableListing bool
+
+	// Handler for requests for files which do not exist. If nil, the
+	// router's NotFound handler is used, as for requests not matching any
+	// route.
+	NotFound http.Handler
+}
+
+// ServeFilesWithOptions is like ServeFiles, but allows disabling directory
+// listings and setting a handler for requests for missing files other than the
+// router's NotFound handler.
+//     router.ServeFilesWithOptions("/src/*filepath", http.Dir("/var/www"),
+//         httprouter.FileServeOptions{DisableListing: true})
+func (r *Router) ServeFilesWithOptions(path string, root http.FileSystem, opts FileServeOptions) {
+	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
+		panic(registrationError(KindBadFilepath, path,
+			"path must end with /*filepath in path '"+path+"'"))
+	}
+
+	if opts.DisableListing {
+		root = noListingFS{root}
+	}
+
+	r.GetAndHead(path, &fileNotFoundHandler{
+		Handler: PathHandler(http.FileServer(root)),
+
+		router:   r,
+		notFound: opts.NotFound,
+	})
+}
+
+// ServeFilesIndex is like ServeFiles, but requests for directories are
+// answered with the file of the given name in the directory instead of the
+// directory listing or index.html. If the directory has no such file, the
+// request is answered by the Router's NotFound handler.
+//     router.ServeFilesIndex("/src/*filepath", http.Dir("/var/www"), "default.htm")
+func (r *Router) ServeFilesIndex(path string, root http.FileSystem, index string) {
+	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
+		panic(registrationError(KindBadFilepath, path,
+			"path must end with /*filepath in path '"+path+"'"))
+	}
+
+	r.GetAndHead(path, &fileNotFoundHandler{
+		Handler: PathHandler(&indexHandler{
+			Handler: http.FileServer(root),
+
+			root:  root,
+			index: index,
+		}),
+
+		router: r,
+	})
+}
+
+// indexHandler serves the index file of directories itself, as
+// http.FileServer only knows about index.html.
+type indexHandler struct {
+	http.Handler
+
+	root  http.FileSystem
+	index string
+}
+
+func (h *indexHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// requests for directories without a trailing slash are redirected by
+	// the FileServer
+	name := req.URL.Path
+	if !strings.HasSuffix(name, "/") {
+		h.Handler.ServeHTTP(w, req)
+		return
+	}
+
+	// cleaned like the names opened by the FileServer, as not every
+	// http.FileSystem rejects ".." elements
+	f, err := h.root.Open(CleanPath(name + h.index))
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+	defer f.Close()
+
+	d, err := f.Stat()
+	if err != nil || d.IsDir() {
+		http.NotFound(w, req)
+		return
+	}
+
+	http.ServeContent(w, req, d.Name(), d.ModTime(), f)
+}
+
+// fileNotFoundHandler answers the requests a file server answers with 404 Not
+// Found with its notFound handler, or the NotFound handler of its router,
+// instead.
+type fileNotFoundHandler struct {
+	http.Handler
+
+	router   *Router
+	notFound http.Handler
+}
+
+func (h *fileNotFoundHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	nw := &notFoundWriter{ResponseWriter: w}
+	h.Handler.ServeHTTP(nw, req)
+	if !nw.notFound {
+		return
+	}
+
+	if h.notFound != nil {
+		h.notFound.ServeHTTP(w, req)
+	} else {
+		h.router.serveNotFound(w, req)
+	}
+}
+
+// notFoundWriter swallows a 404 Not Found response, leaving the wrapped
+// http.ResponseWriter untouched, so another one can be written instead.
+type notFoundWriter struct {
+	http.ResponseWriter
+	notFound bool
+}
+
+func (w *notFoundWriter) WriteHeader(code int) {
+	if code != http.StatusNotFound {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	// set by http.Error
+	w.notFound = true
+	w.Header().Del("Content-Type")
+	w.Header().Del("X-Content-Type-Options")
+}
+
+func (w *notFoundWriter) Write(p []byte) (int, error) {
+	if w.notFound {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// ReadFrom implements io.ReaderFrom, so the http.FileServer can still use the
+// io.ReaderFrom of the wrapped http.ResponseWriter, e.g. for sendfile.
+func (w *notFoundWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.notFound {
+		return io.Copy(ioutil.Discard, r)
+	}
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(w.ResponseWriter, r)
+}
+
+// Flush implements http.Flusher if the wrapped http.ResponseWriter does.
+func (w *notFoundWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && !w.notFound {
+		f.Flush()
+	}
+}
+
+// noListingFS hides the directories of a http.FileSystem without an index.html
+// file, so a http.FileServer answers requests for them with 404 Not Found
+// instead of a directory listing.
+type noListingFS struct {
+	http.FileSystem
+}
+
+func (fs noListingFS) Open(name string) (http.File, error) {
+	f, err := fs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !d.IsDir() {
+		return f, nil
+	}
+
+	index, err := fs.FileSystem.Open(strings.TrimSuffix(name, "/") + "/index.html")
+	if err != nil {
+		f.Close()
+		return nil, os.ErrNotExist
+	}
+	index.Close()
+
+	return f, nil
+}
+
+// Mount registers h for all requests of the methods registered by Any with a
+// path below prefix. The prefix is stripped from the request URLs path before
+// it is passed to h, keeping the leading slash. This allows composing
+// independently built routers:
+//     router.Mount("/admin", adminRouter)
+// Requests for "/admin/users" are then routed by adminRouter as "/users".
+// Requests for the prefix itself are redirected to the prefix with a trailing
+// slash if RedirectTrailingSlash is enabled. Mounting at "/" panics.
+func (r *Router) Mount(prefix string, h http.Handler) {
+	path := strings.TrimSuffix(prefix, "/")
+	if path == "" {
+		panic(registrationError(KindBadPath, prefix,
+			"a handler cannot be mounted at '"+prefix+"'"))
+	}
+
+	if h == nil {
+		panic(registrationError(KindNilHandler, prefix,
+			"handle must not be nil in path '"+prefix+"'"))
+	}
+
+	r.Any(path+"/*"+mountParam, &mountHandler{h})
+}
+
+// mountParam is the name of the catchAll param of the routes registered by
+// Mount.
+const mountParam = "rest"
+
+// mountHandler wraps a http.Handler and replaces the request URLs path with
+// the value of the mountParam param.
+type mountHandler struct {
+	http.Handler
+}
+
+func (h *mountHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	u := *req.URL
+	u.Path = GetValue(req.Context(), mountParam)
+	u.RawPath = "" // no longer matches the stripped path
+
+	r := *req
+	r.URL = &u
+
+	h.Handler.ServeHTTP(w, &r)
+}
+
+func (r *Router) recv(w http.ResponseWriter, req *http.Request) {
+	if rcv := recover(); rcv != nil {
+		if r.PanicHandler == nil && r.PanicResponse == nil {
+			r.recoverPanic(w, req, rcv)
+			return
+		}
+
+		ctx := context.WithValue(req.Context(), PanicStackKey, debug.Stack())
+		if r.PanicHandler == nil {
+			r.PanicResponse(w, req.WithContext(ctx), rcv)
+			return
+		}
+
+		ctx = context.WithValue(ctx, PanicKey, rcv)
+		r.PanicHandler.ServeHTTP(w, req.WithContext(ctx))
+	}
+}
+
+// recoverPanic implements RecoverPanics.
+func (r *Router) recoverPanic(w http.ResponseWriter, req *http.Request, rcv interface{}) {
+	if rcv == http.ErrAbortHandler {
+		panic(rcv)
+	}
+
+	msg := fmt.Sprintf("httprouter: panic serving %s %s: %v\n%s", req.Method, req.URL, rcv, debug.Stack())
+	if r.Logger != nil {
+		r.Logger.Print(msg)
+	} else {
+		log.Print(msg)
+	}
+
+	http.Error(w,
+		http.StatusText(http.StatusInternalServerError),
+		http.StatusInternalServerError,
+	)
+}
+
+// Lookup allows the manual lookup of a method + path combo.
+// This is e.g. useful to build a framework around this router.
+// If the path was found, it returns the handle function and the path parameter
+// values. Otherwise the third return value indicates whether a redirection to
+// the same path with an extra / without the trailing slash should be performed.
+// The route is looked up like ServeHTTP does, so HandleHEADForGET,
+// MethodFallback, CaseInsensitive and FormatSuffixes apply.
+//
+// Lookup is a shorthand for Match.
+func (r *Router) Lookup(method, path string) (http.Handler, Params, bool) {
+	m := r.match(method, path)
+	return m.Handle, m.Params, m.TSR
+}
+
+// Match looks up a method + path combo like Lookup and returns the route
+// matching it. The bool return value indicates whether a route was found.
+// If not, the returned Match has only its Method and TSR fields set.
+func (r *Router) Match(method, path string) (*Match, bool) {
+	m := r.match(method, path)
+	return &m, m.Handle != nil
+}
+
+func (r *Router) match(method, path string) (m Match) {
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	m.Method = method
+	if root := r.trees[method]; root != nil {
+		leaf, ps, tsr := r.lookupLeaf(root, path, nil)
+		if leaf != nil {
+			m.Path, m.Handle, m.Params = leaf.fullPath, leaf.handle, ps
+			return m
+		}
+		m.TSR = tsr
+	}
+	if leaf, o := r.methodFallback(method, path); leaf != nil {
+		m.Method, m.Path, m.Handle, m.Params = o.Method, leaf.fullPath, leaf.handle, o.Params
+		m.TSR = false
+	}
+	return m
+}
+
+// FindCaseInsensitivePath makes a case-insensitive lookup of the given method +
+// path combo, like RedirectFixedPath does for requests, and returns the
+// case-corrected path of the matching handle. If trailingSlash is true, a
+// missing or superfluous trailing slash is corrected as well.
+// The path is not cleaned, use CleanPath first to get the same result as
+// RedirectFixedPath. The bool return value indicates whether a handle was
+// found.
+func (r *Router) FindCaseInsensitivePath(method, path string, trailingSlash bool) (string, bool) {
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	if root := r.trees[method]; root != nil {
+		if ciPath, found := root.findCaseInsensitivePath(path, trailingSlash); found {
+			return string(ciPath), true
+		}
+	}
+	return "", false
+}
+
+// Resolve looks up a method + path combo like Lookup and additionally returns
+// the sorted list of methods allowed for the path, as returned by
+// AllowedMethods, visiting the tree of each method only once. It is meant for
+// frameworks which need both to serve a request.
+// If no handle is registered for the method, tsr indicates whether a
+// redirection to the same path with an extra / without the trailing slash
+// should be performed.
+func (r *Router) Resolve(method, path string) (handle http.Handler, ps Params, allow []string, tsr bool) {
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	allow = r.methodsAllowed(path, "", func(m string, root *node) bool {
+		leaf, mps, mtsr := r.lookupLeaf(root, path, nil)
+		if m == method {
+			if leaf != nil {
+				handle, ps = leaf.handle, mps
+			} else {
+				tsr = mtsr
+			}
+		}
+		return leaf != nil
+	})
+	if handle == nil {
+		if leaf, o := r.methodFallback(method, path); leaf != nil {
+			handle, ps, tsr = leaf.handle, o.Params, false
+		}
+	}
+	sort.Strings(allow)
+	return
+}
+
+// Match is a route matching a request, as returned by Router.Match and
+// LookupAll. Fields may be added in the future.
+//
+// The zero value matches no route: its Handle is nil and it has no params.
+type Match struct {
+	// Method is the method the route is registered for, which differs from
+	// the request method for routes of the router's MethodFallback.
+	Method string
+
+	// Path is the registered path of the route.
+	Path string
+
+	Handle http.Handler
+	Params Params
+
+	// TSR indicates whether a redirection to the same path with an extra /
+	// without the trailing slash should be performed, if no route matched.
+	// It is only set by Router.Match.
+	TSR bool
+}
+
+// LookupAll returns all routes matching the given method and path, in order of
+// precedence, including the routes of the router's MethodFallback for the
+// method, or the GET routes for HEAD if HandleHEADForGET is enabled. The first
+// route is the one a request is routed to, the others are shadowed by it.
+// Unlike Lookup, it does not stop at the first match, e.g.
+// /files/a.json matches both /files/:name.:ext and the shadowed /files/:name.
+//
+// LookupAll is meant for debugging and introspection, it is slower than
+// Lookup.
+func (r *Router) LookupAll(method, path string) []Match {
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	methods := []string{method}
+	if fallback, ok := r.fallbackMethod(method); ok {
+		methods = append(methods, fallback)
+	}
+
+	var matches []Match
+	for _, method := range methods {
+		root := r.trees[method]
+		if root == nil {
+			continue
+		}
+
+		root.getAll(path, nil, func(leaf *node, ps Params) {
+			matches = append(matches, Match{
+				Method: method,
+				Path:   leaf.fullPath,
+				Handle: leaf.handle,
+				Params: ps,
+			})
+		})
+	}
+	return matches
+}
+
+// ExpectedRoute describes a request and the registered path it is expected to
+// match, for use with Validate.
+type ExpectedRoute struct {
+	Method      string
+	Path        string
+	WantPattern string
+}
+
+// Validate looks up each of the expected routes and returns an error for every
+// request that does not match the registered path it is expected to. It
+// returns nil if all requests match.
+//
+// This is useful to guard a route table against accidental changes in tests.
+func (r *Router) Validate(expect []ExpectedRoute) []error {
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	var errs []error
+	for _, e := range expect {
+		var pattern string
+		if root := r.trees[e.Method]; root != nil {
+			if leaf, _, _ := root.getLeaf(e.Path); leaf != nil {
+				pattern = leaf.fullPath
+			}
+		}
+
+		switch {
+		case pattern == e.WantPattern:
+		case pattern == "":
+			errs = append(errs, fmt.Errorf("%s '%s' matched no route, want '%s'",
+				e.Method, e.Path, e.WantPattern))
+		default:
+			errs = append(errs, fmt.Errorf("%s '%s' matched '%s', want '%s'",
+				e.Method, e.Path, pattern, e.WantPattern))
+		}
+	}
+	return errs
+}
+
+// MethodsFor returns the sorted list of methods with a handle registered for
+// the given path. The path may either be a request path or a registered path
+// with parameters, e.g. "/user/gopher" or "/user/:name".
+// Unlike the "Allow" header, OPTIONS is only included if a handle is
+// registered for it.
+func (r *Router) MethodsFor(path string) []string {
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	var methods []string
+	for method, root := range r.trees {
+		if leaf, _, _ := root.getLeaf(path); leaf != nil || root.findLeaf(path) != nil {
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// MatchCounts returns the number of times each route has been matched, keyed
+// by the method and the registered path separated by a space, e.g.
+// "GET /user/:name". Matches are only counted while CountMatches is enabled.
+func (r *Router) MatchCounts() map[string]uint64 {
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	counts := make(map[string]uint64)
+	for method, root := range r.trees {
+		root.walk(func(n *node) {
+			counts[method+" "+n.fullPath] = atomic.LoadUint64(&n.hits)
+		})
+	}
+	return counts
+}
+
+// Walk calls fn for every registered route, ordered by method and then by
+// path. The path passed to fn is the path the route was registered with,
+// including its ":name" and "*name" segments, constraints and optional params,
+// e.g. "/user/:id(\d+)" or "/items/:id?". Walk stops and returns the error if
+// fn returns a non-nil error.
+//
+// The routes are collected before fn is called, so fn may register routes.
+func (r *Router) Walk(fn func(method, path string, handle http.Handler) error) error {
+	for _, route := range r.walkRoutes() {
+		if err := fn(route.method, route.path, route.handle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkRoutes returns the registered routes in the order they are passed to
+// the function of Walk.
+func (r *Router) walkRoutes() []registration {
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	methods := make([]string, 0, len(r.trees))
+	for method := range r.trees {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	var routes []registration
+	for _, method := range methods {
+		r.trees[method].walkPaths(func(n *node) error {
+			// a path with an optional param is reported once, by the
+			// leaf with the param
+			if n.optional == "" {
+				routes = append(routes, registration{method: method, path: n.pattern, handle: n.handle})
+			}
+			return nil
+		})
+	}
+	return routes
+}
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Name   string `json:"name,omitempty"`
+
+	// Meta is the operation attached to the route with HandleOp, if any.
+	Meta *OperationMeta `json:"meta,omitempty"`
+}
+
+// Routes returns all registered routes, sorted by path and method.
+func (r *Router) Routes() []RouteInfo {
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	var routes []RouteInfo
+	for method, root := range r.trees {
+		root.walk(func(n *node) {
+			if n.optional != "" {
+				return
+			}
+
+			info := RouteInfo{
+				Method: method,
+				Path:   n.pattern,
+				Name:   r.pathNames[n.fullPath],
+			}
+			if op, ok := r.operations[method+" "+n.fullPath]; ok {
+				info.Meta = &op
+			}
+			routes = append(routes, info)
+		})
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// ExportJSON returns the registered routes as returned by Routes as a JSON
+// array. The output only depends on the registered routes, so it can be
+// compared across versions.
+func (r *Router) ExportJSON() ([]byte, error) {
+	routes := r.Routes()
+	if routes == nil {
+		routes = []RouteInfo{}
+	}
+	return json.Marshal(routes)
+}
+
+// WouldRedirectFixed reports whether a request with the given method and path
+// would be redirected because of RedirectFixedPath, and returns the location
+// it would be redirected to. The request is routed like by Classify, so paths
+// served by a route, e.g. because of CaseInsensitive, are not reported, and
+// RedirectInterceptors are called with a request without headers.
+func (r *Router) WouldRedirectFixed(method, path string) (string, bool) {
+	req := classifyRequest(method, path)
+
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	if _, o, fixed := r.classify(req, nil); fixed {
+		return o.Location, true
+	}
+	return "", false
+}
+
+// allowMethod reports whether method may be listed in the "Allow" header of
+// the response to a reqMethod request.
+func (r *Router) allowMethod(method, reqMethod string) bool {
+	if method == http.MethodOptions {
+		// If HandleOptions is disabled, OPTIONS is listed like any other
+		// method, otherwise it is always added at the end.
+		return !r.HandleOptions
+	}
+
+	return !r.HandleOptions || reqMethod != http.MethodOptions ||
+		r.OptionsMethodFilter == nil || r.OptionsMethodFilter(method)
+}
+
+// allowedMethods returns the methods which may be listed in the "Allow" header
+// of the response to a reqMethod request for path. OPTIONS is added at the end
+// if HandleOptions is enabled.
+func (r *Router) allowedMethods(path, reqMethod string) []string {
+	return r.methodsAllowed(path, reqMethod, func(method string, root *node) bool {
+		// Skip the requested method - we already tried this one
+		if method == reqMethod {
+			return false
+		}
+		leaf, _, _ := r.lookupLeaf(root, path, nil)
+		return leaf != nil
+	})
+}
+
+// methodsAllowed builds the allow set of allowedMethods and Resolve. match is
+// called with the tree of every method, including the filtered ones, and
+// reports whether path matches a route in it. The server-wide path "*" matches
+// every tree without calling match.
+func (r *Router) methodsAllowed(path, reqMethod string, match func(method string, root *node) bool) (methods []string) {
+	var get, head bool
+	for method, root := range r.trees {
+		if path != "*" && !match(method, root) {
+			continue
+		}
+		if !r.allowMethod(method, reqMethod) {
+			continue
+		}
+		methods = append(methods, method)
+
+		get = get || method == http.MethodGet
+		head = head || method == http.MethodHead
+	}
+	if get && !head && r.HandleHEADForGET && reqMethod != http.MethodHead &&
+		r.allowMethod(http.MethodHead, reqMethod) {
+		methods = append(methods, http.MethodHead)
+	}
+	if len(methods) > 0 && r.HandleOptions {
+		methods = append(methods, http.MethodOptions)
+	}
+	return
+}
+
+// AllowedMethods returns the sorted list of methods with a handle registered
+// for the given request path, as they are listed in the "Allow" header. OPTIONS
+// is included if HandleOptions is enabled. The path "*" lists the methods of
+// all routes, like the response to a server-wide OPTIONS request.
+// It returns nil if no handle is registered for the path.
+func (r *Router) AllowedMethods(path string) []string {
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	methods := r.allowedMethods(path, "")
+	sort.Strings(methods)
+	return methods
+}
+
+func (r *Router) redirectTarget(u *url.URL) string {
+	if r.NormalizeRedirectEscapes {
+		return upperEscapes(u.String())
+	}
+	return u.String()
+}
+
+// upperEscapes returns s with the hexadecimal digits of its percent-encodings
+// in uppercase.
+func upperEscapes(s string) string {
+	var buf []byte
+	for i := 0; i+2 < len(s); i++ {
+		if s[i] != '%' || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			continue
+		}
+
+		for j := i + 1; j <= i+2; j++ {
+			if c := s[j]; 'a' <= c && c <= 'f' {
+				if buf == nil {
+					buf = []byte(s)
+				}
+				buf[j] = c - 'a' + 'A'
+			}
+		}
+		i += 2
+	}
+
+	if buf == nil {
+		return s
+	}
+	return string(buf)
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func (r *Router) allowRedirect(req *http.Request, target string) bool {
+	for _, intercept := range r.RedirectInterceptors {
+		if !intercept(req, target) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasControlChars(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Router) serveDisabled(w http.ResponseWriter) {
+	code := r.DisabledStatus
+	if code == 0 {
+		code = http.StatusServiceUnavailable
+	}
+
+	body := r.DisabledBody
+	if body == "" {
+		body = http.StatusText(code)
+	}
+
+	http.Error(w, body, code)
+}
+
+// VersionParam is the name of the param holding the version segment of the
+// request path if the router's VersionPrefix is enabled.
+const VersionParam = "apiVersion"
+
+// FormatParam is the name of the param holding the format suffix of the
+// request path, without the dot, if it is one of the router's FormatSuffixes.
+const FormatParam = "format"
+
+// lookupLeaf returns the leaf of root matching path, like node.getLeaf, and
+// implements CaseInsensitive, FormatSuffixes and VersionPrefix unless the
+// router is Strict. The params are stored in buf if its capacity is
+// sufficient.
+func (r *Router) lookupLeaf(root *node, path string, buf Params) (leaf *node, ps Params, tsr bool) {
+	if r.Strict {
+		return root.getLeafBuf(path, buf, r.extraParams())
+	}
+
+	if leaf, ps, tsr = r.lookupFormat(root, path, buf); leaf == nil && r.CaseInsensitive {
+		// The case-corrected path keeps the case of the param values.
+		if ciPath, found := root.findCaseInsensitivePath(path, false); found {
+			return r.lookupFormat(root, string(ciPath), buf)
+		}
+	}
+	return
+}
+
+// lookupFormat implements FormatSuffixes for lookupLeaf.
+func (r *Router) lookupFormat(root *node, path string, buf Params) (leaf *node, ps Params, tsr bool) {
+	if format, rest := r.splitFormat(path); format != "" {
+		if leaf, ps, _ = r.lookupVersion(root, rest, buf); leaf != nil {
+			return leaf, append(ps, Param{FormatParam, format}), false
+		}
+	}
+	return r.lookupVersion(root, path, buf)
+}
+
+// extraParams returns the number of params appended by lookupLeaf to the
+// params of the matched route, for which room is reserved in advance.
+func (r *Router) extraParams() uint8 {
+	var extra uint8
+	if r.VersionPrefix {
+		extra++
+	}
+	if len(r.FormatSuffixes) > 0 {
+		extra++
+	}
+	return extra
+}
+
+// splitFormat splits a path ending with one of the router's FormatSuffixes,
+// e.g. /users/42.json, into the format, json, and the rest of the path,
+// /users/42. If the path has no such suffix, format is empty.
+func (r *Router) splitFormat(path string) (format, rest string) {
+	for _, suffix := range r.FormatSuffixes {
+		// the suffix must not be the whole last path segment
+		if n := len(path) - len(suffix); n > 0 && path[n:] == suffix && path[n-1] != '/' {
+			return strings.TrimPrefix(suffix, "."), path[:n]
+		}
+	}
+	return "", path
+}
+
+// lookupVersion returns the leaf of root matching path, like node.getLeaf, and
+// implements VersionPrefix.
+func (r *Router) lookupVersion(root *node, path string, buf Params) (leaf *node, ps Params, tsr bool) {
+	leaf, ps, tsr = root.getLeafBuf(path, buf, r.extraParams())
+	if !r.VersionPrefix {
+		return
+	}
+
+	version, rest := splitVersion(path)
+	if version == "" {
+		return
+	}
+
+	if leaf == nil {
+		var restTSR bool
+		leaf, ps, restTSR = root.getLeafBuf(rest, buf, r.extraParams())
+		tsr = tsr || restTSR
+	}
+	if leaf != nil {
+		ps = append(ps, Param{VersionParam, version})
+	}
+	return
+}
+
+// splitVersion splits a path beginning with a version segment, e.g. /v2/users,
+// into the version, v2, and the rest of the path, /users. If the path has no
+// version segment, version is empty.
+func splitVersion(path string) (version, rest string) {
+	if len(path) < 3 || path[0] != '/' || path[1] != 'v' {
+		return "", path
+	}
+
+	end := 2
+	for end < len(path) && '0' <= path[end] && path[end] <= '9' {
+		end++
+	}
+	if end == 2 || (end < len(path) && path[end] != '/') {
+		return "", path
+	}
+
+	if rest = path[end:]; rest == "" {
+		rest = "/"
+	}
+	return path[1:end], rest
+}
+
+// serveLeaf serves req with handle, which is registered with the given
+// pattern at leaf. They are read while the router is locked, as leaf may be
+// modified afterwards.
+func (r *Router) serveLeaf(w http.ResponseWriter, req *http.Request, leaf *node, handle http.Handler, pattern string, ps Params) {
+	if r.CountMatches {
+		atomic.AddUint64(&leaf.hits, 1)
+	}
+
+	if pr, ok := w.(patternRecorder); ok {
+		pr.recordPattern(pattern)
+	}
+
+	if atomic.LoadUint32(&leaf.disabled) != 0 {
+		r.serveDisabled(w)
+		return
+	}
+
+	if r.TransformParams != nil {
+		ps = r.TransformParams(ps)
+	}
+
+	if r.EmitCanonicalLink {
+		if canonical := expandPath(pattern, ps); canonical != req.URL.Path {
+			u := url.URL{Path: canonical}
+			w.Header().Set("Link", "<"+u.EscapedPath()+`>; rel="canonical"`)
+		}
+	}
+
+	if r.PatternHeader != "" {
+		w.Header().Set(r.PatternHeader, pattern)
+	}
+
+	if r.OnMatch != nil {
+		req = req.WithContext(r.OnMatch(req.Context(), pattern, ps))
+	}
+
+	// routes without params are served without allocating a context if
+	// their pattern is not needed
+	if len(ps) > 0 {
+		req = req.WithContext(&paramsContext{Context: req.Context(), ps: ps, pattern: pattern})
+	} else if !r.SkipStaticPattern {
+		req = req.WithContext(&paramsContext{Context: req.Context(), pattern: pattern})
+	}
+
+	handle.ServeHTTP(w, req)
+}
+
+func (r *Router) redirectCode(method string, trailingSlash bool) int {
+	if code, ok := r.RedirectCodes[method]; ok {
+		return code
+	}
+
+	code := r.RedirectFixedPathCode
+	if trailingSlash {
+		code = r.RedirectTrailingSlashCode
+	}
+	if code >= 300 && code <= 399 {
+		return code
+	}
+
+	if method == http.MethodGet {
+		if r.UsePermanentRedirect {
+			// Permanent redirect, request with same method
+			return http.StatusPermanentRedirect
+		}
+		return http.StatusMovedPermanently // Permanent redirect, request with GET method
+	}
+
+	if trailingSlash && r.PermanentTrailingSlashRedirect {
+		// Permanent redirect, request with same method
+		return http.StatusPermanentRedirect
+	}
+
+	// Temporary redirect, request with same method
+	return http.StatusTemporaryRedirect
+}
+
+// fallbackMethod returns the method whose routes are used for requests with
+// the given method if no route of its own matches, as configured with
+// MethodFallback and HandleHEADForGET.
+func (r *Router) fallbackMethod(method string) (string, bool) {
+	if fallback, ok := r.MethodFallback[method]; ok {
+		return fallback, true
+	}
+	if method == http.MethodHead && r.HandleHEADForGET {
+		return http.MethodGet, true
+	}
+	return "", false
+}
+
+// methodFallback returns the leaf of the route of the fallback method of
+// reqMethod matching path, or nil if there is none.
+func (r *Router) methodFallback(reqMethod, path string) (leaf *node, o Outcome) {
+	method, ok := r.fallbackMethod(reqMethod)
+	if !ok {
+		return nil, o
+	}
+
+	root := r.trees[method]
+	if root == nil {
+		return nil, o
+	}
+
+	leaf, ps, _ := r.lookupLeaf(root, path, nil)
+	if leaf == nil {
+		return nil, o
+	}
+	return r.matched(leaf, method, ps)
+}
+
+// ServeHTTP makes the router implement the http.Handler interface.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if h := r.subRouter(req); h != nil {
+		h.ServeHTTP(w, req)
+		return
+	}
+
+	r.serveHTTP(w, req)
+}
+
+// subRouter returns the handler for req if it is not served by r itself, i.e.
+// a Router registered with Host or Scheme, or the UnknownHost handler.
+func (r *Router) subRouter(req *http.Request) http.Handler {
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	if r.hosts != nil {
+		if hr := r.hostRouter(req); hr != nil {
+			return hr
+		} else if r.UnknownHost != nil {
+			return r.UnknownHost
+		}
+	}
+
+	if r.schemes != nil {
+		if sr := r.schemes[r.requestScheme(req)]; sr != nil {
+			return sr
+		}
+	}
+	return nil
+}
+
+func (r *Router) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.PanicHandler != nil || r.PanicResponse != nil || r.RecoverPanics {
+		defer r.recv(w, req)
+	}
+
+	if r.CORS != nil && isPreflight(req) && r.servePreflight(w, req) {
+		return
+	}
+
+	leaf, handle, o, pooled := r.routeLocked(req)
+	if pooled != nil && o.Kind != OutcomeMatched {
+		r.paramsPool.Put(pooled)
+		pooled = nil
+	}
+
+	switch o.Kind {
+	case OutcomeMatched:
+		if o.Method != req.Method {
+			req = req.WithContext(context.WithValue(req.Context(), EffectiveMethodKey, o.Method))
+
+			if req.Method == http.MethodHead && r.HandleHEADForGET {
+				w = headResponseWriter{w}
+			}
+		}
+		if req.Method == http.MethodOptions && r.HandleOptions {
+			req = r.withAllow(w, req)
+		}
+		r.serveLeaf(w, req, leaf, handle, o.Pattern, o.Params)
+
+		// not deferred, the params of a panicking handler may still be
+		// used by the PanicHandler
+		if pooled != nil {
+			r.paramsPool.Put(pooled)
+		}
+
+	case OutcomeRedirect:
+		if r.RedirectHandler != nil {
+			ctx := context.WithValue(req.Context(), RedirectKey, &RedirectInfo{
+				Path:   r.requestPath(req),
+				Target: o.Location,
+				Code:   o.Code,
+			})
+			r.RedirectHandler.ServeHTTP(w, req.WithContext(ctx))
+		} else {
+			http.Redirect(w, req, o.Location, o.Code)
+		}
+
+	case OutcomeSlashMismatch:
+		ctx := context.WithValue(req.Context(), CanonicalPathKey, o.Location)
+		r.SlashMismatchHandler.ServeHTTP(w, req.WithContext(ctx))
+
+	case OutcomeMethodNotAllowed:
+		if handle, ps := r.notAllowedHandle(req); handle != nil {
+			if ps != nil {
+				req = req.WithContext(&paramsContext{Context: req.Context(), ps: ps})
+			}
+			r.unmatchedChain(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Allow", strings.Join(o.Allow, ", "))
+				handle.ServeHTTP(w, req)
+			})).ServeHTTP(w, req)
+			return
+		}
+		fallthrough
+
+	default:
+		r.unmatchedChain(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			r.serveUnmatched(w, req, o)
+		})).ServeHTTP(w, req)
+	}
+}
+
+// unmatchedChain returns h wrapped by the middleware added with Use if
+// UseForUnmatched is enabled, otherwise h.
+func (r *Router) unmatchedChain(h http.Handler) http.Handler {
+	if mw := r.middlewareChain(); r.UseForUnmatched && len(mw) > 0 {
+		return wrapMiddleware(h, mw)
+	}
+	return h
+}
+
+// serveUnmatched writes the response for a request not matching any route,
+// i.e. the automatic OPTIONS response, 405, 400 or 404.
+func (r *Router) serveUnmatched(w http.ResponseWriter, req *http.Request, o Outcome) {
+	switch o.Kind {
+	case OutcomeOptions:
+		w.Header().Set("Allow", strings.Join(o.Allow, ", "))
+		if r.OptionsStatus != 0 {
+			w.WriteHeader(r.OptionsStatus)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+
+	case OutcomeMethodNotAllowed:
+		w.Header().Set("Allow", strings.Join(o.Allow, ", "))
+		if r.MethodNotAllowed != nil {
+			r.MethodNotAllowed.ServeHTTP(w, req)
+		} else {
+			http.Error(w,
+				http.StatusText(http.StatusMethodNotAllowed),
+				http.StatusMethodNotAllowed,
+			)
+		}
+
+	case OutcomeBadRequest:
+		http.Error(w,
+			http.StatusText(http.StatusBadRequest),
+			http.StatusBadRequest,
+		)
+
+	default:
+		// Handle 404
+		r.serveNotFound(w, req)
+	}
+}
+
+// withAllow sets the "Allow" header for a request handled by a custom OPTIONS
+// handler and returns req with the allowed methods stored in its context.
+func (r *Router) withAllow(w http.ResponseWriter, req *http.Request) *http.Request {
+	locked := r.rlock()
+	allow := r.allowedMethods(r.requestPath(req), req.Method)
+	if locked {
+		r.mu.RUnlock()
+	}
+
+	if len(allow) == 0 {
+		allow = []string{http.MethodOptions}
+	}
+	sort.Strings(allow)
+
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	return req.WithContext(context.WithValue(req.Context(), AllowKey, allow))
+}
+
+// headResponseWriter discards the body of responses to HEAD requests served by
+// GET routes because of HandleHEADForGET.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w headResponseWriter) recordPattern(pattern string) {
+	if pr, ok := w.ResponseWriter.(patternRecorder); ok {
+		pr.recordPattern(pattern)
+	}
+}
+
+// Flush implements http.Flusher if the wrapped http.ResponseWriter does.
+func (w headResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// routeLocked routes req like route, with the router locked for reading
+// unless it is sealed. If PoolParams is enabled, the params are stored in a
+// buffer from the pool, which is returned as well. The handle of the matched
+// leaf is read while locked, as the leaf may be modified afterwards.
+func (r *Router) routeLocked(req *http.Request) (leaf *node, handle http.Handler, o Outcome, pooled *Params) {
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	var buf Params
+	if r.PoolParams {
+		pooled = r.getParams()
+		buf = *pooled
+	}
+
+	if leaf, o = r.route(req, buf); leaf != nil {
+		handle = leaf.handle
+	}
+	return
+}
+
+// notAllowedHandle returns the handler registered with MethodNotAllowedFor
+// matching req and its params, or nil if there is none.
+func (r *Router) notAllowedHandle(req *http.Request) (http.Handler, Params) {
+	if r.rlock() {
+		defer r.mu.RUnlock()
+	}
+
+	if r.notAllowed == nil {
+		return nil, nil
+	}
+	handle, ps, _ := r.notAllowed.getValue(r.requestPath(req))
+	return handle, ps
+}
+
+// getParams returns a buffer for the params of a request from the pool.
+func (r *Router) getParams() *Params {
+	size := int(r.maxParams) + int(r.extraParams())
+	if ps, ok := r.paramsPool.Get().(*Params); ok && cap(*ps) >= size {
+		return ps
+	}
+
+	ps := make(Params, 0, size)
+	return &ps
+}
+
+// requestPath returns the path of req routes are matched against, which is the
+// escaped path if UseRawPath is enabled.
+func (r *Router) requestPath(req *http.Request) string {
+	if r.UseRawPath {
+		return req.URL.EscapedPath()
+	}
+	return req.URL.Path
+}
+
+// matched returns the outcome of a request matching the route of the given
+// leaf and method. It implements UnescapeParams.
+func (r *Router) matched(leaf *node, method string, ps Params) (*node, Outcome) {
+	if r.UnescapeParams && !unescapeParams(ps) && r.StrictUnescapeParams {
+		return nil, Outcome{Kind: OutcomeNotFound}
+	}
+	return leaf, Outcome{Kind: OutcomeMatched, Method: method, Pattern: leaf.fullPath, Params: ps}
+}
+
+// unescapeParams replaces the values of ps with their percent-decoded value.
+// Invalid values are kept and false is returned.
+func unescapeParams(ps Params) bool {
+	ok := true
+	for i := range ps {
+		if strings.IndexByte(ps[i].Value, '%') < 0 {
+			continue
+		}
+		if value, err := url.PathUnescape(ps[i].Value); err == nil {
+			ps[i].Value = value
+		} else {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// route decides how req is routed without serving it. The leaf is only set
+// for OutcomeMatched.
+func (r *Router) route(req *http.Request, buf Params) (*node, Outcome) {
+	leaf, o, _ := r.classify(req, buf)
+	return leaf, o
+}
+
+// classify is route, additionally reporting whether the outcome is a redirect
+// because of RedirectFixedPath.
+func (r *Router) classify(req *http.Request, buf Params) (leaf *node, o Outcome, fixed bool) {
+	path := r.requestPath(req)
+
+	// the decoded path, even if the escaped one is routed because of
+	// UseRawPath
+	if r.RejectControlChars && hasControlChars(req.URL.Path) {
+		return nil, Outcome{Kind: OutcomeBadRequest}, false
+	}
+
+	if root := r.trees[req.Method]; root != nil {
+		if leaf, ps, tsr := r.lookupLeaf(root, path, buf); leaf != nil {
+			leaf, o := r.matched(leaf, req.Method, ps)
+			return leaf, o, false
+		} else if leaf, o := r.methodFallback(req.Method, path); leaf != nil {
+			return leaf, o, false
+		} else if !r.Strict && req.Method != http.MethodConnect && path != "/" {
+			if tsr && r.RedirectTrailingSlash {
+				u := *req.URL
+				u.Path = toggleTrailingSlash(u.Path)
+				if u.RawPath != "" {
+					u.RawPath = toggleTrailingSlash(u.RawPath)
+				}
+				if target := r.barePrefixTarget(root, req.Method, path); target != "" {
+					u.Path, u.RawPath = target, ""
+				}
+
+				if target := r.redirectTarget(&u); r.allowRedirect(req, target) {
+					return nil, Outcome{Kind: OutcomeRedirect, Location: target, Code: r.redirectCode(req.Method, true)}, false
+				}
+			}
+
+			// Try to fix the request path
+			if r.RedirectFixedPath {
+				fixedPath, found := root.findCaseInsensitivePath(
+					CleanPath(path),
+					r.RedirectTrailingSlash,
+				)
+				if found {
+					u := *req.URL
+					u.Path = string(fixedPath)
+					if path != req.URL.Path {
+						// the fixed path is escaped like the request path
+						u.RawPath = u.Path
+						u.Path, _ = url.PathUnescape(u.RawPath)
+					}
+
+					if target := r.redirectTarget(&u); r.allowRedirect(req, target) {
+						return nil, Outcome{Kind: OutcomeRedirect, Location: target, Code: r.redirectCode(req.Method, false)}, true
+					}
+				}
+			}
+
+			if tsr && !r.RedirectTrailingSlash && r.SlashMismatchHandler != nil {
+				return nil, Outcome{Kind: OutcomeSlashMismatch, Location: toggleTrailingSlash(path)}, false
+			}
+		}
+	} else if leaf, o := r.methodFallback(req.Method, path); leaf != nil {
+		return leaf, o, false
+	}
+
+	if req.Method == http.MethodOptions && r.HandleOptions {
+		// Handle OPTIONS requests
+		if allow := r.allowedMethods(path, req.Method); len(allow) > 0 {
+			return nil, Outcome{Kind: OutcomeOptions, Allow: allow}, false
+		}
+	} else if r.HandleMethodNotAllowed {
+		// Handle 405
+		if allow := r.allowedMethods(path, req.Method); len(allow) > 0 {
+			return nil, Outcome{Kind: OutcomeMethodNotAllowed, Allow: allow}, false
+		}
+	}
+
+	return nil, Outcome{Kind: OutcomeNotFound}, false
+}
+
+// toggleTrailingSlash returns path with the trailing slash removed, or added
+// if it has none.
+func toggleTrailingSlash(path string) string {
+	if len(path) > 1 && path[len(path)-1] == '/' {
+		return path[:len(path)-1]
+	}
+	return path + "/"
+}
+
+func (r *Router) serveNotFound(w http.ResponseWriter, req *http.Request) {
+	if r.OnNotFound != nil {
+		r.OnNotFound(req)
+	}
+
+	if r.NotFound != nil {
+		if r.NotFoundPathParam {
+			req = req.WithContext(&paramsContext{Context: req.Context(), ps: Params{{"path", req.URL.Path}}})
+		}
+
 		r.NotFound.ServeHTTP(w, req)
 	} else {
 		http.NotFound(w, req)
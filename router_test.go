@@ -5,11 +5,22 @@
 package httprouter
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -43,6 +54,16 @@ func TestParams(t *testing.T) {
 	if val := ps.ByName("noKey"); val != "" {
 		t.Errorf("Expected empty string for not found key; got: %s", val)
 	}
+
+	if !ps.Has("param2") {
+		t.Error("Expected existing key param2 to be present")
+	}
+	if ps.Has("noKey") {
+		t.Error("Expected not found key to be absent")
+	}
+	if ps := (Params{Param{"empty", ""}}); !ps.Has("empty") {
+		t.Error("Expected key with empty value to be present")
+	}
 }
 
 func TestRouter(t *testing.T) {
@@ -114,6 +135,14 @@ func TestRouterAPI(t *testing.T) {
 			head = true
 		}
 	}))
+	router.Update("/UPDATE", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			put = true
+		case http.MethodPatch:
+			patch = true
+		}
+	}))
 	router.Handle(http.MethodGet, "/Handler", httpHandler)
 	router.HandlerFunc(http.MethodGet, "/HandlerFunc", func(w http.ResponseWriter, r *http.Request) {
 		handlerFunc = true
@@ -177,6 +206,20 @@ func TestRouterAPI(t *testing.T) {
 		t.Error("routing HEAD failed")
 	}
 
+	put, patch = false, false
+
+	r, _ = http.NewRequest(http.MethodPut, "/UPDATE", nil)
+	router.ServeHTTP(w, r)
+	if !put {
+		t.Error("routing PUT failed")
+	}
+
+	r, _ = http.NewRequest(http.MethodPatch, "/UPDATE", nil)
+	router.ServeHTTP(w, r)
+	if !patch {
+		t.Error("routing PATCH failed")
+	}
+
 	r, _ = http.NewRequest(http.MethodGet, "/Handler", nil)
 	router.ServeHTTP(w, r)
 	if !handler {
@@ -190,6 +233,61 @@ func TestRouterAPI(t *testing.T) {
 	}
 }
 
+func TestRouterDeferRegistration(t *testing.T) {
+	var handled bool
+	handler := handlerStruct{&handled}
+	routes := []string{
+		"/",
+		"/cmd/:tool/:sub",
+		"/cmd/:tool/",
+		"/src/*filepath",
+		"/search/",
+		"/search/:query",
+		"/user_:name",
+		"/user_:name/about",
+		"/doc/",
+		"/doc/go_faq.html",
+		"/doc/go1.html",
+	}
+
+	router1 := New()
+	router1.DeferRegistration = true
+	for _, route := range routes {
+		router1.Get(route, handler)
+	}
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest(http.MethodGet, "/doc/go1.html", nil)
+	router1.ServeHTTP(w, r)
+	if handled {
+		t.Fatal("routed before Compile")
+	}
+
+	router1.Compile()
+	router1.ServeHTTP(w, r)
+	if !handled {
+		t.Fatal("routing failed after Compile")
+	}
+
+	router2 := New()
+	router2.DeferRegistration = true
+	for i := len(routes) - 1; i >= 0; i-- {
+		router2.Get(routes[i], handler)
+	}
+	router2.Compile()
+
+	if !reflect.DeepEqual(router1.trees, router2.trees) {
+		t.Error("trees depend on registration order")
+	}
+
+	router2.DeferRegistration = true
+	router2.Get("/cmd/vet", handler)
+	recv := catchPanic(router2.Compile)
+	if recv == nil {
+		t.Error("compiling conflicting route did not panic")
+	}
+}
+
 func TestRouterRoot(t *testing.T) {
 	router := New()
 	recv := catchPanic(func() {
@@ -242,6 +340,67 @@ func TestRouterChaining(t *testing.T) {
 	}
 }
 
+func TestRouterScheme(t *testing.T) {
+	var redirected, app bool
+	router := New()
+	router.Get("/*path", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app = true
+	}))
+	router.Post("/form", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	router.Scheme("HTTP").Get("/*path", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	}))
+
+	if router.Scheme("http") != router.Scheme("HTTP") {
+		t.Error("Scheme returned a different router for the same scheme")
+	}
+
+	recv := catchPanic(func() {
+		router.Scheme("ftp")
+	})
+	if recv == nil {
+		t.Error("registering invalid scheme did not panic")
+	}
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest(http.MethodGet, "/path", nil)
+	router.ServeHTTP(w, r)
+	if !redirected || app {
+		t.Error("routing http request failed")
+	}
+
+	redirected = false
+	r.TLS = new(tls.ConnectionState)
+	router.ServeHTTP(w, r)
+	if redirected || !app {
+		t.Error("routing https request failed")
+	}
+
+	// X-Forwarded-Proto is only trusted when enabled
+	app = false
+	r, _ = http.NewRequest(http.MethodGet, "/path", nil)
+	r.Header.Set("X-Forwarded-Proto", "https")
+	router.ServeHTTP(w, r)
+	if !redirected || app {
+		t.Error("routing forwarded request failed")
+	}
+
+	redirected = false
+	router.TrustForwardedProto = true
+	router.ServeHTTP(w, r)
+	if redirected || !app {
+		t.Error("routing forwarded request failed")
+	}
+
+	// unmatched requests fall back to the scheme-agnostic routes
+	r, _ = http.NewRequest(http.MethodPost, "/form", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, r)
+	if !(rec.Code == http.StatusOK) {
+		t.Errorf("fallback routing failed: Code=%d, Header=%v", rec.Code, rec.Header())
+	}
+}
+
 func TestRouterOPTIONS(t *testing.T) {
 	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
 
@@ -302,8 +461,11 @@ func TestRouterOPTIONS(t *testing.T) {
 
 	// custom handler
 	var custom bool
+	var allow []string
 	router.Options("/path", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		custom = true
+		allow = GetAllow(r.Context())
+		w.Header().Add("Allow", "PATCH")
 	}))
 
 	// test again
@@ -330,6 +492,131 @@ func TestRouterOPTIONS(t *testing.T) {
 	if !custom {
 		t.Error("custom handler not called")
 	}
+	if want := []string{"GET", "OPTIONS", "POST"}; !reflect.DeepEqual(allow, want) {
+		t.Errorf("unexpected allowed methods for custom handler: got %v, want %v", allow, want)
+	}
+	if got := w.Header()["Allow"]; !reflect.DeepEqual(got, []string{"GET, OPTIONS, POST", "PATCH"}) {
+		t.Errorf("unexpected Allow header for custom handler: %q", got)
+	}
+
+	// methods are not set for other requests
+	allow = nil
+	router.Get("/allow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allow = GetAllow(r.Context())
+	}))
+	r, _ = http.NewRequest(http.MethodGet, "/allow", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if allow != nil || w.Header().Get("Allow") != "" {
+		t.Errorf("unexpected allowed methods for GET request: %v", allow)
+	}
+}
+
+func TestRouterOptionsStatus(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Get("/path", handlerFunc)
+
+	for _, test := range []struct {
+		status, code int
+	}{
+		{0, http.StatusOK},
+		{http.StatusNoContent, http.StatusNoContent},
+	} {
+		router.OptionsStatus = test.status
+		for _, path := range []string{"*", "/path"} {
+			r, _ := http.NewRequest(http.MethodOptions, path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != test.code || w.Header().Get("Allow") != "GET, OPTIONS" || w.Body.Len() != 0 {
+				t.Errorf("OptionsStatus %d, OPTIONS %s: got %d, Allow %q, body %q, want %d",
+					test.status, path, w.Code, w.Header().Get("Allow"), w.Body.String(), test.code)
+			}
+		}
+	}
+}
+
+func TestRouterOPTIONSDisabled(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.HandleOptions = false
+	router.OptionsMethodFilter = func(method string) bool { return false }
+	router.Get("/path", handlerFunc)
+	router.Post("/path", handlerFunc)
+	router.Options("/options", handlerFunc)
+	router.Get("/options", handlerFunc)
+
+	for _, test := range []struct {
+		method, path string
+		code         int
+		allow        []string
+	}{
+		// no automatic replies, OPTIONS requests are answered with 405
+		{http.MethodOptions, "*", http.StatusMethodNotAllowed, []string{"GET", "OPTIONS", "POST"}},
+		{http.MethodOptions, "/path", http.StatusMethodNotAllowed, []string{"GET", "POST"}},
+		{http.MethodOptions, "/doesnotexist", http.StatusNotFound, nil},
+		// OPTIONS routes are matched like other routes
+		{http.MethodOptions, "/options", http.StatusOK, nil},
+		// and are listed in the Allow header only if they are registered
+		{http.MethodPost, "/options", http.StatusMethodNotAllowed, []string{"GET", "OPTIONS"}},
+		{http.MethodPut, "/path", http.StatusMethodNotAllowed, []string{"GET", "POST"}},
+	} {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		var allow []string
+		if header := w.Header().Get("Allow"); header != "" {
+			allow = strings.Split(header, ", ")
+			sort.Strings(allow)
+		}
+		if w.Code != test.code || !reflect.DeepEqual(allow, test.allow) {
+			t.Errorf("%s %s failed: Code=%d, Allow=%v", test.method, test.path, w.Code, allow)
+		}
+	}
+}
+
+func TestRouterOptionsMethodFilter(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Get("/path", handlerFunc)
+	router.Post("/path", handlerFunc)
+	router.OptionsMethodFilter = func(method string) bool {
+		return method == http.MethodGet
+	}
+
+	for _, path := range []string{"*", "/path"} {
+		r, _ := http.NewRequest(http.MethodOptions, path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if !(w.Code == http.StatusOK) {
+			t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+		} else if allow := w.Header().Get("Allow"); allow != "GET, OPTIONS" {
+			t.Error("unexpected Allow header value: " + allow)
+		}
+	}
+
+	// the filter must not apply to 405 responses
+	r, _ := http.NewRequest(http.MethodPut, "/path", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !(w.Code == http.StatusMethodNotAllowed) {
+		t.Errorf("NotAllowed handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	} else if allow := w.Header().Get("Allow"); allow != "GET, POST, OPTIONS" && allow != "POST, GET, OPTIONS" {
+		t.Error("unexpected Allow header value: " + allow)
+	}
+
+	// no methods remaining
+	router.OptionsMethodFilter = func(string) bool { return false }
+	r, _ = http.NewRequest(http.MethodOptions, "/path", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !(w.Code == http.StatusNotFound) {
+		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
 }
 
 func TestRouterNotAllowed(t *testing.T) {
@@ -362,7 +649,22 @@ func TestRouterNotAllowed(t *testing.T) {
 		t.Error("unexpected Allow header value: " + allow)
 	}
 
+	// test shared PUT and PATCH handler
+	rt := router.Update("/update", handlerFunc)
+	if want := []string{http.MethodPut, http.MethodPatch}; !reflect.DeepEqual(rt.methods, want) {
+		t.Errorf("Update returned a route for %v, want %v", rt.methods, want)
+	}
+	r, _ = http.NewRequest(http.MethodGet, "/update", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !(w.Code == http.StatusMethodNotAllowed) {
+		t.Errorf("NotAllowed handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	} else if allow := w.Header().Get("Allow"); allow != "PUT, PATCH, OPTIONS" && allow != "PATCH, PUT, OPTIONS" {
+		t.Error("unexpected Allow header value: " + allow)
+	}
+
 	// test custom handler
+	r, _ = http.NewRequest(http.MethodGet, "/path", nil)
 	w = httptest.NewRecorder()
 	responseText := "custom method"
 	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -426,6 +728,19 @@ func TestRouterNotFound(t *testing.T) {
 		t.Errorf("Custom NotFound handler failed: Code=%d, Header=%v", w.Code, w.Header())
 	}
 
+	// Test the request path passed to the custom not found handler
+	var notFoundPath string
+	router.NotFoundPathParam = true
+	router.NotFound = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		notFoundPath = GetValue(r.Context(), "path")
+	})
+	r, _ = http.NewRequest(http.MethodGet, "/nope/nothing", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if notFoundPath != "/nope/nothing" {
+		t.Errorf("unexpected path param got %q want %q", notFoundPath, "/nope/nothing")
+	}
+
 	// Test other method than GET (want 307 instead of 301)
 	router.Patch("/path", handlerFunc)
 	r, _ = http.NewRequest(http.MethodPatch, "/path/", nil)
@@ -446,119 +761,2809 @@ func TestRouterNotFound(t *testing.T) {
 	}
 }
 
-func TestRouterPanicHandler(t *testing.T) {
+func TestRouterTransformParams(t *testing.T) {
 	router := New()
-	panicHandled := false
-
-	router.PanicHandler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		panicHandled = GetPanic(r.Context()) == "oops!"
-	})
+	router.TransformParams = func(ps Params) Params {
+		for i := range ps {
+			ps[i].Value = strings.ToLower(strings.TrimSpace(ps[i].Value))
+		}
+		return ps
+	}
 
-	router.Put("/user/:name", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
-		panic("oops!")
+	var ps Params
+	router.Get("/user/:name", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ps = GetParams(r.Context())
 	}))
 
 	w := new(mockResponseWriter)
-	req, _ := http.NewRequest(http.MethodPut, "/user/gopher", nil)
-
-	defer func() {
-		if rcv := recover(); rcv != nil {
-			t.Fatal("handling panic failed")
-		}
-	}()
-
-	router.ServeHTTP(w, req)
+	r, _ := http.NewRequest(http.MethodGet, "/user/%20Gopher%20", nil)
+	router.ServeHTTP(w, r)
 
-	if !panicHandled {
-		t.Fatal("simulating failed")
+	want := Params{Param{"name", "gopher"}}
+	if !reflect.DeepEqual(ps, want) {
+		t.Fatalf("wrong wildcard values: want %v, got %v", want, ps)
 	}
 }
 
-func TestRouterLookup(t *testing.T) {
-	routed := false
-	wantHandle := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+func TestRouterDisable(t *testing.T) {
+	var routed bool
+	router := New()
+	router.Get("/user/:name", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		routed = true
+	}))
+
+	recv := catchPanic(func() {
+		router.Disable(http.MethodGet, "/nope")
 	})
-	wantParams := Params{Param{"name", "gopher"}}
+	if rerr, ok := recv.(*RegistrationError); !ok || rerr.Kind != KindNotFound || rerr.Method != http.MethodGet {
+		t.Fatalf("disabling unregistered path: got panic %v", recv)
+	}
 
-	router := New()
+	router.Disable(http.MethodGet, "/user/:name")
 
-	// try empty router first
-	handle, _, tsr := router.Lookup(http.MethodGet, "/nope")
-	if handle != nil {
-		t.Fatalf("Got handle for unregistered pattern: %v", handle)
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if routed {
+		t.Error("disabled route was routed")
 	}
-	if tsr {
-		t.Error("Got wrong TSR recommendation!")
+	if !(w.Code == http.StatusServiceUnavailable) {
+		t.Errorf("unexpected response code %d want %d", w.Code, http.StatusServiceUnavailable)
 	}
 
-	// insert route and try again
-	router.Get("/user/:name", wantHandle)
-
-	handle, params, tsr := router.Lookup(http.MethodGet, "/user/gopher")
-	if handle == nil {
-		t.Fatal("Got no handle!")
-	} else {
-		handle.ServeHTTP(nil, nil)
-		if !routed {
-			t.Fatal("Routing failed!")
-		}
+	router.DisabledStatus = http.StatusTeapot
+	router.DisabledBody = "down for maintenance"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !(w.Code == http.StatusTeapot) {
+		t.Errorf("unexpected response code %d want %d", w.Code, http.StatusTeapot)
+	}
+	if got := w.Body.String(); got != "down for maintenance\n" {
+		t.Errorf("unexpected response got %q want %q", got, "down for maintenance\n")
 	}
 
-	if !reflect.DeepEqual(params, wantParams) {
-		t.Fatalf("Wrong parameter values: want %v, got %v", wantParams, params)
+	router.Enable(http.MethodGet, "/user/:name")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !routed {
+		t.Error("re-enabled route was not routed")
 	}
 
-	handle, _, tsr = router.Lookup(http.MethodGet, "/user/gopher/")
-	if handle != nil {
-		t.Fatalf("Got handle for unregistered pattern: %v", handle)
+	// a path with an optional param is disabled by its registered path
+	router.Get(`/items/:id(\d+)?`, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, disabled := range []bool{true, false} {
+		if disabled {
+			router.Disable(http.MethodGet, `/items/:id(\d+)?`)
+		} else {
+			router.Enable(http.MethodGet, "/items/:id?")
+		}
+		for _, path := range []string{"/items", "/items/42"} {
+			r, _ := http.NewRequest(http.MethodGet, path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if got := w.Code != http.StatusOK; got != disabled {
+				t.Errorf("GET %s: got %d with the route disabled %t", path, w.Code, disabled)
+			}
+		}
 	}
-	if !tsr {
-		t.Error("Got no TSR recommendation!")
+}
+
+func TestRouterWouldRedirectFixed(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Get("/path", handlerFunc)
+	router.Get("/dir/", handlerFunc)
+
+	for _, test := range []struct {
+		method, path string
+		fixed        string
+		found        bool
+	}{
+		{http.MethodGet, "/PATH", "/path", true},
+		{http.MethodGet, "/../path", "/path", true},
+		{http.MethodGet, "/DIR", "/dir/", true},
+		{http.MethodGet, "/path", "", false},  // exact match
+		{http.MethodGet, "/path/", "", false}, // TSR
+		{http.MethodGet, "/nope", "", false},
+		{http.MethodPost, "/PATH", "", false},
+	} {
+		fixed, found := router.WouldRedirectFixed(test.method, test.path)
+		if fixed != test.fixed || found != test.found {
+			t.Errorf("wrong result for %s %s: got %q, %t; want %q, %t",
+				test.method, test.path, fixed, found, test.fixed, test.found)
+		}
 	}
 
-	handle, _, tsr = router.Lookup(http.MethodGet, "/nope")
-	if handle != nil {
-		t.Fatalf("Got handle for unregistered pattern: %v", handle)
+	// paths served by a route are not redirected
+	router.CaseInsensitive = true
+	if fixed, found := router.WouldRedirectFixed(http.MethodGet, "/PATH"); found {
+		t.Errorf("unexpected fixed path %q with CaseInsensitive enabled", fixed)
 	}
-	if tsr {
-		t.Error("Got wrong TSR recommendation!")
+	if o := router.Classify(http.MethodGet, "/PATH"); o.Kind != OutcomeMatched {
+		t.Errorf("GET /PATH with CaseInsensitive enabled: got %v, want %v", o.Kind, OutcomeMatched)
 	}
-}
+	router.CaseInsensitive = false
 
-type mockFileSystem struct {
-	opened bool
+	router.RedirectFixedPath = false
+	if fixed, found := router.WouldRedirectFixed(http.MethodGet, "/PATH"); found {
+		t.Errorf("unexpected fixed path %q with RedirectFixedPath disabled", fixed)
+	}
 }
 
-func (mfs *mockFileSystem) Open(name string) (http.File, error) {
-	mfs.opened = true
-	return nil, errors.New("this is just a mock")
-}
+func TestRouterRedirectInterceptors(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
 
-func TestRouterServeFiles(t *testing.T) {
 	router := New()
-	mfs := &mockFileSystem{}
+	router.Get("/path", handlerFunc)
 
-	recv := catchPanic(func() {
-		router.ServeFiles("/noFilepath", mfs)
-	})
-	if recv == nil {
-		t.Fatal("registering path not ending with '*filepath' did not panic")
+	var targets []string
+	router.RedirectInterceptors = []func(*http.Request, string) bool{
+		func(req *http.Request, target string) bool {
+			targets = append(targets, target)
+			return true
+		},
+		func(req *http.Request, target string) bool {
+			return req.URL.Path != "/PATH"
+		},
 	}
 
-	router.ServeFiles("/*filepath", mfs)
-	w := new(mockResponseWriter)
-	r, _ := http.NewRequest(http.MethodGet, "/favicon.ico", nil)
-	router.ServeHTTP(w, r)
-	if !mfs.opened {
-		t.Error("serving file failed")
+	testRoutes := []struct {
+		route string
+		code  int
+	}{
+		{"/path/", http.StatusMovedPermanently}, // TSR
+		{"/PATH", http.StatusNotFound},          // Fixed Case, cancelled
 	}
-
-	mfs.opened = false
-
-	r, _ = http.NewRequest(http.MethodHead, "/favicon.ico", nil)
-	router.ServeHTTP(w, r)
+	for _, tr := range testRoutes {
+		r, _ := http.NewRequest(http.MethodGet, tr.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tr.code {
+			t.Errorf("redirect interception for route %s failed: Code=%d, Header=%v", tr.route, w.Code, w.Header())
+		}
+	}
+
+	if want := []string{"/path", "/path"}; !reflect.DeepEqual(targets, want) {
+		t.Errorf("wrong redirect targets: want %v, got %v", want, targets)
+	}
+}
+
+func TestRouterStrict(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Strict = true
+	router.CaseInsensitive = true
+	router.VersionPrefix = true
+	router.FormatSuffixes = []string{".json"}
+	router.Get("/path", handlerFunc)
+	router.Get("/dir/", handlerFunc)
+	router.Get("/user/:name", handlerFunc)
+
+	testRoutes := []struct {
+		route string
+		code  int
+	}{
+		{"/path", http.StatusOK},
+		{"/dir/", http.StatusOK},
+		{"/user/gopher", http.StatusOK},
+		{"/path/", http.StatusNotFound},        // TSR -/
+		{"/dir", http.StatusNotFound},          // TSR +/
+		{"/PATH", http.StatusNotFound},         // Fixed Case
+		{"/../path", http.StatusNotFound},      // CleanPath
+		{"/user/gopher/", http.StatusNotFound}, // TSR -/
+		{"/USER/gopher", http.StatusNotFound},  // CaseInsensitive
+		{"/v2/path", http.StatusNotFound},      // VersionPrefix
+		{"/path.json", http.StatusNotFound},    // FormatSuffixes
+	}
+	for _, tr := range testRoutes {
+		r, _ := http.NewRequest(http.MethodGet, tr.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tr.code {
+			t.Errorf("strict routing of %s failed: Code=%d, Header=%v", tr.route, w.Code, w.Header())
+		}
+	}
+}
+
+func TestRouterRejectControlChars(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Get("/user/:name", handlerFunc)
+
+	r := httptest.NewRequest(http.MethodGet, "/user/gopher", nil)
+	r.URL.Path = "/user/go\x00pher"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("unexpected response code %d want %d", w.Code, http.StatusOK)
+	}
+
+	router.RejectControlChars = true
+	for _, path := range []string{"/user/go\x00pher", "/user/go\npher", "/user/go\x1fpher"} {
+		r.URL.Path = path
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("unexpected response code %d want %d for path %q", w.Code, http.StatusBadRequest, path)
+		}
+	}
+
+	r.URL.Path = "/user/gopher"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("unexpected response code %d want %d", w.Code, http.StatusOK)
+	}
+
+	// the escaped path routed with UseRawPath has no control characters
+	router.UseRawPath = true
+	router.UnescapeParams = true
+	r, _ = http.NewRequest(http.MethodGet, "/user/go%00pher", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unexpected response code %d want %d for escaped NUL", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRouterMethodFallback(t *testing.T) {
+	var get, report, effective string
+	router := New()
+	router.MethodFallback = map[string]string{
+		http.MethodHead: http.MethodGet,
+		"REPORT":        http.MethodGet,
+	}
+	router.Get("/user/:name", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		get = r.Method
+		effective = GetEffectiveMethod(r.Context())
+	}))
+	router.Handle("REPORT", "/report", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report = r.Method
+	}))
+
+	w := new(mockResponseWriter)
+
+	// fallback without a tree for the request method
+	r, _ := http.NewRequest(http.MethodHead, "/user/gopher", nil)
+	router.ServeHTTP(w, r)
+	if get != http.MethodHead || effective != http.MethodGet {
+		t.Errorf("HEAD fallback failed: method=%q effective=%q", get, effective)
+	}
+
+	// fallback with a tree for the request method
+	get, effective = "", ""
+	r, _ = http.NewRequest("REPORT", "/user/gopher", nil)
+	router.ServeHTTP(w, r)
+	if get != "REPORT" || effective != http.MethodGet {
+		t.Errorf("REPORT fallback failed: method=%q effective=%q", get, effective)
+	}
+
+	// explicit registrations take priority
+	get = ""
+	r, _ = http.NewRequest("REPORT", "/report", nil)
+	router.ServeHTTP(w, r)
+	if report != "REPORT" || get != "" {
+		t.Error("explicit REPORT route was not preferred")
+	}
+
+	// direct matches have no effective method
+	r, _ = http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(w, r)
+	if effective != "" {
+		t.Errorf("unexpected effective method %q", effective)
+	}
+
+	// unmatched paths are still not found
+	rec := httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodHead, "/nope", nil)
+	router.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unexpected response code %d want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestRouterHandleHEADForGET(t *testing.T) {
+	router := New()
+	router.HandleHEADForGET = true
+	router.Get("/user/:name", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", GetEffectiveMethod(r.Context()))
+		w.Write([]byte("gopher"))
+	}))
+	router.GetAndHead("/explicit", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+	}))
+	router.Post("/user/:name", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	// synthesized HEAD route, the body is discarded
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodHead, "/user/gopher", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("X-Method") != http.MethodGet || w.Body.Len() != 0 {
+		t.Errorf("HEAD served by GET route: code=%d method=%q body=%q",
+			w.Code, w.Header().Get("X-Method"), w.Body.String())
+	}
+
+	// explicit HEAD routes take precedence
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodHead, "/explicit", nil)
+	router.ServeHTTP(w, r)
+	if w.Header().Get("X-Method") != http.MethodHead {
+		t.Errorf("explicit HEAD route was not preferred, got %q", w.Header().Get("X-Method"))
+	}
+
+	// HEAD is listed in the Allow header
+	for _, test := range []struct {
+		method, path, allow string
+		code                int
+	}{
+		{http.MethodPut, "/user/gopher", "GET, HEAD, OPTIONS, POST", http.StatusMethodNotAllowed},
+		{http.MethodOptions, "/user/gopher", "GET, HEAD, OPTIONS, POST", http.StatusOK},
+		{http.MethodPut, "/explicit", "GET, HEAD, OPTIONS", http.StatusMethodNotAllowed},
+	} {
+		w = httptest.NewRecorder()
+		r, _ = http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(w, r)
+		allow := strings.Split(w.Header().Get("Allow"), ", ")
+		sort.Strings(allow)
+		if w.Code != test.code || strings.Join(allow, ", ") != test.allow {
+			t.Errorf("%s %s: got %d %q, want %d %q",
+				test.method, test.path, w.Code, strings.Join(allow, ", "), test.code, test.allow)
+		}
+	}
+	if allow := strings.Join(router.AllowedMethods("/user/gopher"), ", "); allow != "GET, HEAD, OPTIONS, POST" {
+		t.Errorf("AllowedMethods: got %q", allow)
+	}
+
+	// disabled, HEAD is not served by GET routes
+	router.HandleHEADForGET = false
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodHead, "/user/gopher", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("HEAD without HandleHEADForGET: got %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestRouterPanicHandler(t *testing.T) {
+	router := New()
+	panicHandled := false
+	var stack []byte
+
+	router.PanicHandler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panicHandled = GetPanic(r.Context()) == "oops!"
+		stack = GetPanicStack(r.Context())
+	})
+
+	router.Put("/user/:name", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic("oops!")
+	}))
+
+	w := new(mockResponseWriter)
+	req, _ := http.NewRequest(http.MethodPut, "/user/gopher", nil)
+
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			t.Fatal("handling panic failed")
+		}
+	}()
+
+	router.ServeHTTP(w, req)
+
+	if !panicHandled {
+		t.Fatal("simulating failed")
+	}
+	// the stack includes the frame of the panicking handle
+	if !bytes.Contains(stack, []byte("TestRouterPanicHandler.func2")) {
+		t.Errorf("stack trace does not include the panicking handle:\n%s", stack)
+	}
+}
+
+func TestRouterRecoverPanics(t *testing.T) {
+	router := New()
+	router.Put("/user/:name", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic("oops!")
+	}))
+	router.Get("/abort", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	// panics propagate by default
+	req, _ := http.NewRequest(http.MethodPut, "/user/gopher", nil)
+	if recv := catchPanic(func() { router.ServeHTTP(httptest.NewRecorder(), req) }); recv != "oops!" {
+		t.Errorf("panic did not propagate: got %v", recv)
+	}
+
+	var buf bytes.Buffer
+	router.RecoverPanics = true
+	router.Logger = log.New(&buf, "", 0)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("unexpected response code %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	logged := buf.String()
+	if !strings.HasPrefix(logged, "httprouter: panic serving PUT /user/gopher: oops!\n") ||
+		!strings.Contains(logged, "TestRouterRecoverPanics.func1") {
+		t.Errorf("unexpected log output:\n%s", logged)
+	}
+
+	// http.ErrAbortHandler still aborts the response
+	buf.Reset()
+	req, _ = http.NewRequest(http.MethodGet, "/abort", nil)
+	if recv := catchPanic(func() { router.ServeHTTP(httptest.NewRecorder(), req) }); recv != http.ErrAbortHandler {
+		t.Errorf("http.ErrAbortHandler was recovered: got %v", recv)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("http.ErrAbortHandler was logged:\n%s", buf.String())
+	}
+}
+
+func TestRouterPanicResponse(t *testing.T) {
+	router := New()
+
+	var recovered interface{}
+	var stack []byte
+	router.PanicResponse = func(w http.ResponseWriter, r *http.Request, rcv interface{}) {
+		recovered = rcv
+		stack = GetPanicStack(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error":%q}`, rcv)
+	}
+
+	router.Put("/user/:name", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic("oops!")
+	}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPut, "/user/gopher", nil)
+	router.ServeHTTP(w, req)
+
+	if recovered != "oops!" || w.Code != http.StatusInternalServerError || w.Body.String() != `{"error":"oops!"}` {
+		t.Errorf("rendering panic failed: recovered=%v, Code=%d, Body=%q", recovered, w.Code, w.Body.String())
+	}
+	if !bytes.Contains(stack, []byte("TestRouterPanicResponse.func2")) {
+		t.Errorf("stack trace does not include the panicking handle:\n%s", stack)
+	}
+
+	// the PanicHandler takes precedence
+	recovered = nil
+	panicHandled := false
+	router.PanicHandler = http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		panicHandled = GetPanic(r.Context()) == "oops!"
+	})
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !panicHandled || recovered != nil {
+		t.Errorf("PanicHandler not preferred: handled=%v, recovered=%v", panicHandled, recovered)
+	}
+}
+
+func TestRouterLookup(t *testing.T) {
+	routed := false
+	wantHandle := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		routed = true
+	})
+	wantParams := Params{Param{"name", "gopher"}}
+
+	router := New()
+
+	// try empty router first
+	handle, _, tsr := router.Lookup(http.MethodGet, "/nope")
+	if handle != nil {
+		t.Fatalf("Got handle for unregistered pattern: %v", handle)
+	}
+	if tsr {
+		t.Error("Got wrong TSR recommendation!")
+	}
+
+	// insert route and try again
+	router.Get("/user/:name", wantHandle)
+
+	handle, params, tsr := router.Lookup(http.MethodGet, "/user/gopher")
+	if handle == nil {
+		t.Fatal("Got no handle!")
+	} else {
+		handle.ServeHTTP(nil, nil)
+		if !routed {
+			t.Fatal("Routing failed!")
+		}
+	}
+
+	if !reflect.DeepEqual(params, wantParams) {
+		t.Fatalf("Wrong parameter values: want %v, got %v", wantParams, params)
+	}
+
+	handle, _, tsr = router.Lookup(http.MethodGet, "/user/gopher/")
+	if handle != nil {
+		t.Fatalf("Got handle for unregistered pattern: %v", handle)
+	}
+	if !tsr {
+		t.Error("Got no TSR recommendation!")
+	}
+
+	handle, _, tsr = router.Lookup(http.MethodGet, "/nope")
+	if handle != nil {
+		t.Fatalf("Got handle for unregistered pattern: %v", handle)
+	}
+	if tsr {
+		t.Error("Got wrong TSR recommendation!")
+	}
+}
+
+func TestRouterMatch(t *testing.T) {
+	router := New()
+	router.Get("/user/:name", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+
+	m, ok := router.Match(http.MethodGet, "/user/gopher")
+	if !ok || m.Handle == nil {
+		t.Fatal("Got no match!")
+	}
+	want := Match{Method: http.MethodGet, Path: "/user/:name", Params: Params{Param{"name", "gopher"}}}
+	if m.Method != want.Method || m.Path != want.Path || !reflect.DeepEqual(m.Params, want.Params) || m.TSR {
+		t.Errorf("Wrong match: want %+v, got %+v", want, *m)
+	}
+
+	for _, test := range []struct {
+		method, path string
+		tsr          bool
+	}{
+		{http.MethodGet, "/user/gopher/", true},
+		{http.MethodGet, "/nope", false},
+		{http.MethodPost, "/user/gopher", false},
+	} {
+		m, ok := router.Match(test.method, test.path)
+		if ok || m.Handle != nil || m.Path != "" || m.Params != nil {
+			t.Errorf("%s %s: got match %+v", test.method, test.path, *m)
+		}
+		if m.TSR != test.tsr {
+			t.Errorf("%s %s: got TSR %t, want %t", test.method, test.path, m.TSR, test.tsr)
+		}
+	}
+}
+
+func TestRouterValidate(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Get("/user/:name", handlerFunc)
+	router.Get("/files/*filepath", handlerFunc)
+
+	errs := router.Validate([]ExpectedRoute{
+		{http.MethodGet, "/user/gopher", "/user/:name"},
+		{http.MethodGet, "/files/LICENSE", "/files/*filepath"},
+	})
+	if errs != nil {
+		t.Errorf("unexpected validation errors: %v", errs)
+	}
+
+	errs = router.Validate([]ExpectedRoute{
+		{http.MethodGet, "/user/gopher", "/user/:id"},
+		{http.MethodPost, "/user/gopher", "/user/:name"},
+		{http.MethodGet, "/nope", "/nope"},
+		{http.MethodGet, "/nope", ""},
+	})
+	want := []string{
+		"GET '/user/gopher' matched '/user/:name', want '/user/:id'",
+		"POST '/user/gopher' matched no route, want '/user/:name'",
+		"GET '/nope' matched no route, want '/nope'",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("wrong number of validation errors: want %d, got %v", len(want), errs)
+	}
+	for i := range errs {
+		if errs[i].Error() != want[i] {
+			t.Errorf("unexpected validation error got %q want %q", errs[i], want[i])
+		}
+	}
+}
+
+func TestRouterMethodsFor(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Post("/user/:name", handlerFunc)
+	router.Get("/user/:name", handlerFunc)
+	router.Options("/user/:name", handlerFunc)
+	router.Delete("/user/gopher/profile", handlerFunc)
+	router.Put("/files/*filepath", handlerFunc)
+
+	for _, test := range []struct {
+		path    string
+		methods []string
+	}{
+		{"/user/gopher", []string{"GET", "OPTIONS", "POST"}},
+		{"/user/:name", []string{"GET", "OPTIONS", "POST"}},
+		{"/user/gopher/profile", []string{"DELETE"}},
+		{"/files/*filepath", []string{"PUT"}},
+		{"/files/LICENSE", []string{"PUT"}},
+		{"/nope", nil},
+	} {
+		if methods := router.MethodsFor(test.path); !reflect.DeepEqual(methods, test.methods) {
+			t.Errorf("wrong methods for %s: want %v, got %v", test.path, test.methods, methods)
+		}
+	}
+}
+
+func TestRouterMatchCounts(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Get("/user/:name", handlerFunc)
+	router.Get("/users", handlerFunc)
+	router.Post("/user/:name", handlerFunc)
+
+	w := new(mockResponseWriter)
+	for _, path := range []string{"/user/gopher", "/user/gordon", "/users", "/nope"} {
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+	}
+
+	want := map[string]uint64{
+		"GET /user/:name":  0,
+		"GET /users":       0,
+		"POST /user/:name": 0,
+	}
+	if counts := router.MatchCounts(); !reflect.DeepEqual(counts, want) {
+		t.Errorf("counted matches while disabled: want %v, got %v", want, counts)
+	}
+
+	router.CountMatches = true
+	for _, path := range []string{"/user/gopher", "/user/gordon", "/users", "/nope"} {
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+	}
+
+	want["GET /user/:name"] = 2
+	want["GET /users"] = 1
+	if counts := router.MatchCounts(); !reflect.DeepEqual(counts, want) {
+		t.Errorf("wrong match counts: want %v, got %v", want, counts)
+	}
+}
+
+type mockFileSystem struct {
+	opened bool
+}
+
+func (mfs *mockFileSystem) Open(name string) (http.File, error) {
+	mfs.opened = true
+	return nil, errors.New("this is just a mock")
+}
+
+func TestRouterServeFiles(t *testing.T) {
+	router := New()
+	mfs := &mockFileSystem{}
+
+	recv := catchPanic(func() {
+		router.ServeFiles("/noFilepath", mfs)
+	})
+	if recv == nil {
+		t.Fatal("registering path not ending with '*filepath' did not panic")
+	}
+
+	router.ServeFiles("/*filepath", mfs)
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest(http.MethodGet, "/favicon.ico", nil)
+	router.ServeHTTP(w, r)
+	if !mfs.opened {
+		t.Error("serving file failed")
+	}
+
+	mfs.opened = false
+
+	r, _ = http.NewRequest(http.MethodHead, "/favicon.ico", nil)
+	router.ServeHTTP(w, r)
 	if !mfs.opened {
 		t.Error("serving file failed")
 	}
 }
+
+func TestRouterServeFilesNotFound(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httprouter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "robots.txt"), []byte("robots"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	router := New()
+	router.ServeFiles("/static/*filepath", http.Dir(dir))
+
+	// without a NotFound handler, missing files are answered by http.NotFound
+	r, _ := http.NewRequest(http.MethodGet, "/static/missing.txt", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound || w.Body.String() != "404 page not found\n" {
+		t.Errorf("serving missing file failed: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+
+	var missing []string
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		missing = append(missing, r.URL.Path)
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	for _, test := range []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{http.MethodGet, "/static/robots.txt", http.StatusOK, "robots"},
+		{http.MethodGet, "/static/missing.txt", http.StatusTeapot, ""},
+		{http.MethodHead, "/static/missing.txt", http.StatusTeapot, ""},
+	} {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Body.String() != test.body {
+			t.Errorf("%s %s failed: Code=%d, Body=%q", test.method, test.path, w.Code, w.Body.String())
+		}
+	}
+
+	if want := []string{"/static/missing.txt", "/static/missing.txt"}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("NotFound called for %v, want %v", missing, want)
+	}
+
+	// the io.ReaderFrom of the http.ResponseWriter is still used for files
+	rw := new(readerFromResponseWriter)
+	r, _ = http.NewRequest(http.MethodGet, "/static/robots.txt", nil)
+	router.ServeHTTP(rw, r)
+	if !rw.readFrom {
+		t.Error("file was not served with the ReadFrom method of the http.ResponseWriter")
+	}
+}
+
+func TestRouterServeFilesWithOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httprouter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"robots.txt":      "robots",
+		"docs/index.html": "docs",
+		"assets/app.js":   "app",
+	} {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var missing []string
+	router := New()
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		missing = append(missing, r.URL.Path)
+		w.WriteHeader(http.StatusTeapot)
+	})
+	router.ServeFilesWithOptions("/static/*filepath", http.Dir(dir), FileServeOptions{DisableListing: true})
+	router.ServeFilesWithOptions("/list/*filepath", http.Dir(dir), FileServeOptions{
+		NotFound: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusGone)
+		}),
+	})
+
+	for _, test := range []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/static/robots.txt", http.StatusOK, "robots"},
+		{"/static/docs/", http.StatusOK, "docs"},
+		{"/static/assets/", http.StatusTeapot, ""},
+		{"/static/missing.txt", http.StatusTeapot, ""},
+		{"/list/assets/", http.StatusOK, ""},
+		{"/list/missing.txt", http.StatusGone, ""},
+	} {
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || (test.body != "" && w.Body.String() != test.body) {
+			t.Errorf("serving %s failed: Code=%d, Body=%q", test.path, w.Code, w.Body.String())
+		}
+		if test.code != http.StatusOK && w.Body.Len() != 0 {
+			t.Errorf("serving %s: expected empty body, got %q", test.path, w.Body.String())
+		}
+		if test.code == http.StatusTeapot && w.Header().Get("Content-Type") != "" {
+			t.Errorf("serving %s: got Content-Type %q of the file server", test.path, w.Header().Get("Content-Type"))
+		}
+	}
+
+	if want := []string{"/static/assets/", "/static/missing.txt"}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("NotFound called for %v, want %v", missing, want)
+	}
+
+	recv := catchPanic(func() {
+		router.ServeFilesWithOptions("/noFilepath", http.Dir(dir), FileServeOptions{})
+	})
+	if recv == nil {
+		t.Error("registering path not ending with '*filepath' did not panic")
+	}
+}
+
+// openFunc is a http.FileSystem calling the function to open files.
+type openFunc func(name string) (http.File, error)
+
+func (fn openFunc) Open(name string) (http.File, error) { return fn(name) }
+
+func TestRouterServeFilesIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httprouter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"default.htm":       "root",
+		"docs/default.htm":  "docs",
+		"docs/guide.html":   "guide",
+		"empty/index.html":  "index",
+		"dir/default.htm/x": "x",
+	} {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router := New()
+	router.ServeFilesIndex("/static/*filepath", http.Dir(dir), "default.htm")
+
+	for _, test := range []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/static/", http.StatusOK, "root"},
+		{"/static/docs/", http.StatusOK, "docs"},
+		{"/static/docs/guide.html", http.StatusOK, "guide"},
+		{"/static/docs", http.StatusMovedPermanently, ""},
+		{"/static/empty/", http.StatusNotFound, ""},
+		{"/static/dir/", http.StatusNotFound, ""},
+		{"/static/missing/", http.StatusNotFound, ""},
+	} {
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || (test.body != "" && w.Body.String() != test.body) {
+			t.Errorf("serving %s failed: Code=%d, Body=%q", test.path, w.Code, w.Body.String())
+		}
+	}
+
+	// the name of the index file is cleaned before it is opened
+	var opened []string
+	router.ServeFilesIndex("/mock/*filepath", openFunc(func(name string) (http.File, error) {
+		opened = append(opened, name)
+		return nil, os.ErrNotExist
+	}), "default.htm")
+	r, _ := http.NewRequest(http.MethodGet, "/mock/a/../../../etc/", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if want := []string{"/etc/default.htm"}; !reflect.DeepEqual(opened, want) {
+		t.Errorf("opened %q, want %q", opened, want)
+	}
+
+	recv := catchPanic(func() {
+		router.ServeFilesIndex("/noFilepath", http.Dir(dir), "default.htm")
+	})
+	if recv == nil {
+		t.Error("registering path not ending with '*filepath' did not panic")
+	}
+}
+
+func TestRouterOnNotFound(t *testing.T) {
+	var missing []string
+	router := New()
+	router.OnNotFound = func(req *http.Request) {
+		missing = append(missing, req.URL.Path)
+	}
+	router.Get("/path", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+
+	for _, path := range []string{"/path", "/missing", "/path/", "/other"} {
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if want := []string{"/missing", "/other"}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("OnNotFound observed %v, want %v", missing, want)
+	}
+
+	notFound := false
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		notFound = true
+		w.WriteHeader(http.StatusNotFound)
+	})
+	missing = nil
+	r, _ := http.NewRequest(http.MethodGet, "/missing", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !notFound || w.Code != http.StatusNotFound || len(missing) != 1 {
+		t.Errorf("OnNotFound with custom NotFound failed: notFound=%v, Code=%d, observed=%v",
+			notFound, w.Code, missing)
+	}
+}
+
+func TestRouterHandleMatch(t *testing.T) {
+	var routed string
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			routed = name + ":" + GetValue(r.Context(), "id")
+		})
+	}
+
+	even := func(s string) bool {
+		return len(s) > 0 && strings.IndexByte("02468", s[len(s)-1]) >= 0
+	}
+
+	router := New()
+	router.HandleMatch(http.MethodGet, "/even/:id", map[string]func(string) bool{"id": even}, handler("even"))
+
+	for _, test := range []struct {
+		path   string
+		code   int
+		routed string
+	}{
+		{"/even/42", http.StatusOK, "even:42"},
+		{"/even/43", http.StatusNotFound, ""},
+	} {
+		routed = ""
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed {
+			t.Errorf("routing %s failed: Code=%d, routed=%q", test.path, w.Code, routed)
+		}
+	}
+
+	recv := catchPanic(func() {
+		router.HandleMatch(http.MethodGet, "/odd/:id", map[string]func(string) bool{"name": even}, handler("odd"))
+	})
+	if recv == nil {
+		t.Error("registering matcher for unknown param did not panic")
+	}
+
+	// matchers of deferred routes are added by Compile
+	router = New()
+	router.DeferRegistration = true
+	router.HandleMatch(http.MethodGet, "/even/:id", map[string]func(string) bool{"id": even}, handler("even"))
+	router.Compile()
+
+	r, _ := http.NewRequest(http.MethodGet, "/even/43", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("deferred matcher not applied: Code=%d", w.Code)
+	}
+}
+
+func TestRouterReportShadowing(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	var buf bytes.Buffer
+	router := New()
+	router.Logger = log.New(&buf, "", 0)
+	router.MethodFallback = map[string]string{http.MethodHead: http.MethodGet}
+	router.Get("/api/users", handlerFunc)
+	router.Get("/api/users/:id", handlerFunc)
+	router.Get("/static/app.js", handlerFunc)
+	router.Head("/api/*path", handlerFunc)
+	router.Post("/*path", handlerFunc)
+
+	want := "httprouter: catch-all route HEAD /api/*path shadows 2 GET route(s) for HEAD requests\n"
+	if buf.String() != want {
+		t.Errorf("unexpected diagnostics: got %q, want %q", buf.String(), want)
+	}
+
+	// deferred routes are checked once all of them were added
+	buf.Reset()
+	router = New()
+	router.Logger = log.New(&buf, "", 0)
+	router.DeferRegistration = true
+	router.MethodFallback = map[string]string{http.MethodPatch: http.MethodPost}
+	router.Patch("/*path", handlerFunc)
+	router.Post("/api/users", handlerFunc)
+	router.Compile()
+
+	want = "httprouter: catch-all route PATCH /*path shadows 1 POST route(s) for PATCH requests\n"
+	if buf.String() != want {
+		t.Errorf("unexpected diagnostics after Compile: got %q, want %q", buf.String(), want)
+	}
+
+	// a catch-all above static routes of its own method conflicts with them
+	buf.Reset()
+	router = New()
+	router.Logger = log.New(&buf, "", 0)
+	router.Get("/api/users", handlerFunc)
+	router.Get("/api/posts/:id", handlerFunc)
+	router.Get("/static/app.js", handlerFunc)
+	recv := catchPanic(func() {
+		router.Get("/*path", handlerFunc)
+	})
+	if err, ok := recv.(*RegistrationError); !ok || err.Kind != KindConflict {
+		t.Errorf("expected conflict registering /*path, got %v", recv)
+	}
+
+	want = "httprouter: catch-all route GET /*path shadows 2 static GET route(s)\n"
+	if buf.String() != want {
+		t.Errorf("unexpected diagnostics for static routes: got %q, want %q", buf.String(), want)
+	}
+
+	// deferred routes are reported before any of them is added
+	buf.Reset()
+	router = New()
+	router.Logger = log.New(&buf, "", 0)
+	router.DeferRegistration = true
+	router.Get("/api/*path", handlerFunc)
+	router.Get("/api/users", handlerFunc)
+	router.Get("/users", handlerFunc)
+	catchPanic(router.Compile)
+
+	want = "httprouter: catch-all route GET /api/*path shadows 1 static GET route(s)\n"
+	if buf.String() != want {
+		t.Errorf("unexpected diagnostics for deferred static routes: got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestRouterUsePermanentRedirect(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.UsePermanentRedirect = true
+	router.RedirectCodes = map[string]int{http.MethodPut: http.StatusFound}
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut} {
+		router.Handle(method, "/path", handlerFunc)
+	}
+
+	for _, test := range []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodGet, "/path/", http.StatusPermanentRedirect},
+		{http.MethodGet, "/PATH", http.StatusPermanentRedirect},
+		{http.MethodPost, "/path/", http.StatusTemporaryRedirect},
+		{http.MethodPost, "/PATH", http.StatusTemporaryRedirect},
+		{http.MethodPut, "/path/", http.StatusFound},
+	} {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Location") != "/path" {
+			t.Errorf("redirecting %s %s failed: Code=%d, Location=%q",
+				test.method, test.path, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRouterRedirectDirectionCodes(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.RedirectTrailingSlashCode = http.StatusFound
+	router.RedirectFixedPathCode = http.StatusSeeOther
+	router.RedirectCodes = map[string]int{http.MethodPut: http.StatusPermanentRedirect}
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut} {
+		router.Handle(method, "/path", handlerFunc)
+	}
+
+	for _, test := range []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodGet, "/path/", http.StatusFound},
+		{http.MethodGet, "/PATH", http.StatusSeeOther},
+		{http.MethodPost, "/path/", http.StatusFound},
+		{http.MethodPost, "/PATH", http.StatusSeeOther},
+		{http.MethodPut, "/path/", http.StatusPermanentRedirect},
+	} {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Location") != "/path" {
+			t.Errorf("redirecting %s %s failed: Code=%d, Location=%q",
+				test.method, test.path, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	// invalid codes are ignored
+	router.RedirectTrailingSlashCode = http.StatusOK
+	router.RedirectFixedPathCode = 0
+	for method, code := range map[string]int{
+		http.MethodGet:  http.StatusMovedPermanently,
+		http.MethodPost: http.StatusTemporaryRedirect,
+	} {
+		for _, path := range [...]string{"/path/", "/PATH"} {
+			r, _ := http.NewRequest(method, path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != code {
+				t.Errorf("redirecting %s %s with invalid codes: got %d, want %d", method, path, w.Code, code)
+			}
+		}
+	}
+}
+
+func TestRouterRedirectCodes(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.RedirectCodes = map[string]int{
+		http.MethodGet: http.StatusFound,
+		http.MethodPut: http.StatusPermanentRedirect,
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		router.Handle(method, "/path", handlerFunc)
+	}
+
+	for _, test := range []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodGet, "/path/", http.StatusFound},
+		{http.MethodGet, "/PATH", http.StatusFound},
+		{http.MethodPut, "/path/", http.StatusPermanentRedirect},
+		{http.MethodPut, "/PATH", http.StatusPermanentRedirect},
+		{http.MethodDelete, "/path/", http.StatusTemporaryRedirect},
+	} {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Location") != "/path" {
+			t.Errorf("redirecting %s %s failed: Code=%d, Location=%q",
+				test.method, test.path, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRouterOnMatch(t *testing.T) {
+	type key struct{}
+
+	var pattern string
+	var params Params
+	router := New()
+	router.OnMatch = func(ctx context.Context, p string, ps Params) context.Context {
+		pattern, params = p, ps
+		return context.WithValue(ctx, key{}, "span")
+	}
+
+	var value interface{}
+	var name string
+	router.Get("/user/:name", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		value = r.Context().Value(key{})
+		name = GetValue(r.Context(), "name")
+	}))
+
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	if pattern != "/user/:name" || !reflect.DeepEqual(params, Params{Param{"name", "gopher"}}) {
+		t.Errorf("OnMatch called with pattern %q and params %v", pattern, params)
+	}
+	if value != "span" || name != "gopher" {
+		t.Errorf("handler got context value %v and param %q", value, name)
+	}
+
+	pattern = ""
+	r, _ = http.NewRequest(http.MethodGet, "/missing", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if pattern != "" {
+		t.Errorf("OnMatch called for unmatched request with pattern %q", pattern)
+	}
+}
+
+func TestRouterHandleCatchAllLimit(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.HandleCatchAllLimit(http.MethodGet, "/app/*path", handlerFunc, 2)
+
+	for _, test := range []struct {
+		path string
+		code int
+	}{
+		{"/app/", http.StatusOK},
+		{"/app/users", http.StatusOK},
+		{"/app/users/42", http.StatusOK},
+		{"/app/users/", http.StatusOK},
+		{"/app/users/42/", http.StatusNotFound},
+		{"/app/users/42/posts", http.StatusNotFound},
+	} {
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("routing %s failed: Code=%d, want %d", test.path, w.Code, test.code)
+		}
+	}
+
+	for _, register := range []func(){
+		func() { router.HandleCatchAllLimit(http.MethodGet, "/user/:name", handlerFunc, 2) },
+		func() { router.HandleCatchAllLimit(http.MethodGet, "/src/*filepath", handlerFunc, 0) },
+	} {
+		if recv := catchPanic(register); recv == nil {
+			t.Error("registering invalid catch-all limit did not panic")
+		}
+	}
+}
+
+func TestRouterEmitCanonicalLink(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.EmitCanonicalLink = true
+	router.TransformParams = func(ps Params) Params {
+		for i := range ps {
+			ps[i].Value = strings.ToLower(ps[i].Value)
+		}
+		return ps
+	}
+	router.Get("/user/:name", handlerFunc)
+	router.Get("/about", handlerFunc)
+
+	for _, test := range []struct {
+		path, link string
+	}{
+		{"/user/gopher", ""},
+		{"/user/Gopher", `</user/gopher>; rel="canonical"`},
+		{"/user/Hello%20World", `</user/hello%20world>; rel="canonical"`},
+		{"/about", ""},
+	} {
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if link := w.Header().Get("Link"); link != test.link {
+			t.Errorf("wrong Link header for %s: got %q, want %q", test.path, link, test.link)
+		}
+	}
+}
+
+func TestRouterPermanentTrailingSlashRedirect(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.PermanentTrailingSlashRedirect = true
+	router.RedirectCodes = map[string]int{http.MethodPut: http.StatusTemporaryRedirect}
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut} {
+		router.Handle(method, "/submit", handlerFunc)
+	}
+
+	for _, test := range []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodPost, "/submit/", http.StatusPermanentRedirect},
+		{http.MethodGet, "/submit/", http.StatusMovedPermanently},
+		{http.MethodPut, "/submit/", http.StatusTemporaryRedirect},
+		// fixed path redirects are not affected
+		{http.MethodPost, "/SUBMIT", http.StatusTemporaryRedirect},
+	} {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Location") != "/submit" {
+			t.Errorf("redirecting %s %s failed: Code=%d, Location=%q",
+				test.method, test.path, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRouterRoutes(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	if b, err := router.ExportJSON(); err != nil || string(b) != "[]" {
+		t.Errorf("ExportJSON for empty router returned %s, %v", b, err)
+	}
+
+	router.Post("/user/:name", handlerFunc)
+	router.Get("/user/:name", handlerFunc).Name("user")
+	router.Get("/", handlerFunc)
+	router.Get(`/items/:id(\d+)?`, handlerFunc)
+	router.HandleOp(http.MethodDelete, "/src/*filepath", handlerFunc, OperationMeta{
+		Summary: "Delete a file",
+		Tags:    []string{"src"},
+	})
+
+	want := []RouteInfo{
+		{Method: http.MethodGet, Path: "/"},
+		{Method: http.MethodGet, Path: `/items/:id(\d+)?`},
+		{Method: http.MethodDelete, Path: "/src/*filepath", Meta: &OperationMeta{
+			Summary: "Delete a file",
+			Tags:    []string{"src"},
+		}},
+		{Method: http.MethodGet, Path: "/user/:name", Name: "user"},
+		{Method: http.MethodPost, Path: "/user/:name", Name: "user"},
+	}
+	if routes := router.Routes(); !reflect.DeepEqual(routes, want) {
+		t.Errorf("Routes returned %v, want %v", routes, want)
+	}
+
+	b, err := router.ExportJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const wantJSON = `[{"method":"GET","path":"/"},` +
+		`{"method":"GET","path":"/items/:id(\\d+)?"},` +
+		`{"method":"DELETE","path":"/src/*filepath","meta":{"summary":"Delete a file","tags":["src"]}},` +
+		`{"method":"GET","path":"/user/:name","name":"user"},` +
+		`{"method":"POST","path":"/user/:name","name":"user"}]`
+	if string(b) != wantJSON {
+		t.Errorf("ExportJSON returned %s, want %s", b, wantJSON)
+	}
+}
+
+func TestRouterOptionalParam(t *testing.T) {
+	var id string
+	var has bool
+	router := New()
+	router.Get("/items/:id?", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		id, has = GetValue(r.Context(), "id"), GetParams(r.Context()).Has("id")
+	}))
+
+	for _, test := range []struct {
+		path string
+		id   string
+	}{
+		{"/items", ""},
+		{"/items/42", "42"},
+	} {
+		id, has = "unset", false
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || id != test.id || !has {
+			t.Errorf("GET %s: got %d with id %q (set: %t), want %d with id %q",
+				test.path, w.Code, id, has, http.StatusOK, test.id)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/items/", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/items" {
+		t.Errorf("GET /items/: got %d to %q, want %d to /items",
+			w.Code, w.Header().Get("Location"), http.StatusMovedPermanently)
+	}
+
+	// the expanded routes conflict with concrete routes
+	router.Get("/users", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+	recv := catchPanic(func() {
+		router.Get("/users/:id?", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+	})
+	if err, ok := recv.(*RegistrationError); !ok || err.Kind != KindConflict {
+		t.Errorf("expected conflict panic, got %v", recv)
+	}
+}
+
+func TestRouterCaseInsensitive(t *testing.T) {
+	var name, pattern string
+	router := New()
+	router.CaseInsensitive = true
+	router.Get("/Users/:name", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, pattern = GetValue(r.Context(), "name"), GetMatchedPattern(r.Context())
+	}))
+	router.Post("/Users/:name", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	router.Get("/docs/", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for _, test := range []struct {
+		method, path string
+		code         int
+		name         string
+	}{
+		{http.MethodGet, "/Users/Gopher", http.StatusOK, "Gopher"},
+		{http.MethodGet, "/users/Gopher", http.StatusOK, "Gopher"},
+		{http.MethodGet, "/USERS/gOPHER", http.StatusOK, "gOPHER"},
+		{http.MethodPut, "/USERS/gopher", http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "/DOCS/", http.StatusOK, ""},
+		{http.MethodGet, "/DOCS", http.StatusMovedPermanently, ""},
+		{http.MethodGet, "/nope", http.StatusNotFound, ""},
+	} {
+		name, pattern = "", ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || name != test.name {
+			t.Errorf("%s %s: got %d with name %q, want %d with %q",
+				test.method, test.path, w.Code, name, test.code, test.name)
+		}
+		if test.name != "" && pattern != "/Users/:name" {
+			t.Errorf("%s %s: got pattern %q", test.method, test.path, pattern)
+		}
+	}
+
+	// disabled, the request is redirected
+	router.CaseInsensitive = false
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/users/Gopher", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/Users/Gopher" {
+		t.Errorf("GET /users/Gopher without CaseInsensitive: got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestRouterFindCaseInsensitivePath(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Get("/Users/:name", handlerFunc)
+	router.Get("/docs/", handlerFunc)
+
+	for _, test := range []struct {
+		method, path  string
+		trailingSlash bool
+		want          string
+		found         bool
+	}{
+		{http.MethodGet, "/users/Gopher", false, "/Users/Gopher", true},
+		{http.MethodGet, "/DOCS/", false, "/docs/", true},
+		{http.MethodGet, "/DOCS", false, "", false},
+		{http.MethodGet, "/DOCS", true, "/docs/", true},
+		{http.MethodGet, "/nope", true, "", false},
+		{http.MethodPost, "/users/gopher", true, "", false},
+	} {
+		got, found := router.FindCaseInsensitivePath(test.method, test.path, test.trailingSlash)
+		if got != test.want || found != test.found {
+			t.Errorf("FindCaseInsensitivePath(%q, %q, %v) = %q, %v, want %q, %v",
+				test.method, test.path, test.trailingSlash, got, found, test.want, test.found)
+		}
+	}
+}
+
+func TestRouterRedirectHandler(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	var info *RedirectInfo
+	router := New()
+	router.RedirectHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info = GetRedirect(r.Context())
+		w.Header().Set("X-Redirect-Reason", "canonical")
+		http.Redirect(w, r, "https://example.com"+info.Target, info.Code)
+	})
+	router.Get("/path", handlerFunc)
+	router.Post("/dir/", handlerFunc)
+
+	for _, test := range []struct {
+		method, path string
+		want         RedirectInfo
+	}{
+		{http.MethodGet, "/path/?q=1", RedirectInfo{"/path/", "/path?q=1", http.StatusMovedPermanently}},
+		{http.MethodPost, "/dir", RedirectInfo{"/dir", "/dir/", http.StatusTemporaryRedirect}},
+		{http.MethodGet, "/PATH", RedirectInfo{"/PATH", "/path", http.StatusMovedPermanently}},
+	} {
+		info = nil
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(w, r)
+		if info == nil || *info != test.want {
+			t.Errorf("%s %s: got redirect %+v, want %+v", test.method, test.path, info, test.want)
+			continue
+		}
+		if loc := w.Header().Get("Location"); w.Code != test.want.Code || loc != "https://example.com"+test.want.Target ||
+			w.Header().Get("X-Redirect-Reason") != "canonical" {
+			t.Errorf("%s %s: got %d to %q", test.method, test.path, w.Code, loc)
+		}
+	}
+
+	// without a handler, http.Redirect is used
+	router.RedirectHandler = nil
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/path/", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/path" {
+		t.Errorf("GET /path/: got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestRouterSlashMismatchHandler(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	var canonical string
+	router := New()
+	router.RedirectTrailingSlash = false
+	router.RedirectFixedPath = false
+	router.SlashMismatchHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		canonical = GetCanonicalPath(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+	})
+	router.Get("/path", handlerFunc)
+	router.Get("/dir/", handlerFunc)
+
+	for _, test := range []struct {
+		path      string
+		code      int
+		canonical string
+	}{
+		{"/path/", http.StatusTeapot, "/path"},
+		{"/dir", http.StatusTeapot, "/dir/"},
+		{"/path", http.StatusOK, ""},
+		{"/nope/", http.StatusNotFound, ""},
+	} {
+		canonical = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || canonical != test.canonical {
+			t.Errorf("GET %s: got %d with canonical path %q, want %d with %q",
+				test.path, w.Code, canonical, test.code, test.canonical)
+		}
+	}
+
+	// the handler is not used while trailing slashes are redirected
+	router.RedirectTrailingSlash = true
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/path/", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMovedPermanently {
+		t.Errorf("GET /path/: got %d, want %d", w.Code, http.StatusMovedPermanently)
+	}
+}
+
+func TestRouterConstraints(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Get(`/users/:id(\d+)`, handlerFunc)
+
+	for _, test := range []struct {
+		path string
+		code int
+	}{
+		{"/users/42", http.StatusOK},
+		{"/users/abc", http.StatusNotFound},
+		{"/users/", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("GET %s: got %d, want %d", test.path, w.Code, test.code)
+		}
+	}
+
+	for _, path := range []string{`/posts/:id(\d+`, `/posts/:id([0-9)`} {
+		err, ok := router.TryHandle(http.MethodGet, path, handlerFunc).(*RegistrationError)
+		if !ok || err.Kind != KindBadPath || err.Path != path {
+			t.Errorf("unexpected error for an invalid constraint in %s: %v", path, err)
+		}
+	}
+}
+
+func TestRouterMethodNotAllowedFor(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	var id string
+	router := New()
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("generic"))
+	})
+	router.MethodNotAllowedFor("/legacy/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = GetValue(r.Context(), "id")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("deprecated"))
+	}))
+	router.Get("/legacy/:id", handlerFunc)
+	router.Get("/current", handlerFunc)
+
+	for _, test := range []struct {
+		path string
+		body string
+		id   string
+	}{
+		{"/legacy/42", "deprecated", "42"},
+		{"/current", "generic", ""},
+	} {
+		id = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodPost, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusMethodNotAllowed || w.Body.String() != test.body || id != test.id {
+			t.Errorf("POST %s: got %d %q with id %q, want %d %q with id %q", test.path,
+				w.Code, w.Body.String(), id, http.StatusMethodNotAllowed, test.body, test.id)
+		}
+		if allow := w.Header().Get("Allow"); allow != "GET, OPTIONS" {
+			t.Errorf("POST %s: unexpected Allow header %q", test.path, allow)
+		}
+	}
+
+	// the handler is only used for 405 responses
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/legacy/42", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /legacy/42: got %d, want %d", w.Code, http.StatusOK)
+	}
+
+	recv := catchPanic(func() {
+		router.MethodNotAllowedFor("legacy", handlerFunc)
+	})
+	if err, ok := recv.(*RegistrationError); !ok || err.Kind != KindBadPath {
+		t.Errorf("expected bad path panic, got %v", recv)
+	}
+}
+
+func TestRouterLookupAll(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.MethodFallback = map[string]string{http.MethodHead: http.MethodGet}
+	router.Head("/files/:name", handlerFunc)
+	router.Get("/files/:name", handlerFunc)
+	router.Get("/files/:name.:ext", handlerFunc)
+
+	var got []string
+	for _, match := range router.LookupAll(http.MethodHead, "/files/report.pdf") {
+		got = append(got, match.Method+" "+match.Path+" "+match.Params.ByName("name"))
+		if match.Handle == nil {
+			t.Errorf("nil handle for %s %s", match.Method, match.Path)
+		}
+	}
+	want := []string{
+		"HEAD /files/:name report.pdf",
+		"GET /files/:name.:ext report",
+		"GET /files/:name report.pdf",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LookupAll returned %q, want %q", got, want)
+	}
+
+	if matches := router.LookupAll(http.MethodPost, "/files/report.pdf"); matches != nil {
+		t.Errorf("LookupAll returned %v for a method without routes", matches)
+	}
+}
+
+func TestRouterNormalizeRedirectEscapes(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Get("/", handlerFunc)
+	router.Get("/dir/", handlerFunc)
+
+	for _, test := range []struct {
+		path     string
+		location string
+	}{
+		{"/%2f%2F", "/"},
+		{"/dir?q=%2f%2F", "/dir/?q=%2F%2F"},
+		{"/DIR/?q=%c3%a9&r=%zz%a", "/dir/?q=%C3%A9&r=%zz%a"},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != test.location {
+			t.Errorf("GET %s: got %d to %q, want %d to %q", test.path,
+				w.Code, w.Header().Get("Location"), http.StatusMovedPermanently, test.location)
+		}
+	}
+
+	// the query is kept as requested when disabled
+	router.NormalizeRedirectEscapes = false
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/dir?q=%2f", nil)
+	router.ServeHTTP(w, r)
+	if location := w.Header().Get("Location"); location != "/dir/?q=%2f" {
+		t.Errorf("GET /dir?q=%%2f: got location %q, want %q", location, "/dir/?q=%2f")
+	}
+}
+
+func TestRouterHost(t *testing.T) {
+	var routed string
+	handle := func(name string) http.Handler {
+		return http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			routed = name + ":" + GetValue(r.Context(), "id")
+		})
+	}
+
+	router := New()
+	router.Get("/users/:id", handle("default"))
+	router.Host("api.example.com").Get("/users/:id", handle("api"))
+	router.Host("WWW.example.com").Get("/users/:id", handle("www"))
+	router.Host("www.example.com:8080").Get("/users/:id", handle("www8080"))
+
+	for _, test := range []struct {
+		host   string
+		path   string
+		code   int
+		routed string
+	}{
+		{"api.example.com", "/users/1", http.StatusOK, "api:1"},
+		{"API.Example.com:443", "/users/2", http.StatusOK, "api:2"},
+		{"www.example.com", "/users/3", http.StatusOK, "www:3"},
+		{"www.example.com:8080", "/users/4", http.StatusOK, "www8080:4"},
+		{"other.example.com", "/users/5", http.StatusOK, "default:5"},
+		{"api.example.com", "/nope", http.StatusNotFound, ""},
+	} {
+		routed = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		r.Host = test.host
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed {
+			t.Errorf("GET %s%s: got %d routed to %q, want %d routed to %q",
+				test.host, test.path, w.Code, routed, test.code, test.routed)
+		}
+	}
+
+	// requests to unknown hosts use UnknownHost
+	router.UnknownHost = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/users/5", nil)
+	r.Host = "other.example.com"
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusTeapot {
+		t.Errorf("unknown host: got %d, want %d", w.Code, http.StatusTeapot)
+	}
+
+	// unless there is a wildcard router
+	router.Host("*").Get("/users/:id", handle("wildcard"))
+	routed = ""
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || routed != "wildcard:5" {
+		t.Errorf("wildcard host: got %d routed to %q", w.Code, routed)
+	}
+
+	if router.Host("api.example.com") != router.Host("API.EXAMPLE.COM") {
+		t.Error("Host returned different routers for the same host")
+	}
+}
+
+func TestRouterHandles(t *testing.T) {
+	var served string
+	router := New()
+	router.Handles([]string{http.MethodGet, http.MethodPut, "REPORT", http.MethodGet}, "/res/:id",
+		http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			served = r.Method + " " + GetValue(r.Context(), "id")
+		})).Name("res")
+
+	for _, method := range []string{http.MethodGet, http.MethodPut, "REPORT"} {
+		served = ""
+		r, _ := http.NewRequest(method, "/res/1", nil)
+		router.ServeHTTP(new(mockResponseWriter), r)
+		if served != method+" 1" {
+			t.Errorf("%s /res/1: served %q", method, served)
+		}
+	}
+	if allow := strings.Join(router.AllowedMethods("/res/1"), ", "); allow != "GET, OPTIONS, PUT, REPORT" {
+		t.Errorf("unexpected allowed methods %q", allow)
+	}
+	if url, err := router.URL("res", "2"); err != nil || url != "/res/2" {
+		t.Errorf("URL of named route: got %q, %v", url, err)
+	}
+
+	for _, methods := range [][]string{nil, {""}, {"GET", "BAD METHOD"}, {"A/B"}} {
+		recv := catchPanic(func() {
+			router.Handles(methods, "/invalid", http.NotFoundHandler())
+		})
+		if rerr, ok := recv.(*RegistrationError); !ok || rerr.Kind != KindInvalidOption {
+			t.Errorf("Handles(%q): got panic %v", methods, recv)
+		}
+	}
+	if handle, _, _ := router.Lookup(http.MethodGet, "/invalid"); handle != nil {
+		t.Error("route with invalid methods was partially registered")
+	}
+}
+
+func TestRouterAny(t *testing.T) {
+	var routed string
+	handle := func(name string) http.Handler {
+		return http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+			routed = name
+		})
+	}
+
+	router := New()
+	router.Put("/proxy/*path", handle("put"))
+	router.Any("/proxy/*path", handle("any"))
+	router.Post("/proxy/*path", handle("post"))
+
+	for _, test := range []struct {
+		method string
+		routed string
+	}{
+		{http.MethodGet, "any"},
+		{http.MethodHead, "any"},
+		{http.MethodPost, "post"},
+		{http.MethodPut, "put"},
+		{http.MethodPatch, "any"},
+		{http.MethodDelete, "any"},
+		{http.MethodOptions, "any"},
+	} {
+		routed = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(test.method, "/proxy/a/b", nil)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || routed != test.routed {
+			t.Errorf("%s /proxy/a/b: got %d routed to %q, want %q", test.method, w.Code, routed, test.routed)
+		}
+	}
+
+	// methods not covered by Any are not allowed
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodTrace, "/proxy/a/b", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("TRACE /proxy/a/b: got %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	allow := strings.Split(w.Header().Get("Allow"), ", ")
+	sort.Strings(allow)
+	want := []string{"DELETE", "GET", "HEAD", "OPTIONS", "PATCH", "POST", "PUT"}
+	if !reflect.DeepEqual(allow, want) {
+		t.Errorf("TRACE /proxy/a/b: got Allow %v, want %v", allow, want)
+	}
+
+	// only the handles of Any can be replaced
+	recv := catchPanic(func() {
+		router.Post("/proxy/*path", handle("again"))
+	})
+	if err, ok := recv.(*RegistrationError); !ok || err.Kind != KindConflict {
+		t.Errorf("expected conflict panic, got %v", recv)
+	}
+
+	// with deferred registration
+	router = New()
+	router.DeferRegistration = true
+	router.Any("/", handle("any"))
+	router.Delete("/", handle("delete"))
+	router.Compile()
+	routed = ""
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodDelete, "/", nil)
+	router.ServeHTTP(w, r)
+	if routed != "delete" {
+		t.Errorf("DELETE /: routed to %q, want %q", routed, "delete")
+	}
+}
+
+func TestRouterRedirectBarePrefix(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Get("/docs/*path", handlerFunc)
+	router.Get("/users/:id/files/*path", handlerFunc)
+	router.Get("/src/*path", handlerFunc)
+	router.RedirectBarePrefix(http.MethodGet, "/docs/*path", "/docs/index")
+	router.RedirectBarePrefix(http.MethodGet, "/users/:id/files/*path", "/users/:id/files/home")
+
+	for _, test := range []struct {
+		path     string
+		location string
+	}{
+		{"/docs", "/docs/index"},
+		{"/docs?lang=en", "/docs/index?lang=en"},
+		{"/users/42/files", "/users/42/files/home"},
+		{"/src", "/src/"},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != test.location {
+			t.Errorf("GET %s: got %d to %q, want %d to %q", test.path,
+				w.Code, w.Header().Get("Location"), http.StatusMovedPermanently, test.location)
+		}
+	}
+
+	// the target is only used for the method it is set for
+	router.Post("/docs/*path", handlerFunc)
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodPost, "/docs", nil)
+	router.ServeHTTP(w, r)
+	if location := w.Header().Get("Location"); location != "/docs/" {
+		t.Errorf("POST /docs: got location %q, want %q", location, "/docs/")
+	}
+
+	for _, test := range []struct {
+		path, target string
+	}{
+		{"/docs/:name", "/docs/index"},
+		{"/docs/*path", "docs/index"},
+	} {
+		recv := catchPanic(func() {
+			router.RedirectBarePrefix(http.MethodGet, test.path, test.target)
+		})
+		if _, ok := recv.(*RegistrationError); !ok {
+			t.Errorf("expected registration error for %s to %s, got %v", test.path, test.target, recv)
+		}
+	}
+}
+
+func TestRouterAllowedMethods(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Post("/users/:id", handlerFunc)
+	router.Get("/users/:id", handlerFunc)
+	router.Options("/users/:id", handlerFunc)
+	router.Delete("/admin", handlerFunc)
+
+	for _, test := range []struct {
+		path    string
+		methods []string
+	}{
+		{"/users/42", []string{"GET", "OPTIONS", "POST"}},
+		{"/admin", []string{"DELETE", "OPTIONS"}},
+		{"*", []string{"DELETE", "GET", "OPTIONS", "POST"}},
+		{"/nope", nil},
+	} {
+		if methods := router.AllowedMethods(test.path); !reflect.DeepEqual(methods, test.methods) {
+			t.Errorf("AllowedMethods(%q) = %v, want %v", test.path, methods, test.methods)
+		}
+	}
+
+	// registered OPTIONS routes are listed like other methods without
+	// HandleOptions
+	router.HandleOptions = false
+	if methods, want := router.AllowedMethods("/admin"), []string{"DELETE"}; !reflect.DeepEqual(methods, want) {
+		t.Errorf("AllowedMethods(%q) = %v, want %v", "/admin", methods, want)
+	}
+	if methods, want := router.AllowedMethods("/users/42"), []string{"GET", "OPTIONS", "POST"}; !reflect.DeepEqual(methods, want) {
+		t.Errorf("AllowedMethods(%q) = %v, want %v", "/users/42", methods, want)
+	}
+}
+
+func TestRouterPatternHeader(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Get("/users/:id", handlerFunc)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/users/42", nil)
+	router.ServeHTTP(w, r)
+	if pattern := w.Header().Get("X-Route-Pattern"); pattern != "" {
+		t.Errorf("pattern header %q set while disabled", pattern)
+	}
+
+	router.PatternHeader = "X-Route-Pattern"
+	for _, test := range []struct {
+		path    string
+		pattern string
+	}{
+		{"/users/42", "/users/:id"},
+		{"/nope", ""},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if pattern := w.Header().Get("X-Route-Pattern"); pattern != test.pattern {
+			t.Errorf("GET %s: got pattern %q, want %q", test.path, pattern, test.pattern)
+		}
+	}
+}
+
+func TestRouterVersionPrefix(t *testing.T) {
+	var routed, version, id string
+	handle := func(name string) http.Handler {
+		return http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			routed = name
+			version = GetValue(r.Context(), VersionParam)
+			id = GetValue(r.Context(), "id")
+		})
+	}
+
+	router := New()
+	router.VersionPrefix = true
+	router.Get("/", handle("index"))
+	router.Get("/users/:id", handle("user"))
+	router.Get("/v2/users/:id", handle("user v2"))
+	router.Post("/orders", handle("orders"))
+
+	for _, test := range []struct {
+		path                string
+		code                int
+		routed, version, id string
+	}{
+		{"/users/42", http.StatusOK, "user", "", "42"},
+		{"/v1/users/42", http.StatusOK, "user", "v1", "42"},
+		{"/v12/users/42", http.StatusOK, "user", "v12", "42"},
+		{"/v2/users/42", http.StatusOK, "user v2", "v2", "42"},
+		{"/v1", http.StatusOK, "index", "v1", ""},
+		{"/v1/", http.StatusOK, "index", "v1", ""},
+		{"/vx/users/42", http.StatusNotFound, "", "", ""},
+		{"/v1beta/users/42", http.StatusNotFound, "", "", ""},
+		{"/v1/v1/users/42", http.StatusNotFound, "", "", ""},
+		{"/v1/users/42/", http.StatusMovedPermanently, "", "", ""},
+		{"/v1/orders", http.StatusMethodNotAllowed, "", "", ""},
+	} {
+		routed, version, id = "", "", ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed || version != test.version || id != test.id {
+			t.Errorf("GET %s: got %d routed to %q (version %q, id %q), want %d routed to %q (version %q, id %q)",
+				test.path, w.Code, routed, version, id, test.code, test.routed, test.version, test.id)
+		}
+	}
+
+	router.VersionPrefix = false
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/v1/users/42", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /v1/users/42 with VersionPrefix disabled: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestRouterWalk(t *testing.T) {
+	router := New()
+	paths := []string{
+		"/",
+		"/cmd/:tool/:sub",
+		"/cmd/:tool/",
+		"/src/*filepath",
+		"/search/",
+		"/search/:query",
+		"/user_:name",
+		"/user_:name/about",
+		"/files/:dir/*filepath",
+		"/doc/go_faq.html",
+		"/doc/go1.html",
+		"/doc/",
+		"/info/:user/public",
+		"/info/:user/project/:project",
+		"/static/:name.:ext",
+		`/x/:id/\:id`,
+		`/users/:id(\d+)`,
+		"/items/:id?",
+	}
+	for _, path := range paths {
+		router.Get(path, http.NotFoundHandler())
+	}
+	router.Post("/search/", http.NotFoundHandler())
+
+	var got []string
+	err := router.Walk(func(method, path string, handle http.Handler) error {
+		if handle == nil {
+			t.Errorf("%s %s: nil handle", method, path)
+		}
+		got = append(got, method+" "+path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk returned error: %v", err)
+	}
+
+	sort.Strings(paths)
+	var want []string
+	for _, path := range paths {
+		want = append(want, "GET "+path)
+	}
+	want = append(want, "POST /search/")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk visited\n%q\nwant\n%q", got, want)
+	}
+
+	errStop := errors.New("stop")
+	var visited int
+	err = router.Walk(func(method, path string, handle http.Handler) error {
+		visited++
+		if path == "/doc/" {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Errorf("Walk returned %v, want %v", err, errStop)
+	}
+	if visited != 4 {
+		t.Errorf("Walk visited %d routes before stopping, want 4", visited)
+	}
+}
+
+func TestRouterClone(t *testing.T) {
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Write([]byte(name))
+		})
+	}
+
+	router := New()
+	router.Get("/a", handler("a"))
+	router.Get("/b/:id", handler("b"))
+	router.Scheme("https").Get("/secure", handler("secure"))
+	router.Get("/named", handler("named")).Name("named")
+	router.Seal()
+
+	clone := router.Clone()
+	clone.Get("/c", handler("c"))
+	clone.Get("/b/:id/x", handler("bx"))
+	clone.Remove(http.MethodGet, "/a")
+	clone.Scheme("https").Get("/secure2", handler("secure2"))
+	clone.Get("/named2", handler("named2")).Name("named2")
+
+	serve := func(router *Router, scheme, path string) string {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, scheme+"://example.com"+path, nil)
+		if scheme == "https" {
+			r.TLS = new(tls.ConnectionState)
+		}
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			return ""
+		}
+		return w.Body.String()
+	}
+
+	for _, test := range []struct {
+		scheme, path, router, clone string
+	}{
+		{"http", "/a", "a", ""},
+		{"http", "/b/1", "b", "b"},
+		{"http", "/b/1/x", "", "bx"},
+		{"http", "/c", "", "c"},
+		{"https", "/secure", "secure", "secure"},
+		{"https", "/secure2", "", "secure2"},
+		{"https", "/c", "", "c"},
+	} {
+		if got := serve(router, test.scheme, test.path); got != test.router {
+			t.Errorf("router: GET %s %s served by %q, want %q", test.scheme, test.path, got, test.router)
+		}
+		if got := serve(clone, test.scheme, test.path); got != test.clone {
+			t.Errorf("clone: GET %s %s served by %q, want %q", test.scheme, test.path, got, test.clone)
+		}
+	}
+
+	if _, err := router.URL("named2"); err == nil {
+		t.Error("route named in the clone is named in the router")
+	}
+	if _, err := clone.URL("named"); err != nil {
+		t.Errorf("route named in the router is not named in the clone: %v", err)
+	}
+
+	// all exported fields are copied
+	router = New()
+	rv := reflect.ValueOf(router).Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Field(i)
+		if !f.CanSet() {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.Bool:
+			f.SetBool(true)
+		case reflect.Int:
+			f.SetInt(1)
+		case reflect.String:
+			f.SetString("x")
+		case reflect.Map:
+			f.Set(reflect.MakeMap(f.Type()))
+		case reflect.Slice:
+			f.Set(reflect.MakeSlice(f.Type(), 1, 1))
+		case reflect.Ptr:
+			f.Set(reflect.New(f.Type().Elem()))
+		case reflect.Func:
+			f.Set(reflect.MakeFunc(f.Type(), func([]reflect.Value) []reflect.Value { return nil }))
+		case reflect.Interface:
+			f.Set(reflect.ValueOf(handler("x")))
+		default:
+			t.Fatalf("unhandled type %s of field %s", f.Type(), rv.Type().Field(i).Name)
+		}
+	}
+	cv := reflect.ValueOf(router.Clone()).Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		f, cf := rv.Field(i), cv.Field(i)
+		if !f.CanSet() {
+			continue
+		}
+		var equal bool
+		switch f.Kind() {
+		case reflect.Func, reflect.Map, reflect.Slice, reflect.Ptr:
+			equal = f.Pointer() == cf.Pointer()
+		case reflect.Interface:
+			equal = f.Elem().Pointer() == cf.Elem().Pointer()
+		default:
+			equal = f.Interface() == cf.Interface()
+		}
+		if !equal {
+			t.Errorf("field %s is not copied by Clone", rv.Type().Field(i).Name)
+		}
+	}
+}
+
+func TestRouterConcurrentRegistration(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Get("/", handlerFunc)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				router.Get(fmt.Sprintf("/g%d/r%d", i, j), handlerFunc)
+				router.Host(fmt.Sprintf("h%d.example.com", i)).Get(fmt.Sprintf("/r%d", j), handlerFunc)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				w := new(mockResponseWriter)
+				r, _ := http.NewRequest(http.MethodGet, "/", nil)
+				router.ServeHTTP(w, r)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 50; j++ {
+			if handle, _, _ := router.Lookup(http.MethodGet, fmt.Sprintf("/g%d/r%d", i, j)); handle == nil {
+				t.Errorf("route /g%d/r%d is missing", i, j)
+			}
+		}
+	}
+}
+
+func TestRouterConcurrentIntrospection(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Get("/", handlerFunc)
+	router.Get("/q", handlerFunc).Query("a", "1")
+	router.HandleContentType(http.MethodPost, "/upload", "text/plain", handlerFunc)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				router.Get(fmt.Sprintf("/g%d/r%d", i, j), handlerFunc).Name(fmt.Sprintf("g%d-r%d", i, j))
+				router.Use(func(h http.Handler) http.Handler { return h })
+				router.Get("/q", handlerFunc).Query("b", fmt.Sprint(j))
+				router.HandleContentType(http.MethodPost, "/upload", fmt.Sprintf("text/x-%d-%d", i, j), handlerFunc)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				router.Lookup(http.MethodGet, fmt.Sprintf("/g%d/r%d", i, j))
+				router.LookupAll(http.MethodGet, "/")
+				router.Walk(func(_, _ string, _ http.Handler) error { return nil })
+				router.Routes()
+				router.MethodsFor("/")
+				router.AllowedMethods("/")
+				router.URL(fmt.Sprintf("g%d-r%d", i, j))
+
+				for _, req := range []struct{ method, path string }{
+					{http.MethodGet, "/q?a=1"},
+					{http.MethodPost, "/upload"},
+				} {
+					r, _ := http.NewRequest(req.method, req.path, nil)
+					r.Header.Set("Content-Type", "text/plain")
+					router.ServeHTTP(new(mockResponseWriter), r)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := len(router.Routes()); n != 4*50+3 {
+		t.Errorf("got %d routes, want %d", n, 4*50+3)
+	}
+}
+
+func TestRouterSeal(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.DeferRegistration = true
+	router.Get("/pending", handlerFunc)
+	hr := router.Host("api.example.com")
+	hr.Get("/api", handlerFunc)
+	router.Seal()
+	router.Seal() // no-op
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/pending", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("pending route was not compiled by Seal: got %d", w.Code)
+	}
+
+	for name, register := range map[string]func(){
+		"Handle":  func() { router.Get("/late", handlerFunc) },
+		"Any":     func() { router.Any("/late", handlerFunc) },
+		"Remove":  func() { router.Remove(http.MethodGet, "/pending") },
+		"Compile": func() { router.Compile() },
+		"Host":    func() { router.Host("www.example.com") },
+		"host":    func() { hr.Get("/late", handlerFunc) },
+	} {
+		recv := catchPanic(register)
+		if rerr, ok := recv.(*RegistrationError); !ok || rerr.Kind != KindSealed {
+			t.Errorf("%s after Seal: got panic %v", name, recv)
+		}
+	}
+
+	err := router.TryHandle(http.MethodGet, "/late", handlerFunc)
+	if rerr, ok := err.(*RegistrationError); !ok || rerr.Kind != KindSealed {
+		t.Errorf("TryHandle after Seal: got %v", err)
+	}
+}
+
+func TestRouterRemove(t *testing.T) {
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	router := New()
+	router.Get("/users", ok)
+	router.Get("/users/:id", ok)
+	router.Get("/items/:id?", ok)
+	router.Post("/users", ok)
+
+	if router.Remove(http.MethodGet, "/users/:name") {
+		t.Error("removing an unregistered route succeeded")
+	}
+	if router.Remove(http.MethodPut, "/users") {
+		t.Error("removing a route of an unregistered method succeeded")
+	}
+
+	for _, route := range [...]struct{ method, path string }{
+		{http.MethodGet, "/users"},
+		{http.MethodGet, "/items/:id?"},
+		{http.MethodPost, "/users"},
+	} {
+		if !router.Remove(route.method, route.path) {
+			t.Errorf("removing %s %s failed", route.method, route.path)
+		}
+		if router.Remove(route.method, route.path) {
+			t.Errorf("removing %s %s twice succeeded", route.method, route.path)
+		}
+	}
+
+	for _, test := range []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodGet, "/users/42", http.StatusOK},
+		{http.MethodGet, "/users", http.StatusNotFound},
+		{http.MethodGet, "/users/", http.StatusNotFound},
+		{http.MethodGet, "/USERS", http.StatusNotFound},
+		{http.MethodPost, "/users", http.StatusNotFound},
+		{http.MethodGet, "/items", http.StatusNotFound},
+		{http.MethodGet, "/items/1", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s %s: got %d, want %d", test.method, test.path, w.Code, test.code)
+		}
+	}
+
+	if _, ok := router.trees[http.MethodPost]; ok {
+		t.Error("tree of a method without routes was not removed")
+	}
+
+	router = New()
+	router.DeferRegistration = true
+	router.Get("/pending/:id", ok)
+	if !router.Remove(http.MethodGet, "/pending/:id") {
+		t.Error("removing a pending route failed")
+	}
+	router.Compile()
+	if handle, _, _ := router.Lookup(http.MethodGet, "/pending/1"); handle != nil {
+		t.Error("removed pending route was added by Compile")
+	}
+	// the name of a path is removed with its last route
+	router = New()
+	router.Handles([]string{http.MethodGet, http.MethodPut}, "/n/:id", ok).Name("n")
+	router.Remove(http.MethodGet, "/n/:id")
+	if u, err := router.URL("n", "1"); err != nil || u != "/n/1" {
+		t.Errorf("name of a path with a remaining route: got %q, %v", u, err)
+	}
+	router.Remove(http.MethodPut, "/n/:id")
+	if u, err := router.URL("n", "1"); err == nil {
+		t.Errorf("name of a removed path still builds %q", u)
+	}
+	router.Get("/n/:id", ok)
+	for _, route := range router.Routes() {
+		if route.Name != "" {
+			t.Errorf("re-added route has the stale name %q", route.Name)
+		}
+	}
+	router.Get("/m/:id", ok).Name("n")
+}
+
+func TestRouterResolve(t *testing.T) {
+	get := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	router := New()
+	router.Get("/users/:id", get)
+	router.Put("/users/:id", http.NotFoundHandler())
+	router.Post("/users", http.NotFoundHandler())
+
+	handle, ps, allow, tsr := router.Resolve(http.MethodGet, "/users/42")
+	if handle == nil || ps.ByName("id") != "42" || tsr {
+		t.Errorf("GET /users/42: got handle %v, params %v, tsr %t", handle, ps, tsr)
+	}
+	if want := []string{http.MethodGet, http.MethodOptions, http.MethodPut}; !reflect.DeepEqual(allow, want) {
+		t.Errorf("GET /users/42: got allow %q, want %q", allow, want)
+	}
+
+	handle, _, allow, tsr = router.Resolve(http.MethodDelete, "/users/42")
+	if handle != nil || tsr {
+		t.Errorf("DELETE /users/42: got handle %v, tsr %t", handle, tsr)
+	}
+	if want := []string{http.MethodGet, http.MethodOptions, http.MethodPut}; !reflect.DeepEqual(allow, want) {
+		t.Errorf("DELETE /users/42: got allow %q, want %q", allow, want)
+	}
+
+	handle, _, allow, tsr = router.Resolve(http.MethodPost, "/users/")
+	if handle != nil || allow != nil || !tsr {
+		t.Errorf("POST /users/: got handle %v, allow %q, tsr %t", handle, allow, tsr)
+	}
+
+	handle, _, allow, tsr = router.Resolve(http.MethodGet, "/nope")
+	if handle != nil || allow != nil || tsr {
+		t.Errorf("GET /nope: got handle %v, allow %q, tsr %t", handle, allow, tsr)
+	}
+
+	// Resolve and Lookup find the routes ServeHTTP serves.
+	router = New()
+	router.HandleHEADForGET = true
+	router.CaseInsensitive = true
+	router.Get("/a", get)
+
+	handle, _, allow, _ = router.Resolve(http.MethodGet, "/a")
+	if want := router.AllowedMethods("/a"); handle == nil || !reflect.DeepEqual(allow, want) {
+		t.Errorf("GET /a: got handle %v, allow %q, want allow %q", handle, allow, want)
+	}
+	if want := []string{http.MethodGet, http.MethodHead, http.MethodOptions}; !reflect.DeepEqual(allow, want) {
+		t.Errorf("GET /a: got allow %q, want %q", allow, want)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		for _, path := range []string{"/a", "/A"} {
+			if handle, _, _, _ := router.Resolve(method, path); handle == nil {
+				t.Errorf("Resolve(%s, %s): got no handle", method, path)
+			}
+			if handle, _, _ := router.Lookup(method, path); handle == nil {
+				t.Errorf("Lookup(%s, %s): got no handle", method, path)
+			}
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(method, path, nil)
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Errorf("%s %s: got status %d, want %d", method, path, w.Code, http.StatusOK)
+			}
+		}
+	}
+	if m, ok := router.Match(http.MethodHead, "/a"); !ok || m.Method != http.MethodGet || m.Path != "/a" {
+		t.Errorf("Match(HEAD, /a): got %+v, %t", m, ok)
+	}
+}
+
+func TestRouterMount(t *testing.T) {
+	var routed, id, path string
+	admin := New()
+	admin.Get("/users/:id", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		routed = "admin user"
+		id = GetValue(r.Context(), "id")
+		path = r.URL.Path
+	}))
+
+	router := New()
+	router.Mount("/admin/", admin)
+	router.Mount("/static", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		routed = "static " + r.Method
+		path = r.URL.Path
+	}))
+
+	for _, test := range []struct {
+		method, path        string
+		code                int
+		routed, id, urlPath string
+	}{
+		{http.MethodGet, "/admin/users/42", http.StatusOK, "admin user", "42", "/users/42"},
+		{http.MethodPost, "/admin/users/42", http.StatusMethodNotAllowed, "", "", ""},
+		{http.MethodGet, "/admin/nope", http.StatusNotFound, "", "", ""},
+		{http.MethodGet, "/admin", http.StatusMovedPermanently, "", "", ""},
+		{http.MethodGet, "/static/", http.StatusOK, "static GET", "", "/"},
+		{http.MethodDelete, "/static/a/b", http.StatusOK, "static DELETE", "", "/a/b"},
+	} {
+		routed, id, path = "", "", ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed || id != test.id || path != test.urlPath {
+			t.Errorf("%s %s: got %d routed to %q (id %q, path %q), want %d routed to %q (id %q, path %q)",
+				test.method, test.path, w.Code, routed, id, path, test.code, test.routed, test.id, test.urlPath)
+		}
+	}
+
+	for _, prefix := range [...]string{"", "/"} {
+		err, ok := catchPanic(func() { New().Mount(prefix, admin) }).(*RegistrationError)
+		if !ok || err.Kind != KindBadPath {
+			t.Errorf("mounting at '%s' did not panic with a bad path error: %v", prefix, err)
+		}
+	}
+}
+
+func TestRouterFormatSuffixes(t *testing.T) {
+	var routed, format, param string
+	handle := func(name, key string) http.Handler {
+		return http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			routed = name
+			format = GetValue(r.Context(), FormatParam)
+			param = GetValue(r.Context(), key)
+		})
+	}
+
+	router := New()
+	router.FormatSuffixes = []string{".json", ".xml"}
+	router.Get("/users/:id", handle("user", "id"))
+	router.Get("/src/*filepath", handle("src", "filepath"))
+	router.Get("/feed.xml", handle("feed", ""))
+	router.Get("/files/:name", handle("file", "name"))
+
+	for _, test := range []struct {
+		path                  string
+		code                  int
+		routed, format, param string
+	}{
+		{"/users/42", http.StatusOK, "user", "", "42"},
+		{"/users/42.json", http.StatusOK, "user", "json", "42"},
+		{"/users/42.xml", http.StatusOK, "user", "xml", "42"},
+		{"/users/42.yaml", http.StatusOK, "user", "", "42.yaml"},
+		{"/users/.json", http.StatusOK, "user", "", ".json"},
+		{"/src/a/b.json", http.StatusOK, "src", "json", "/a/b"},
+		{"/src/a/.json", http.StatusOK, "src", "", "/a/.json"},
+		{"/feed.xml", http.StatusOK, "feed", "", ""},
+		{"/users.json", http.StatusNotFound, "", "", ""},
+	} {
+		routed, format, param = "", "", ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed || format != test.format || param != test.param {
+			t.Errorf("GET %s: got %d routed to %q (format %q, param %q), want %d routed to %q (format %q, param %q)",
+				test.path, w.Code, routed, format, param, test.code, test.routed, test.format, test.param)
+		}
+	}
+}
+
+func TestRouterPoolParams(t *testing.T) {
+	var name string
+	var ps Params
+	router := New()
+	router.PoolParams = true
+	router.Get("/user/:name", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		name = GetValue(r.Context(), "name")
+		ps = GetParams(r.Context())
+	}))
+	router.Get("/files/:dir/*filepath", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		name = GetValue(r.Context(), "dir") + GetValue(r.Context(), "filepath")
+	}))
+
+	w := new(mockResponseWriter)
+	for _, test := range []struct{ path, want string }{
+		{"/user/gopher", "gopher"},
+		{"/files/a/b/c", "a/b/c"},
+		{"/user/gordon", "gordon"},
+	} {
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if name != test.want {
+			t.Errorf("GET %s: got param %q, want %q", test.path, name, test.want)
+		}
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	pooled := testing.AllocsPerRun(100, func() { router.ServeHTTP(w, r) })
+	router.PoolParams = false
+	unpooled := testing.AllocsPerRun(100, func() { router.ServeHTTP(w, r) })
+	if pooled >= unpooled {
+		t.Errorf("PoolParams did not reduce allocations: got %v, without %v", pooled, unpooled)
+	}
+	if ps.ByName("name") != "gopher" {
+		t.Errorf("got param %q from the params retained without PoolParams, want %q", ps.ByName("name"), "gopher")
+	}
+}
+
+func TestRouterStaticMallocs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping malloc count in short mode")
+	}
+	if runtime.GOMAXPROCS(0) > 1 {
+		t.Log("skipping AllocsPerRun checks; GOMAXPROCS>1")
+		return
+	}
+
+	var ps Params
+	router := New()
+	router.SkipStaticPattern = true
+	router.Get("/static/path", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		ps = GetParams(r.Context())
+	}))
+	router.Get("/user/:name", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest(http.MethodGet, "/static/path", nil)
+	for _, pool := range [...]bool{false, true} {
+		router.PoolParams = pool
+		if allocs := testing.AllocsPerRun(100, func() { router.ServeHTTP(w, r) }); allocs > 0 {
+			t.Errorf("GET /static/path (PoolParams=%t): %v allocs, want zero", pool, allocs)
+		}
+		if ps != nil {
+			t.Errorf("expected nil params for a route without params, got %v", ps)
+		}
+	}
+}
+
+func BenchmarkRouterStatic(b *testing.B) {
+	for _, skip := range [...]bool{false, true} {
+		b.Run(fmt.Sprintf("SkipStaticPattern=%t", skip), func(b *testing.B) {
+			router := New()
+			router.SkipStaticPattern = skip
+			router.Get("/static/path", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+			w := new(mockResponseWriter)
+			r, _ := http.NewRequest(http.MethodGet, "/static/path", nil)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				router.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+func BenchmarkRouterParams(b *testing.B) {
+	for _, pool := range [...]bool{false, true} {
+		b.Run(fmt.Sprintf("PoolParams=%t", pool), func(b *testing.B) {
+			router := New()
+			router.PoolParams = pool
+			router.Get("/user/:name", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+			w := new(mockResponseWriter)
+			r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				router.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+func TestRouterExtraParamsCapacity(t *testing.T) {
+	router := New()
+	router.VersionPrefix = true
+	router.FormatSuffixes = []string{".json"}
+	router.Get("/a/:b/c/:d/e/:f", http.NotFoundHandler())
+
+	// the version and format params must fit without growing the params
+	leaf, ps, _ := router.lookupLeaf(router.trees[http.MethodGet], "/v1/a/1/c/2/e/3.json", nil)
+	if leaf == nil || len(ps) != 5 || cap(ps) != 5 {
+		t.Errorf("got leaf %v with params %v (cap %d), want 5 params with cap 5", leaf, ps, cap(ps))
+	}
+}
+
+func BenchmarkRouterExtraParams(b *testing.B) {
+	router := New()
+	router.VersionPrefix = true
+	router.FormatSuffixes = []string{".json"}
+	router.Get("/a/:b/c/:d/e/:f", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest(http.MethodGet, "/v1/a/1/c/2/e/3.json", nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(w, r)
+	}
+}
+
+func TestRouterUnescapeParams(t *testing.T) {
+	var routed bool
+	var query, rest string
+	router := New()
+	router.Get("/search/:query/*rest", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		routed = true
+		query = GetValue(r.Context(), "query")
+		rest = GetValue(r.Context(), "rest")
+	}))
+
+	serve := func(path string) {
+		routed, query, rest = false, "", ""
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.URL.Path = path
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	serve("/search/a%20b/c%2Fd")
+	if query != "a%20b" || rest != "/c%2Fd" {
+		t.Errorf("params were decoded without UnescapeParams: got %q and %q", query, rest)
+	}
+
+	router.UnescapeParams = true
+	serve("/search/a%20b/c%2Fd")
+	if query != "a b" || rest != "/c/d" {
+		t.Errorf("got params %q and %q, want %q and %q", query, rest, "a b", "/c/d")
+	}
+
+	serve("/search/a%zzb/c")
+	if !routed || query != "a%zzb" || rest != "/c" {
+		t.Errorf("invalid escape: got routed %t with params %q and %q, want the raw values", routed, query, rest)
+	}
+
+	router.StrictUnescapeParams = true
+	serve("/search/a%zzb/c")
+	if routed {
+		t.Error("request with an invalid escape was routed with StrictUnescapeParams")
+	}
+	if o := router.Classify(http.MethodGet, "/search/a%zzb/c"); o.Kind != OutcomeNotFound {
+		t.Errorf("Classify with an invalid escape returned %v, want %v", o.Kind, OutcomeNotFound)
+	}
+}
+
+func TestRouterUseRawPath(t *testing.T) {
+	var value string
+	router := New()
+	router.Get("/files/*filepath", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		value = GetValue(r.Context(), "filepath")
+	}))
+	router.Get("/users/:name", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		value = GetValue(r.Context(), "name")
+	}))
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		value = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	if serve("/files/a%2Fb/c"); value != "/a/b/c" {
+		t.Errorf("without UseRawPath: got filepath %q, want %q", value, "/a/b/c")
+	}
+	if w := serve("/users/a%2Fb"); w.Code != http.StatusNotFound {
+		t.Errorf("without UseRawPath: got %d for an escaped slash in a param, want %d", w.Code, http.StatusNotFound)
+	}
+
+	router.UseRawPath = true
+	for _, test := range []struct {
+		path, value string
+		code        int
+		location    string
+	}{
+		{"/files/a%2Fb/c", "/a%2Fb/c", http.StatusOK, ""},
+		{"/files/a%20b", "/a%20b", http.StatusOK, ""},
+		{"/users/a%2Fb", "a%2Fb", http.StatusOK, ""},
+		{"/users/gopher", "gopher", http.StatusOK, ""},
+		{"/users/a%2Fb/", "", http.StatusMovedPermanently, "/users/a%2Fb"},
+		{"/USERS/a%2Fb", "", http.StatusMovedPermanently, "/users/a%2Fb"},
+	} {
+		w := serve(test.path)
+		if w.Code != test.code || value != test.value || w.Header().Get("Location") != test.location {
+			t.Errorf("GET %s: got %d with value %q and location %q, want %d with value %q and location %q",
+				test.path, w.Code, value, w.Header().Get("Location"), test.code, test.value, test.location)
+		}
+	}
+
+	router.UnescapeParams = true
+	if serve("/users/a%2Fb"); value != "a/b" {
+		t.Errorf("with UnescapeParams: got name %q, want %q", value, "a/b")
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// serveMuxMethods are the methods routes are registered for by FromServeMux,
+// as a http.ServeMux pattern without a method matches all of them.
+var serveMuxMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodConnect,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
+// FromServeMux returns a new Router with routes for the given patterns of mux.
+// A http.ServeMux does not expose its patterns, so they must be passed
+// explicitly. The handlers are looked up with mux.Handler.
+//
+// Exact paths like /index.html become routes with the same path, subtree
+// patterns like /static/ become catch-all routes like /static/*path, which
+// receive the unmodified request. Patterns may be prefixed with a method, as
+// in "GET /index.html", otherwise routes are registered for all standard
+// methods.
+//
+// Patterns the router cannot represent, e.g. patterns with a host, wildcards
+// or subtrees overlapping other patterns, are skipped and reported as errors.
+func FromServeMux(mux *http.ServeMux, patterns ...string) (*Router, []error) {
+	r := New()
+
+	var errs []error
+	for _, pattern := range patterns {
+		if err := r.addServeMuxPattern(mux, pattern); err != nil {
+			errs = append(errs, fmt.Errorf("httprouter: pattern %q: %v", pattern, err))
+		}
+	}
+
+	return r, errs
+}
+
+func (r *Router) addServeMuxPattern(mux *http.ServeMux, pattern string) error {
+	methods, path := serveMuxMethods, pattern
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		methods, path = []string{pattern[:i]}, strings.TrimLeft(pattern[i+1:], " ")
+	}
+
+	switch {
+	case path == "" || path[0] != '/':
+		return fmt.Errorf("patterns with a host are not supported")
+	case strings.ContainsAny(path, "{}:*"):
+		return fmt.Errorf("wildcards are not supported")
+	}
+
+	req := &http.Request{
+		Method: methods[0],
+		URL:    &url.URL{Path: path},
+		Header: make(http.Header),
+	}
+	handle, registered := mux.Handler(req)
+	if registered != pattern {
+		return fmt.Errorf("not registered with the ServeMux")
+	}
+
+	if path[len(path)-1] == '/' {
+		path += "*path"
+	}
+
+	for _, method := range methods {
+		if err := r.TryHandle(method, path, handle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
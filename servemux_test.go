@@ -0,0 +1,59 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFromServeMux(t *testing.T) {
+	var routed string
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			routed = name + " " + r.URL.Path
+		})
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/index.html", handler("index"))
+	mux.Handle("/static/", handler("static"))
+	mux.Handle("/static/app.js", handler("app"))
+	mux.Handle("example.com/", handler("host"))
+
+	router, errs := FromServeMux(mux,
+		"/index.html",
+		"/static/",
+		"/static/app.js",
+		"example.com/",
+		"/missing",
+	)
+
+	if len(errs) != 3 {
+		t.Errorf("expected 3 errors, got %v", errs)
+	}
+
+	for _, test := range []struct {
+		method, path string
+		code         int
+		routed       string
+	}{
+		{http.MethodGet, "/index.html", http.StatusOK, "index /index.html"},
+		{http.MethodPost, "/index.html", http.StatusOK, "index /index.html"},
+		{http.MethodGet, "/static/", http.StatusOK, "static /static/"},
+		{http.MethodGet, "/static/css/site.css", http.StatusOK, "static /static/css/site.css"},
+		{http.MethodGet, "/static", http.StatusMovedPermanently, ""},
+		{http.MethodGet, "/missing", http.StatusNotFound, ""},
+	} {
+		routed = ""
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed {
+			t.Errorf("routing %s %s failed: Code=%d, routed=%q", test.method, test.path, w.Code, routed)
+		}
+	}
+}
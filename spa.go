@@ -0,0 +1,64 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"path"
+)
+
+// SPA serves a single-page application from the given file system for all
+// GET and HEAD requests that no route matches. Requests for files that exist
+// in assets are answered with the file, all other requests are answered with
+// indexFile, e.g. "/index.html".
+//
+// Registered routes always take priority. SPA replaces the NotFound handler,
+// the previous NotFound handler is still used for all other request methods
+// and if indexFile does not exist.
+func (r *Router) SPA(indexFile string, assets http.FileSystem) {
+	r.NotFound = &spaHandler{
+		index:    path.Clean("/" + indexFile),
+		assets:   assets,
+		notFound: r.NotFound,
+	}
+}
+
+type spaHandler struct {
+	index    string
+	assets   http.FileSystem
+	notFound http.Handler
+}
+
+func (h *spaHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		if h.serveFile(w, req, path.Clean("/"+req.URL.Path)) ||
+			h.serveFile(w, req, h.index) {
+			return
+		}
+	}
+
+	if h.notFound != nil {
+		h.notFound.ServeHTTP(w, req)
+	} else {
+		http.NotFound(w, req)
+	}
+}
+
+// serveFile serves the named file if it exists and is not a directory.
+func (h *spaHandler) serveFile(w http.ResponseWriter, req *http.Request, name string) bool {
+	f, err := h.assets.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	d, err := f.Stat()
+	if err != nil || d.IsDir() {
+		return false
+	}
+
+	http.ServeContent(w, req, d.Name(), d.ModTime(), f)
+	return true
+}
@@ -0,0 +1,96 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRouterSPA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httprouter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"index.html":    "index",
+		"js/app.js":     "app",
+		"css/style.css": "style",
+	} {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router := New()
+	router.Get("/api/users", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("users"))
+	}))
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	router.SPA("index.html", http.Dir(dir))
+
+	for _, test := range []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{http.MethodGet, "/api/users", http.StatusOK, "users"},
+		{http.MethodGet, "/js/app.js", http.StatusOK, "app"},
+		{http.MethodGet, "/css/style.css", http.StatusOK, "style"},
+		{http.MethodGet, "/", http.StatusOK, "index"},
+		{http.MethodGet, "/css", http.StatusOK, "index"},
+		{http.MethodGet, "/users/gopher", http.StatusOK, "index"},
+		{http.MethodHead, "/users/gopher", http.StatusOK, ""},
+		{http.MethodPost, "/users/gopher", http.StatusTeapot, ""},
+	} {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Body.String() != test.body {
+			t.Errorf("SPA handling %s %s failed: Code=%d, Body=%q", test.method, test.path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRouterSPAMissingIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httprouter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	router := New()
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	router.SPA("index.html", http.Dir(dir))
+
+	r, _ := http.NewRequest(http.MethodGet, "/users/gopher", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusTeapot {
+		t.Errorf("previous NotFound handler not used without index file: Code=%d", w.Code)
+	}
+
+	router = New()
+	router.SPA("index.html", http.Dir(dir))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without index file, got Code=%d", w.Code)
+	}
+}
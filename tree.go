@@ -6,7 +6,10 @@ package httprouter
 
 import (
 	"net/http"
+	"regexp"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"unicode"
 	"unicode/utf8"
 )
@@ -21,6 +24,10 @@ func min(a, b int) int {
 func countParams(path string) uint8 {
 	var n uint
 	for i := 0; i < len(path); i++ {
+		if isEscaped(path, i) {
+			i++
+			continue
+		}
 		if path[i] != ':' && path[i] != '*' {
 			continue
 		}
@@ -32,6 +39,227 @@ func countParams(path string) uint8 {
 	return uint8(n)
 }
 
+// isEscaped reports whether path[i] is a backslash escaping a literal ':' or
+// '*', which would otherwise start a wildcard.
+func isEscaped(path string, i int) bool {
+	return path[i] == '\\' && i+1 < len(path) && (path[i+1] == ':' || path[i+1] == '*')
+}
+
+// unescape removes the backslashes escaping literal ':' and '*' from path.
+func unescape(path string) string {
+	if strings.IndexByte(path, '\\') < 0 {
+		return path
+	}
+
+	buf := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		if isEscaped(path, i) {
+			i++
+		}
+		buf = append(buf, path[i])
+	}
+	return string(buf)
+}
+
+// findCatchAll returns the index of the '*' starting the catch-all parameter
+// in path, or -1 if there is none.
+func findCatchAll(path string) int {
+	for i := 0; i < len(path); i++ {
+		if isEscaped(path, i) {
+			i++
+		} else if path[i] == '*' {
+			return i
+		}
+	}
+	return -1
+}
+
+// duplicateParam returns the first param name used more than once in path, or
+// an empty string if all names are unique.
+func duplicateParam(path string) string {
+	var names []string
+	for i := 0; i < len(path); i++ {
+		if isEscaped(path, i) {
+			i++
+			continue
+		}
+
+		c := path[i]
+		if c != ':' && c != '*' {
+			continue
+		}
+
+		// find wildcard end (either '/', an extension param or path end)
+		end := i + 1
+		for end < len(path) && path[end] != '/' &&
+			!(c == ':' && path[end] == '.' && end+1 < len(path) && path[end+1] == ':') {
+			end++
+		}
+
+		name := path[i+1 : end]
+		for _, n := range names {
+			if n == name {
+				return name
+			}
+		}
+		names = append(names, name)
+		i = end - 1
+	}
+	return ""
+}
+
+// expandPath returns the path matching the registered path pattern, with its
+// parameters replaced by the values of the params of the same name.
+func expandPath(pattern string, ps Params) string {
+	buf := make([]byte, 0, len(pattern))
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case isEscaped(pattern, i):
+			i++
+			buf = append(buf, pattern[i])
+
+		case c == ':' || c == '*':
+			// find wildcard end (either '/', an extension param or path end)
+			end := i + 1
+			for end < len(pattern) && pattern[end] != '/' &&
+				!(c == ':' && pattern[end] == '.' && end+1 < len(pattern) && pattern[end+1] == ':') {
+				end++
+			}
+
+			// the value of a catch-all includes the '/' before it
+			if c == '*' {
+				buf = buf[:len(buf)-1]
+			}
+			buf = append(buf, ps.ByName(pattern[i+1:end])...)
+			i = end - 1
+
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return string(buf)
+}
+
+// splitConstraints removes the regular expressions constraining named params
+// from path, e.g. /users/:id(\d+) becomes /users/:id, and returns them by the
+// name of the param.
+func splitConstraints(path string) (plain string, constraints map[string]string) {
+	if strings.IndexByte(path, '(') < 0 {
+		return path, nil
+	}
+
+	buf := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		if isEscaped(path, i) {
+			buf = append(buf, path[i:i+2]...)
+			i++
+			continue
+		}
+
+		buf = append(buf, path[i])
+		if path[i] != ':' {
+			continue
+		}
+
+		// find param name end (either '/', '(', '?', an extension param or
+		// path end)
+		end := i + 1
+		for end < len(path) && !strings.ContainsRune("/(?", rune(path[end])) &&
+			!(path[end] == '.' && end+1 < len(path) && path[end+1] == ':') {
+			end++
+		}
+		name := path[i+1 : end]
+		buf = append(buf, name...)
+		i = end - 1
+
+		if end == len(path) || path[end] != '(' {
+			continue
+		}
+
+		// find the matching parenthesis
+		depth, closing := 0, -1
+		for j := end; j < len(path) && closing < 0; j++ {
+			switch path[j] {
+			case '\\':
+				j++
+			case '(':
+				depth++
+			case ')':
+				if depth--; depth == 0 {
+					closing = j
+				}
+			}
+		}
+		if closing < 0 {
+			panic(registrationError(KindBadPath, path,
+				"unterminated constraint for param '"+name+"' in path '"+path+"'"))
+		}
+
+		if constraints == nil {
+			constraints = make(map[string]string)
+		}
+		constraints[name] = path[end+1 : closing]
+		i = closing
+	}
+
+	if constraints == nil {
+		return path, nil
+	}
+	return string(buf), constraints
+}
+
+// compileConstraint compiles the constraint of the named param of path, which
+// must match the whole value of the param.
+func compileConstraint(path, name, expr string) *regexp.Regexp {
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		panic(registrationError(KindBadPath, path,
+			"invalid constraint for param '"+name+"' in path '"+path+"': "+err.Error()))
+	}
+	return re
+}
+
+// splitOptional splits a path ending with an optional param, e.g. /items/:id?,
+// into the paths without and with the param, /items and /items/:id. name is
+// the name of the optional param, or empty if the path has none.
+func splitOptional(path string) (short, long, name string) {
+	for i := 0; i < len(path); i++ {
+		if isEscaped(path, i) {
+			i++
+			continue
+		}
+
+		c := path[i]
+		if c != ':' && c != '*' {
+			continue
+		}
+
+		// find wildcard end (either '/', an extension param or path end)
+		end := i + 1
+		for end < len(path) && path[end] != '/' &&
+			!(c == ':' && path[end] == '.' && end+1 < len(path) && path[end+1] == ':') {
+			end++
+		}
+		if path[end-1] != '?' {
+			i = end - 1
+			continue
+		}
+
+		if c != ':' || end != len(path) || path[i-1] != '/' {
+			panic(registrationError(KindBadPath, path,
+				"optional params must be the last path segment in path '"+path+"'"))
+		}
+
+		short = path[:i-1]
+		if short == "" {
+			short = "/"
+		}
+		return short, path[:end-1], path[i+1 : end-1]
+	}
+	return path, path, ""
+}
+
 type nodeType uint8
 
 const (
@@ -42,7 +270,14 @@ const (
 )
 
 type node struct {
+	// hits is accessed atomically and must come first to guarantee 64-bit
+	// alignment on 32-bit platforms.
+	hits uint64
+
 	path      string
+	key       string // the name of a param or catchAll node
+	match     func(value string) bool
+	re        *regexp.Regexp // the constraint of a param node, also set as match
 	wildChild bool
 	nType     nodeType
 	maxParams uint8
@@ -50,6 +285,26 @@ type node struct {
 	indices   string
 	children  []*node
 	handle    http.Handler
+
+	// fullPath is the registered path of the leaf holding handle.
+	fullPath string
+
+	// pattern is the path the route of the leaf was registered with,
+	// including constraints and optional params. Both leaves of a path with
+	// an optional param share it.
+	pattern string
+
+	// optional is the name of the optional param that is absent from the
+	// path of this leaf, see splitOptional.
+	optional string
+
+	// leaves indexes the leaves of the tree by their fullPath. It is only set
+	// on the root node.
+	leaves map[string]*node
+
+	// disabled is accessed atomically and is non-zero while the handle is
+	// disabled.
+	disabled uint32
 }
 
 // increments priority of the given child and reorders if necessary
@@ -79,6 +334,47 @@ func (n *node) incrementChildPrio(pos int) int {
 // addRoute adds a node with the given handle to the path.
 // Not concurrency-safe!
 func (n *node) addRoute(path string, handle http.Handler) {
+	// constraints are compiled and attached to the params of the plain path
+	plain, constraints := splitConstraints(path)
+	var res map[string]*regexp.Regexp
+	if constraints != nil {
+		res = make(map[string]*regexp.Regexp, len(constraints))
+		for name, expr := range constraints {
+			res[name] = compileConstraint(path, name, expr)
+		}
+	}
+
+	n.addPlainRoute(plain, handle)
+	n.setConstraints(path, plain, res)
+
+	short, long, _ := splitOptional(plain)
+	for _, p := range []string{long, short} {
+		if leaf := n.findLeaf(p); leaf != nil {
+			leaf.pattern = path
+		}
+	}
+}
+
+// addPlainRoute adds a node with the given handle to the path without
+// constraints.
+func (n *node) addPlainRoute(path string, handle http.Handler) {
+	// a path ending with an optional param is added as two routes, with and
+	// without the param
+	if short, long, name := splitOptional(path); name != "" {
+		n.addPlainRoute(long, handle)
+		n.addPlainRoute(short, handle)
+		if leaf := n.findLeaf(short); leaf != nil {
+			leaf.optional = name
+		}
+		return
+	}
+
+	if name := duplicateParam(path); name != "" {
+		panic(registrationError(KindDuplicateParam, path,
+			"duplicate param '"+name+"' in path '"+path+"'"))
+	}
+
+	tree := n
 	fullPath := path
 	n.priority++
 	numParams := countParams(path)
@@ -93,12 +389,22 @@ func (n *node) addRoute(path string, handle http.Handler) {
 			}
 
 			// Find the longest common prefix.
-			// This also implies that the common prefix contains no ':' or '*'
-			// since the existing key can't contain those chars.
-			i := 0
-			max := min(len(path), len(n.path))
-			for i < max && path[i] == n.path[i] {
+			// i is the length of the prefix in n.path, j in path, which may
+			// contain escaped ':' and '*'. The common prefix of a static node
+			// contains no wildcards, but it may contain literal ':' and '*'.
+			i, j := 0, 0
+			for i < len(n.path) && j < len(path) {
+				c, w := path[j], 1
+				if isEscaped(path, j) {
+					c, w = path[j+1], 2
+				} else if (c == ':' || c == '*') && n.nType != param && n.nType != catchAll {
+					break
+				}
+				if c != n.path[i] {
+					break
+				}
 				i++
+				j += w
 			}
 
 			// Split edge
@@ -111,6 +417,11 @@ func (n *node) addRoute(path string, handle http.Handler) {
 					children:  n.children,
 					handle:    n.handle,
 					priority:  n.priority - 1,
+					fullPath:  n.fullPath,
+					pattern:   n.pattern,
+					optional:  n.optional,
+					hits:      atomic.LoadUint64(&n.hits),
+					disabled:  atomic.LoadUint32(&n.disabled),
 				}
 
 				// Update maxParams (max of all children)
@@ -121,18 +432,31 @@ func (n *node) addRoute(path string, handle http.Handler) {
 				}
 
 				n.children = []*node{&child}
+				if child.handle != nil {
+					tree.indexLeaf(&child)
+				}
 				// []byte for proper unicode char conversion, see #65
 				n.indices = string([]byte{n.path[i]})
-				n.path = path[:i]
+				n.path = n.path[:i]
 				n.handle = nil
+				n.fullPath = ""
+				n.pattern = ""
+				n.optional = ""
+				atomic.StoreUint64(&n.hits, 0)
+				atomic.StoreUint32(&n.disabled, 0)
 				n.wildChild = false
 			}
 
 			// Make new node a child of this node
-			if i < len(path) {
-				path = path[i:]
+			if j < len(path) {
+				path = path[j:]
 
 				if n.wildChild {
+					// skip the dot before an extension param
+					if n.nType == param && path[0] == '.' {
+						path = path[1:]
+					}
+
 					n = n.children[0]
 					n.priority++
 
@@ -145,7 +469,9 @@ func (n *node) addRoute(path string, handle http.Handler) {
 					// Check if the wildcard matches
 					if len(path) >= len(n.path) && n.path == path[:len(n.path)] &&
 						// Check for longer wildcard, e.g. :name and :names
-						(len(n.path) >= len(path) || path[len(n.path)] == '/') {
+						(len(n.path) >= len(path) || path[len(n.path)] == '/' ||
+							// Check for an extension param, e.g. :name.:ext
+							(n.nType == param && strings.HasPrefix(path[len(n.path):], ".:"))) {
 						continue walk
 					} else {
 						// Wildcard conflict
@@ -156,15 +482,42 @@ func (n *node) addRoute(path string, handle http.Handler) {
 							pathSeg = strings.SplitN(path, "/", 2)[0]
 						}
 						prefix := fullPath[:strings.Index(fullPath, pathSeg)] + n.path
-						panic("'" + pathSeg +
-							"' in new path '" + fullPath +
-							"' conflicts with existing wildcard '" + n.path +
-							"' in existing prefix '" + prefix +
-							"'")
+						panic(registrationError(KindConflict, fullPath,
+							"'"+pathSeg+
+								"' in new path '"+fullPath+
+								"' conflicts with existing wildcard '"+n.path+
+								"' in existing prefix '"+prefix+
+								"'"))
 					}
 				}
 
-				c := path[0]
+				c, wild := path[0], path[0] == ':' || path[0] == '*'
+				if isEscaped(path, 0) {
+					c = path[1]
+				}
+
+				// extension param after a param without one
+				if n.nType == param && c == '.' {
+					seg := strings.SplitN(path[1:], "/", 2)[0]
+					if strings.ContainsAny(seg[1:], ":*") {
+						panic(registrationError(KindBadPath, fullPath,
+							"only one wildcard per path segment is allowed, has: '"+
+								path+"' in path '"+fullPath+"'"))
+					}
+					if len(n.children) > 0 {
+						panic(registrationError(KindConflict, fullPath,
+							"wildcard route '"+seg+
+								"' conflicts with existing children in path '"+fullPath+"'"))
+					}
+
+					// insert the extension param below a placeholder node and
+					// hoist it to become the wildcard child of this param
+					child := &node{}
+					tree.indexLeaf(child.insertChild(numParams, path[1:], fullPath, handle))
+					n.children = child.children
+					n.wildChild = true
+					return
+				}
 
 				// slash after param
 				if n.nType == param && c == '/' && len(n.children) == 1 {
@@ -174,7 +527,7 @@ func (n *node) addRoute(path string, handle http.Handler) {
 				}
 
 				// Check if a child with the next path byte exists
-				for i := 0; i < len(n.indices); i++ {
+				for i := 0; i < len(n.indices) && !wild; i++ {
 					if c == n.indices[i] {
 						i = n.incrementChildPrio(i)
 						n = n.children[i]
@@ -183,7 +536,7 @@ func (n *node) addRoute(path string, handle http.Handler) {
 				}
 
 				// Otherwise insert it
-				if c != ':' && c != '*' {
+				if !wild {
 					// []byte for proper unicode char conversion, see #65
 					n.indices += string([]byte{c})
 					child := &node{
@@ -193,41 +546,65 @@ func (n *node) addRoute(path string, handle http.Handler) {
 					n.incrementChildPrio(len(n.indices) - 1)
 					n = child
 				}
-				n.insertChild(numParams, path, fullPath, handle)
+				tree.indexLeaf(n.insertChild(numParams, path, fullPath, handle))
 				return
 
-			} else if i == len(path) { // Make node a (in-path) leaf
+			} else if j == len(path) { // Make node a (in-path) leaf
 				if n.handle != nil {
-					panic("a handle is already registered for path '" + fullPath + "'")
+					panic(registrationError(KindConflict, fullPath,
+						"a handle is already registered for path '"+fullPath+"'"))
 				}
 				n.handle = handle
+				n.fullPath = fullPath
+				tree.indexLeaf(n)
 			}
 			return
 		}
 	} else { // Empty tree
-		n.insertChild(numParams, path, fullPath, handle)
+		n.maxParams = numParams
+		tree.indexLeaf(n.insertChild(numParams, path, fullPath, handle))
 		n.nType = root
 	}
 }
 
-func (n *node) insertChild(numParams uint8, path, fullPath string, handle http.Handler) {
+// indexLeaf adds the leaf to the index of the tree rooted at n.
+func (n *node) indexLeaf(leaf *node) {
+	if n.leaves == nil {
+		n.leaves = make(map[string]*node)
+	}
+	n.leaves[leaf.fullPath] = leaf
+}
+
+// insertChild inserts the rest of path below n and returns the leaf holding
+// handle.
+func (n *node) insertChild(numParams uint8, path, fullPath string, handle http.Handler) *node {
 	var offset int // already handled bytes of the path
 
 	// find prefix until first wildcard (beginning with ':'' or '*'')
 	for i, max := 0, len(path); numParams > 0; i++ {
+		if isEscaped(path, i) {
+			i++
+			continue
+		}
+
 		c := path[i]
 		if c != ':' && c != '*' {
 			continue
 		}
 
-		// find wildcard end (either '/' or path end)
+		// find wildcard end (either '/', an extension param or path end)
 		end := i + 1
 		for end < max && path[end] != '/' {
+			if c == ':' && path[end] == '.' && end+1 < max && path[end+1] == ':' {
+				break
+			}
+
 			switch path[end] {
 			// the wildcard name must not contain ':' and '*'
 			case ':', '*':
-				panic("only one wildcard per path segment is allowed, has: '" +
-					path[i:] + "' in path '" + fullPath + "'")
+				panic(registrationError(KindBadPath, fullPath,
+					"only one wildcard per path segment is allowed, has: '"+
+						path[i:]+"' in path '"+fullPath+"'"))
 			default:
 				end++
 			}
@@ -236,19 +613,21 @@ func (n *node) insertChild(numParams uint8, path, fullPath string, handle http.H
 		// check if this Node existing children which would be
 		// unreachable if we insert the wildcard here
 		if len(n.children) > 0 {
-			panic("wildcard route '" + path[i:end] +
-				"' conflicts with existing children in path '" + fullPath + "'")
+			panic(registrationError(KindConflict, fullPath,
+				"wildcard route '"+path[i:end]+
+					"' conflicts with existing children in path '"+fullPath+"'"))
 		}
 
 		// check if the wildcard has a name
 		if end-i < 2 {
-			panic("wildcards must be named with a non-empty name in path '" + fullPath + "'")
+			panic(registrationError(KindBadPath, fullPath,
+				"wildcards must be named with a non-empty name in path '"+fullPath+"'"))
 		}
 
 		if c == ':' { // param
 			// split path at the beginning of the wildcard
 			if i > 0 {
-				n.path = path[offset:i]
+				n.path = unescape(path[offset:i])
 				offset = i
 			}
 
@@ -262,10 +641,51 @@ func (n *node) insertChild(numParams uint8, path, fullPath string, handle http.H
 			n.priority++
 			numParams--
 
+			// an extension param, e.g. :name.:ext, splits the rest of the
+			// path segment at the last dot
+			if end < max && path[end] == '.' {
+				n.path = path[offset:end]
+				n.key = n.path[1:]
+				offset = end + 1
+
+				end = offset + 1
+				for end < max && path[end] != '/' {
+					switch path[end] {
+					// the wildcard name must not contain ':' and '*'
+					case ':', '*':
+						panic(registrationError(KindBadPath, fullPath,
+							"only one wildcard per path segment is allowed, has: '"+
+								path[i:]+"' in path '"+fullPath+"'"))
+					default:
+						end++
+					}
+				}
+
+				// check if the wildcard has a name
+				if end-offset < 2 {
+					panic(registrationError(KindBadPath, fullPath,
+						"wildcards must be named with a non-empty name in path '"+fullPath+"'"))
+				}
+
+				child := &node{
+					nType:     param,
+					maxParams: numParams,
+				}
+				n.children = []*node{child}
+				n.wildChild = true
+				n = child
+				n.priority++
+				numParams--
+
+				// skip the extension param
+				i = end
+			}
+
 			// if the path doesn't end with the wildcard, then there
 			// will be another non-wildcard subpath starting with '/'
 			if end < max {
 				n.path = path[offset:end]
+				n.key = n.path[1:]
 				offset = end
 
 				child := &node{
@@ -278,20 +698,23 @@ func (n *node) insertChild(numParams uint8, path, fullPath string, handle http.H
 
 		} else { // catchAll
 			if end != max || numParams > 1 {
-				panic("catch-all routes are only allowed at the end of the path in path '" + fullPath + "'")
+				panic(registrationError(KindBadPath, fullPath,
+					"catch-all routes are only allowed at the end of the path in path '"+fullPath+"'"))
 			}
 
 			if len(n.path) > 0 && n.path[len(n.path)-1] == '/' {
-				panic("catch-all conflicts with existing handle for the path segment root in path '" + fullPath + "'")
+				panic(registrationError(KindConflict, fullPath,
+					"catch-all conflicts with existing handle for the path segment root in path '"+fullPath+"'"))
 			}
 
 			// currently fixed width 1 for '/'
 			i--
 			if path[i] != '/' {
-				panic("no / before catch-all in path '" + fullPath + "'")
+				panic(registrationError(KindBadPath, fullPath,
+					"no / before catch-all in path '"+fullPath+"'"))
 			}
 
-			n.path = path[offset:i]
+			n.path = unescape(path[offset:i])
 
 			// first node: catchAll node with empty path
 			child := &node{
@@ -307,20 +730,27 @@ func (n *node) insertChild(numParams uint8, path, fullPath string, handle http.H
 			// second node: node holding the variable
 			child = &node{
 				path:      path[i:],
+				key:       path[i+2:],
 				nType:     catchAll,
 				maxParams: 1,
 				handle:    handle,
 				priority:  1,
+				fullPath:  fullPath,
 			}
 			n.children = []*node{child}
 
-			return
+			return child
 		}
 	}
 
 	// insert remaining path part and handle to the leaf
-	n.path = path[offset:]
+	n.path = unescape(path[offset:])
+	if n.nType == param {
+		n.key = n.path[1:]
+	}
 	n.handle = handle
+	n.fullPath = fullPath
+	return n
 }
 
 // Returns the handle registered with the given path (key). The values of
@@ -329,6 +759,32 @@ func (n *node) insertChild(numParams uint8, path, fullPath string, handle http.H
 // made if a handle exists with an extra (without the) trailing slash for the
 // given path.
 func (n *node) getValue(path string) (handle http.Handler, p Params, tsr bool) {
+	leaf, p, tsr := n.getLeaf(path)
+	if leaf != nil {
+		handle = leaf.handle
+	}
+	return
+}
+
+// Returns the leaf node holding the handle registered with the given path
+// (key), otherwise it behaves exactly like getValue.
+func (n *node) getLeaf(path string) (leaf *node, p Params, tsr bool) {
+	return n.getLeafBuf(path, nil, 0)
+}
+
+// newParams returns buf emptied if its capacity is at least size, otherwise a
+// new slice with a capacity of size.
+func newParams(buf Params, size int) Params {
+	if cap(buf) >= size {
+		return buf[:0]
+	}
+	return make(Params, 0, size)
+}
+
+// getLeafBuf is like getLeaf, but the params are stored in buf if its capacity
+// is sufficient. Otherwise the params are allocated with room for extra params
+// to be appended by the caller.
+func (n *node) getLeafBuf(path string, buf Params, extra uint8) (leaf *node, p Params, tsr bool) {
 walk: // outer loop for walking the tree
 	for {
 		if len(path) > len(n.path) {
@@ -367,27 +823,51 @@ walk: // outer loop for walking the tree
 					// save param value
 					if p == nil {
 						// lazy allocation
-						p = make(Params, 0, n.maxParams)
+						p = newParams(buf, int(n.maxParams)+int(extra))
+					}
+
+					// split the segment at the last dot for an extension
+					// param, if there is none only this param can match
+					if n.wildChild {
+						if dot := strings.LastIndexByte(path[:end], '.'); dot > 0 && dot < end-1 {
+							i := len(p)
+							p = p[:i+1] // expand slice within preallocated capacity
+							p[i].Key = n.key
+							p[i].Value = path[:dot]
+							if !n.matches(p[i].Value) {
+								return nil, nil, false
+							}
+
+							path = path[dot+1:]
+							end -= dot + 1
+							n = n.children[0]
+						}
 					}
+
 					i := len(p)
 					p = p[:i+1] // expand slice within preallocated capacity
-					p[i].Key = n.path[1:]
+					p[i].Key = n.key
 					p[i].Value = path[:end]
+					if !n.matches(p[i].Value) {
+						return nil, nil, false
+					}
 
 					// we need to go deeper!
 					if end < len(path) {
-						if len(n.children) > 0 {
+						if len(n.children) > 0 && !n.wildChild {
 							path = path[end:]
 							n = n.children[0]
 							continue walk
 						}
 
 						// ... but we can't
-						tsr = (len(path) == end+1)
+						tsr = (len(path) == end+1 && n.handle != nil)
 						return
 					}
 
-					if handle = n.handle; handle != nil {
+					if n.handle != nil {
+						leaf = n
+						p = n.appendOptional(p)
 						return
 					} else if len(n.children) == 1 {
 						// No handle found. Check if a handle for this path + a
@@ -402,14 +882,19 @@ walk: // outer loop for walking the tree
 					// save param value
 					if p == nil {
 						// lazy allocation
-						p = make(Params, 0, n.maxParams)
+						p = newParams(buf, int(n.maxParams)+int(extra))
 					}
 					i := len(p)
 					p = p[:i+1] // expand slice within preallocated capacity
-					p[i].Key = n.path[2:]
+					p[i].Key = n.key
 					p[i].Value = path
+					if !n.matches(p[i].Value) {
+						return nil, nil, false
+					}
 
-					handle = n.handle
+					if n.handle != nil {
+						leaf = n
+					}
 					return
 
 				default:
@@ -419,7 +904,9 @@ walk: // outer loop for walking the tree
 		} else if path == n.path {
 			// We should have reached the node containing the handle.
 			// Check if this node has a handle registered.
-			if handle = n.handle; handle != nil {
+			if n.handle != nil {
+				leaf = n
+				p = n.appendOptional(p)
 				return
 			}
 
@@ -451,6 +938,385 @@ walk: // outer loop for walking the tree
 	}
 }
 
+// getAll calls fn for every leaf holding a handle whose path matches the given
+// path, in the order getLeaf prefers them. Unlike getLeaf, it does not stop at
+// the first match: a value with a dot also matches the param itself if an
+// extension param follows it.
+func (n *node) getAll(path string, p Params, fn func(leaf *node, p Params)) {
+	if !strings.HasPrefix(path, n.path) {
+		return
+	}
+	path = path[len(n.path):]
+
+	if path == "" {
+		if n.handle != nil {
+			fn(n, n.appendOptional(p))
+		}
+		return
+	}
+
+	if !n.wildChild {
+		for i := 0; i < len(n.indices); i++ {
+			if path[0] == n.indices[i] {
+				n.children[i].getAll(path, p, fn)
+			}
+		}
+		return
+	}
+
+	n = n.children[0]
+	switch n.nType {
+	case param:
+		// find param end (either '/' or path end)
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+
+		if n.wildChild {
+			if dot := strings.LastIndexByte(path[:end], '.'); dot > 0 && dot < end-1 && n.matches(path[:dot]) {
+				n.children[0].getAllParam(path[dot+1:], end-dot-1, withParam(p, n.key, path[:dot]), fn)
+			}
+		}
+		n.getAllParam(path, end, p, fn)
+
+	case catchAll:
+		if n.handle != nil && n.matches(path) {
+			fn(n, withParam(p, n.key, path))
+		}
+
+	default:
+		panic("invalid node type")
+	}
+}
+
+// getAllParam continues getAll at the param node n, whose value is path[:end].
+func (n *node) getAllParam(path string, end int, p Params, fn func(leaf *node, p Params)) {
+	if !n.matches(path[:end]) {
+		return
+	}
+	p = withParam(p, n.key, path[:end])
+
+	if end == len(path) {
+		if n.handle != nil {
+			fn(n, n.appendOptional(p))
+		}
+		return
+	}
+
+	if len(n.children) > 0 && !n.wildChild {
+		n.children[0].getAll(path[end:], p, fn)
+	}
+}
+
+// withParam returns a copy of p with the given param appended, so the
+// alternatives explored by getAll don't share their params.
+func withParam(p Params, key, value string) Params {
+	ps := make(Params, len(p), len(p)+1)
+	copy(ps, p)
+	return append(ps, Param{key, value})
+}
+
+// walk calls fn for every node in the tree that has a handle registered.
+func (n *node) walk(fn func(n *node)) {
+	if n.handle != nil {
+		fn(n)
+	}
+	for _, child := range n.children {
+		child.walk(fn)
+	}
+}
+
+// walkPaths calls fn for every node in the tree that has a handle registered,
+// in lexical order of their paths. Walking stops at the first non-nil error
+// returned by fn.
+func (n *node) walkPaths(fn func(n *node) error) error {
+	if n.handle != nil {
+		if err := fn(n); err != nil {
+			return err
+		}
+	}
+
+	children := make([]*node, len(n.children))
+	copy(children, n.children)
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].path < children[j].path
+	})
+
+	for _, child := range children {
+		if err := child.walkPaths(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendOptional appends the optional param that is absent from the path of
+// the leaf n, if any, with an empty value to p.
+func (n *node) appendOptional(p Params) Params {
+	if n.optional == "" {
+		return p
+	}
+	return append(p, Param{Key: n.optional})
+}
+
+// matches reports whether value is accepted by the matcher of the node.
+func (n *node) matches(value string) bool {
+	return n.match == nil || n.match(value)
+}
+
+// findRoute returns the nodes from n down to the leaf holding the handle
+// registered with exactly the given path, or nil if there is none.
+func (n *node) findRoute(fullPath string) []*node {
+	if n.handle != nil && n.fullPath == fullPath {
+		return []*node{n}
+	}
+	for _, child := range n.children {
+		if route := child.findRoute(fullPath); route != nil {
+			return append([]*node{n}, route...)
+		}
+	}
+	return nil
+}
+
+// remove removes the handle registered with exactly the given path, removing
+// the nodes left without a handle or children and merging the static node
+// left with a single static child, so the tree is the same as if the handle
+// had never been added. It reports whether a handle was removed.
+// Not concurrency-safe!
+func (n *node) remove(fullPath string) bool {
+	route := n.findRoute(fullPath)
+	if route == nil {
+		return false
+	}
+
+	leaf := route[len(route)-1]
+	delete(n.leaves, leaf.fullPath)
+	leaf.handle = nil
+	leaf.fullPath = ""
+	leaf.pattern = ""
+	leaf.optional = ""
+	leaf.hits = 0
+	leaf.disabled = 0
+
+	for _, n := range route {
+		if n.priority > 0 {
+			n.priority--
+		}
+	}
+
+	i := len(route) - 1
+	for ; i > 0 && route[i].handle == nil && len(route[i].children) == 0; i-- {
+		route[i-1].removeChild(route[i])
+	}
+	route[i].mergeChild()
+	if route[i].handle != nil {
+		// the leaf merged into its parent moved
+		n.indexLeaf(route[i])
+	}
+	return true
+}
+
+// removeChild removes the given child node from n.
+func (n *node) removeChild(child *node) {
+	for i, c := range n.children {
+		if c != child {
+			continue
+		}
+
+		// param nodes don't index their children
+		if len(n.indices) == len(n.children) {
+			n.indices = n.indices[:i] + n.indices[i+1:]
+		}
+		n.children = append(n.children[:i:i], n.children[i+1:]...)
+		if len(n.children) == 0 {
+			n.children = nil
+			n.wildChild = false
+		}
+		return
+	}
+}
+
+// mergeChild merges the only child of n into n if both are static and n has
+// no handle, undoing the edge split made when the child's sibling was added.
+func (n *node) mergeChild() {
+	if n.handle != nil || n.wildChild || len(n.children) != 1 ||
+		(n.nType != static && n.nType != root) {
+		return
+	}
+
+	child := n.children[0]
+	if child.nType != static {
+		return
+	}
+
+	n.path += child.path
+	n.wildChild = child.wildChild
+	n.indices = child.indices
+	n.children = child.children
+	n.handle = child.handle
+	n.priority = child.priority
+	n.fullPath = child.fullPath
+	n.pattern = child.pattern
+	n.optional = child.optional
+	n.hits = child.hits
+	n.disabled = child.disabled
+}
+
+// setMatchers attaches the given matchers to the param and catchAll nodes of
+// the route registered with exactly the given path. All routes sharing such a
+// node share its matcher.
+func (n *node) setMatchers(fullPath string, matchers map[string]func(string) bool) {
+	var wildcards []*node
+	for _, n := range n.findRoute(fullPath) {
+		if n.key == "" || matchers[n.key] == nil {
+			continue
+		}
+		if n.match != nil {
+			panic(registrationError(KindConflict, fullPath,
+				"a matcher is already registered for '"+n.key+
+					"' in path '"+fullPath+"'"))
+		}
+		wildcards = append(wildcards, n)
+	}
+
+	if len(wildcards) != len(matchers) {
+		panic(registrationError(KindInvalidOption, fullPath,
+			"matchers must belong to params of path '"+fullPath+"'"))
+	}
+
+	for _, n := range wildcards {
+		n.match = matchers[n.key]
+	}
+}
+
+// setConstraints attaches the given constraints to the param nodes of the route
+// registered with the given plain path. As a param node is shared by all routes
+// with the same prefix, a constraint may only be attached to a node which is
+// not passed by routes without the same constraint. Otherwise the route is
+// removed again and setConstraints panics.
+func (n *node) setConstraints(path, plain string, res map[string]*regexp.Regexp) {
+	short, long, _ := splitOptional(plain)
+	paths := []string{long, short}
+
+	conflict := func(msg string) {
+		for _, p := range paths {
+			n.remove(p)
+		}
+		panic(registrationError(KindConflict, path, msg))
+	}
+
+	var constrain []*node
+	for _, n := range n.findRoute(long) {
+		if n.nType != param {
+			continue
+		}
+
+		re := res[n.key]
+		switch {
+		case re == nil:
+			if n.re != nil {
+				conflict("param '" + n.key + "' is constrained by other routes in path '" + path + "'")
+			}
+		case n.re != nil:
+			if n.re.String() != re.String() {
+				conflict("a different constraint is already registered for '" + n.key +
+					"' in path '" + path + "'")
+			}
+		case n.match != nil:
+			conflict("a matcher is already registered for '" + n.key + "' in path '" + path + "'")
+		default:
+			if other := n.otherRoute(paths); other != "" {
+				conflict("the constraint for '" + n.key + "' would also apply to '" + other +
+					"' in path '" + path + "'")
+			}
+			constrain = append(constrain, n)
+		}
+	}
+
+	for _, n := range constrain {
+		n.re = res[n.key]
+		n.match = n.re.MatchString
+	}
+}
+
+// otherRoute returns the registered path of a route below n other than the
+// given ones, or an empty string if there is none.
+func (n *node) otherRoute(paths []string) string {
+	var other string
+	n.walk(func(leaf *node) {
+		for _, path := range paths {
+			if leaf.fullPath == path {
+				return
+			}
+		}
+		if other == "" {
+			other = leaf.fullPath
+		}
+	})
+	return other
+}
+
+// clone returns a deep copy of the tree rooted at n. The handles, param
+// matchers and constraints are shared.
+func (n *node) clone() *node {
+	c := &node{
+		hits:      atomic.LoadUint64(&n.hits),
+		path:      n.path,
+		key:       n.key,
+		match:     n.match,
+		re:        n.re,
+		wildChild: n.wildChild,
+		nType:     n.nType,
+		maxParams: n.maxParams,
+		priority:  n.priority,
+		indices:   n.indices,
+		handle:    n.handle,
+		fullPath:  n.fullPath,
+		pattern:   n.pattern,
+		optional:  n.optional,
+		disabled:  atomic.LoadUint32(&n.disabled),
+	}
+	if n.children != nil {
+		c.children = make([]*node, len(n.children))
+		for i, child := range n.children {
+			c.children[i] = child.clone()
+		}
+	}
+	if n.leaves != nil {
+		c.walk(c.indexLeaf)
+	}
+	return c
+}
+
+// findLeaf returns the node holding the handle registered with exactly the
+// given path, or nil if there is none. For a path with an optional param, it
+// returns the leaf with the param.
+func (n *node) findLeaf(fullPath string) *node {
+	plain, _ := splitConstraints(fullPath)
+	_, long, _ := splitOptional(plain)
+	return n.leaves[long]
+}
+
+// findLeaves returns the nodes holding the handle registered with exactly the
+// given path, both leaves of a path with an optional param.
+func (n *node) findLeaves(fullPath string) []*node {
+	plain, _ := splitConstraints(fullPath)
+	short, long, name := splitOptional(plain)
+	paths := []string{long}
+	if name != "" {
+		paths = append(paths, short)
+	}
+
+	var leaves []*node
+	for _, path := range paths {
+		if leaf := n.leaves[path]; leaf != nil {
+			leaves = append(leaves, leaf)
+		}
+	}
+	return leaves
+}
+
 // Makes a case-insensitive lookup of the given path and tries to find a handler.
 // It can optionally also fix trailing slashes.
 // It returns the case-corrected path and a bool indicating whether the lookup
@@ -581,9 +1447,24 @@ walk: // outer loop for walking the tree
 				// add param value to case insensitive path
 				ciPath = append(ciPath, path[:k]...)
 
+				// continue with the extension param, if the segment has one
+				value := path[:k]
+				if n.wildChild {
+					if dot := strings.LastIndexByte(path[:k], '.'); dot > 0 && dot < k-1 {
+						if !n.matches(path[:dot]) {
+							return ciPath, false
+						}
+						n = n.children[0]
+						value = path[dot+1 : k]
+					}
+				}
+				if !n.matches(value) {
+					return ciPath, false
+				}
+
 				// we need to go deeper!
 				if k < len(path) {
-					if len(n.children) > 0 {
+					if len(n.children) > 0 && !n.wildChild {
 						// continue with child node
 						n = n.children[0]
 						loNPath = strings.ToLower(n.path)
@@ -593,7 +1474,7 @@ walk: // outer loop for walking the tree
 					}
 
 					// ... but we can't
-					if fixTrailingSlash && len(path) == k+1 {
+					if fixTrailingSlash && len(path) == k+1 && n.handle != nil {
 						return ciPath, true
 					}
 					return ciPath, false
@@ -612,6 +1493,9 @@ walk: // outer loop for walking the tree
 				return ciPath, false
 
 			case catchAll:
+				if !n.matches(path) {
+					return ciPath, false
+				}
 				return append(ciPath, path...), true
 
 			default:
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -54,6 +55,10 @@ func checkRequests(t *testing.T, tree *node, requests testRequests) {
 			if fakeHandlerValue != request.route {
 				t.Errorf("handle mismatch for route '%s': Wrong handle (%s != %s)", request.path, fakeHandlerValue, request.route)
 			}
+
+			if leaf, _, _ := tree.getLeaf(request.path); leaf.fullPath != request.route {
+				t.Errorf("fullPath mismatch for route '%s': Wrong path (%s != %s)", request.path, leaf.fullPath, request.route)
+			}
 		}
 
 		if !reflect.DeepEqual(ps, request.ps) {
@@ -82,6 +87,21 @@ func checkPriorities(t *testing.T, n *node) uint32 {
 	return prio
 }
 
+// checkLeaves checks that the index of the tree rooted at n holds exactly its
+// leaves.
+func checkLeaves(t *testing.T, n *node) {
+	var count int
+	n.walk(func(leaf *node) {
+		count++
+		if n.leaves[leaf.fullPath] != leaf {
+			t.Errorf("leaf '%s' is not indexed", leaf.fullPath)
+		}
+	})
+	if len(n.leaves) != count {
+		t.Errorf("index holds %d leaves, should be %d", len(n.leaves), count)
+	}
+}
+
 func checkMaxParams(t *testing.T, n *node) uint8 {
 	var maxParams uint8
 	for i := range n.children {
@@ -90,7 +110,7 @@ func checkMaxParams(t *testing.T, n *node) uint8 {
 			maxParams = params
 		}
 	}
-	if n.nType > root && !n.wildChild {
+	if n.nType == param || (n.nType == catchAll && !n.wildChild) {
 		maxParams++
 	}
 
@@ -199,6 +219,86 @@ func TestTreeWildcard(t *testing.T) {
 	checkMaxParams(t, tree)
 }
 
+func TestTreeGetAll(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/",
+		"/cmd/:tool/:sub",
+		"/cmd/:tool/",
+		"/src/*filepath",
+		"/search/",
+		"/search/:query",
+		"/user_:name",
+		"/user_:name/about",
+		"/files/:dir/*filepath",
+		"/doc/go1.html",
+		"/info/:user/project/:project",
+		"/items/:id?",
+		"/assets/:name",
+		"/assets/:name.:ext",
+		"/img/:name(\\w+).:ext(png)",
+	}
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	for _, path := range [...]string{
+		"/",
+		"/cmd/test/",
+		"/cmd/test/3",
+		"/src/some/file.png",
+		"/search/",
+		"/search/gopher",
+		"/user_gopher/about",
+		"/files/js/inc/framework.js",
+		"/doc/go1.html",
+		"/info/gordon/project/go",
+		"/items",
+		"/items/42",
+		"/assets/app",
+		"/img/logo.png",
+		"/cmd/test",
+		"/nope",
+	} {
+		var all []*node
+		tree.getAll(path, nil, func(leaf *node, ps Params) {
+			all = append(all, leaf)
+		})
+
+		// the first match is the leaf getLeaf finds
+		leaf, _, _ := tree.getLeaf(path)
+		if leaf == nil && len(all) > 0 {
+			t.Errorf("getAll(%q) found %s, want none", path, all[0].fullPath)
+		} else if leaf != nil && (len(all) != 1 || all[0] != leaf) {
+			t.Errorf("getAll(%q) found %d leaves, want only %s", path, len(all), leaf.fullPath)
+		}
+	}
+
+	// a value with a dot also matches a param followed by an extension param
+	for _, test := range []struct {
+		path  string
+		paths []string
+		ps    []Params
+	}{
+		{"/assets/app.min.js", []string{"/assets/:name.:ext", "/assets/:name"}, []Params{
+			{Param{"name", "app.min"}, Param{"ext", "js"}},
+			{Param{"name", "app.min.js"}},
+		}},
+		{"/img/logo.gif", nil, nil},
+	} {
+		var paths []string
+		var ps []Params
+		tree.getAll(test.path, nil, func(leaf *node, p Params) {
+			paths = append(paths, leaf.fullPath)
+			ps = append(ps, p)
+		})
+		if !reflect.DeepEqual(paths, test.paths) || !reflect.DeepEqual(ps, test.ps) {
+			t.Errorf("getAll(%q) = %v %v, want %v %v", test.path, paths, ps, test.paths, test.ps)
+		}
+	}
+}
+
 func catchPanic(testFunc func()) (recv interface{}) {
 	defer func() {
 		recv = recover()
@@ -233,6 +333,414 @@ func testRoutes(t *testing.T, routes []testRoute) {
 	//printChildren(tree, "")
 }
 
+func TestTreeExtensionParam(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/report.:format",
+		"/files/:name.:ext",
+		"/files/:name.:ext/meta",
+		"/docs/:name",
+		"/docs/:name.:ext",
+		"/user/:name.:ext/",
+		"/img/:name.:ext",
+		"/img/:name",
+	}
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	//printChildren(tree, "")
+
+	checkRequests(t, tree, testRequests{
+		{"/report.json", false, "/report.:format", Params{Param{"format", "json"}}},
+		{"/report.tar.gz", false, "/report.:format", Params{Param{"format", "tar.gz"}}},
+		{"/report", true, "", nil},
+		{"/files/a.json", false, "/files/:name.:ext", Params{Param{"name", "a"}, Param{"ext", "json"}}},
+		{"/files/a.tar.gz", false, "/files/:name.:ext", Params{Param{"name", "a.tar"}, Param{"ext", "gz"}}},
+		{"/files/a.json/meta", false, "/files/:name.:ext/meta", Params{Param{"name", "a"}, Param{"ext", "json"}}},
+		{"/files/a", true, "", Params{Param{"name", "a"}}},
+		{"/files/.json", true, "", Params{Param{"name", ".json"}}},
+		{"/files/a.", true, "", Params{Param{"name", "a."}}},
+		{"/docs/a", false, "/docs/:name", Params{Param{"name", "a"}}},
+		{"/docs/a.json", false, "/docs/:name.:ext", Params{Param{"name", "a"}, Param{"ext", "json"}}},
+		{"/user/a.json/", false, "/user/:name.:ext/", Params{Param{"name", "a"}, Param{"ext", "json"}}},
+		{"/img/a.png", false, "/img/:name.:ext", Params{Param{"name", "a"}, Param{"ext", "png"}}},
+		{"/img/a", false, "/img/:name", Params{Param{"name", "a"}}},
+	})
+
+	checkPriorities(t, tree)
+	checkMaxParams(t, tree)
+
+	// trailing slash recommendations
+	for _, route := range [...]string{"/files/a.json/", "/docs/a.json/", "/user/a.json"} {
+		handler, _, tsr := tree.getValue(route)
+		if handler != nil {
+			t.Fatalf("non-nil handler for TSR route '%s", route)
+		} else if !tsr {
+			t.Errorf("expected TSR recommendation for route '%s'", route)
+		}
+	}
+	for _, route := range [...]string{"/files/a/", "/user/a/"} {
+		handler, _, tsr := tree.getValue(route)
+		if handler != nil {
+			t.Fatalf("non-nil handler for No-TSR route '%s", route)
+		} else if tsr {
+			t.Errorf("expected no TSR recommendation for route '%s'", route)
+		}
+	}
+
+	// case-insensitive lookups keep the case of param values
+	out, found := tree.findCaseInsensitivePath("/FILES/A.JSON/META", true)
+	if !found || string(out) != "/files/A.JSON/meta" {
+		t.Errorf("Wrong result for '/FILES/A.JSON/META': got %s, %t", out, found)
+	}
+}
+
+func TestTreeExtensionParamConflict(t *testing.T) {
+	routes := []testRoute{
+		{"/files/:name.:ext", false},
+		{"/files/:name.:extension", true},
+		{"/files/:name/meta", true},
+		{"/files/:file.:ext", true},
+		{"/docs/:name/meta", false},
+		{"/docs/:name.:ext", true},
+		{"/src/:name.:ext.:x", true},
+		{"/src/:name.:", true},
+	}
+	testRoutes(t, routes)
+}
+
+func TestTreeEscapedWildcard(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		`/ratio/\:1`,
+		`/ratio/\:2/info`,
+		`/ratio/x`,
+		`/time/12\:30`,
+		`/glob/\*.go`,
+		`/user/:name/\:edit`,
+		`/files/\:root/*filepath`,
+		`/a\b`,
+	}
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	//printChildren(tree, "")
+
+	checkRequests(t, tree, testRequests{
+		{"/ratio/:1", false, `/ratio/\:1`, nil},
+		{"/ratio/:2/info", false, `/ratio/\:2/info`, nil},
+		{"/ratio/x", false, `/ratio/x`, nil},
+		{"/ratio/1", true, "", nil},
+		{"/ratio/:3", true, "", nil},
+		{"/time/12:30", false, `/time/12\:30`, nil},
+		{"/glob/*.go", false, `/glob/\*.go`, nil},
+		{"/glob/main.go", true, "", nil},
+		{"/user/gopher/:edit", false, `/user/:name/\:edit`, Params{Param{"name", "gopher"}}},
+		{"/files/:root/a/b", false, `/files/\:root/*filepath`, Params{Param{"filepath", "/a/b"}}},
+		{`/a\b`, false, `/a\b`, nil},
+	})
+
+	checkPriorities(t, tree)
+	checkMaxParams(t, tree)
+}
+
+func TestTreeEscapedWildcardConflict(t *testing.T) {
+	routes := []testRoute{
+		{`/ratio/\:1`, false},
+		{`/ratio/:id`, true},
+		{`/user/:name`, false},
+		{`/user/\:name`, true},
+		{`/src/*filepath`, false},
+		{`/src/\*`, true},
+		{`/time/12\:30`, false},
+		{`/time/12:min`, true},
+		{`/time/12\:*x`, true},
+	}
+	testRoutes(t, routes)
+}
+
+func TestTreeOptionalParam(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/docs/:lang?",
+		"/items/:id?",
+		"/users/:user/:tab?",
+		"/items/:id/edit",
+	}
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	//printChildren(tree, "")
+
+	// the leaves hold the paths the optional param is expanded into
+	for _, request := range []struct {
+		path     string
+		route    string
+		fullPath string
+		ps       Params
+	}{
+		{"/docs", "/docs/:lang?", "/docs", Params{Param{"lang", ""}}},
+		{"/docs/en", "/docs/:lang?", "/docs/:lang", Params{Param{"lang", "en"}}},
+		{"/items", "/items/:id?", "/items", Params{Param{"id", ""}}},
+		{"/items/42", "/items/:id?", "/items/:id", Params{Param{"id", "42"}}},
+		{"/items/42/edit", "/items/:id/edit", "/items/:id/edit", Params{Param{"id", "42"}}},
+		{"/users/gopher", "/users/:user/:tab?", "/users/:user", Params{Param{"user", "gopher"}, Param{"tab", ""}}},
+		{"/users/gopher/repos", "/users/:user/:tab?", "/users/:user/:tab", Params{Param{"user", "gopher"}, Param{"tab", "repos"}}},
+	} {
+		leaf, ps, _ := tree.getLeaf(request.path)
+		if leaf == nil {
+			t.Errorf("handle mismatch for route '%s': Expected non-nil handle", request.path)
+			continue
+		}
+
+		leaf.handle.ServeHTTP(nil, nil)
+		if fakeHandlerValue != request.route {
+			t.Errorf("handle mismatch for route '%s': Wrong handle (%s != %s)", request.path, fakeHandlerValue, request.route)
+		}
+		if leaf.fullPath != request.fullPath {
+			t.Errorf("fullPath mismatch for route '%s': Wrong path (%s != %s)", request.path, leaf.fullPath, request.fullPath)
+		}
+		if !reflect.DeepEqual(ps, request.ps) {
+			t.Errorf("Params mismatch for route '%s': %v != %v", request.path, ps, request.ps)
+		}
+	}
+
+	checkPriorities(t, tree)
+
+	tsrRoutes := [...]string{
+		"/items/",
+		"/users/gopher/",
+	}
+	for _, route := range tsrRoutes {
+		handler, _, tsr := tree.getValue(route)
+		if handler != nil {
+			t.Fatalf("non-nil handler for TSR route '%s", route)
+		} else if !tsr {
+			t.Errorf("expected TSR recommendation for route '%s'", route)
+		}
+	}
+
+	// an optional param at the root
+	tree = &node{}
+	tree.addRoute("/:page?", fakeHandler("/:page?"))
+
+	for _, request := range []struct {
+		path string
+		ps   Params
+	}{
+		{"/", Params{Param{"page", ""}}},
+		{"/about", Params{Param{"page", "about"}}},
+	} {
+		if handler, ps, _ := tree.getValue(request.path); handler == nil {
+			t.Errorf("handle mismatch for route '%s': Expected non-nil handle", request.path)
+		} else if !reflect.DeepEqual(ps, request.ps) {
+			t.Errorf("Params mismatch for route '%s': %v != %v", request.path, ps, request.ps)
+		}
+	}
+}
+
+func TestTreeOptionalParamConflict(t *testing.T) {
+	routes := []testRoute{
+		{"/users/:id?", false},
+		{"/users/:name", true},
+		{"/users/*path", true},
+		{"/a/:b?/c", true},
+		{"/a/x:b?", true},
+		{"/a/:b.:c?", true},
+		{"/a/*b?", true},
+		{"/a/:b?:c", true},
+	}
+	testRoutes(t, routes)
+}
+
+func TestTreeConstraints(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		`/users/:id(\d+)`,
+		`/users/:id(\d+)/edit`,
+		`/files/:name([a-z]+).:ext(json|xml)`,
+		`/items/:id([0-9]+)?`,
+		`/tags/:tag((a|b)+\)?)`,
+	}
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	//printChildren(tree, "")
+
+	for _, request := range []struct {
+		path  string
+		route string
+		ps    Params
+	}{
+		{"/users/42", `/users/:id(\d+)`, Params{Param{"id", "42"}}},
+		{"/users/42/edit", `/users/:id(\d+)/edit`, Params{Param{"id", "42"}}},
+		{"/users/abc", "", nil},
+		{"/users/42abc", "", nil},
+		{"/files/report.json", `/files/:name([a-z]+).:ext(json|xml)`, Params{Param{"name", "report"}, Param{"ext", "json"}}},
+		{"/files/report.txt", "", nil},
+		{"/files/r2.xml", "", nil},
+		{"/items", `/items/:id([0-9]+)?`, Params{Param{"id", ""}}},
+		{"/items/7", `/items/:id([0-9]+)?`, Params{Param{"id", "7"}}},
+		{"/items/x", "", nil},
+		{"/tags/abba)", `/tags/:tag((a|b)+\)?)`, Params{Param{"tag", "abba)"}}},
+		{"/tags/abc", "", nil},
+	} {
+		handler, ps, _ := tree.getValue(request.path)
+		if handler == nil {
+			if request.route != "" {
+				t.Errorf("handle mismatch for route '%s': Expected non-nil handle", request.path)
+			}
+			continue
+		} else if request.route == "" {
+			t.Errorf("handle mismatch for route '%s': Expected nil handle", request.path)
+			continue
+		}
+
+		handler.ServeHTTP(nil, nil)
+		if fakeHandlerValue != request.route {
+			t.Errorf("handle mismatch for route '%s': Wrong handle (%s != %s)", request.path, fakeHandlerValue, request.route)
+		}
+		if !reflect.DeepEqual(ps, request.ps) {
+			t.Errorf("Params mismatch for route '%s': %v != %v", request.path, ps, request.ps)
+		}
+	}
+
+	// the leaves hold the plain path
+	if leaf, _, _ := tree.getLeaf("/users/42"); leaf == nil || leaf.fullPath != "/users/:id" {
+		t.Errorf("wrong fullPath for /users/42: %v", leaf)
+	}
+
+	checkPriorities(t, tree)
+	checkMaxParams(t, tree)
+}
+
+func TestTreeConstraintsInvalid(t *testing.T) {
+	tree := &node{}
+	tree.addRoute(`/users/:id(\d+)`, fakeHandler(`/users/:id(\d+)`))
+
+	tree.addRoute(`/groups/:id/members`, fakeHandler(`/groups/:id/members`))
+
+	for _, route := range []string{
+		`/users/:id([a-z]+)/edit`,
+		`/users/:id/posts`,
+		`/groups/:id(\d+)`,
+		`/posts/:id(\d+`,
+		`/posts/:id([0-9)`,
+	} {
+		recv := catchPanic(func() {
+			tree.addRoute(route, fakeHandler(route))
+		})
+		if err, ok := recv.(*RegistrationError); !ok {
+			t.Errorf("no registration error for route '%s': %v", route, recv)
+		} else if !strings.Contains(err.Message, route) {
+			t.Errorf("error for route '%s' does not name the path: %s", route, err.Message)
+		}
+	}
+
+	// the rejected routes are removed again, the others are not constrained
+	for _, path := range []string{"/users/1/edit", "/users/1/posts", "/groups/1"} {
+		if handler, _, _ := tree.getValue(path); handler != nil {
+			t.Errorf("rejected route matches '%s'", path)
+		}
+	}
+	if handler, _, _ := tree.getValue("/groups/abc/members"); handler == nil {
+		t.Error("unconstrained route does not match '/groups/abc/members'")
+	}
+
+	checkPriorities(t, tree)
+}
+
+func TestExpandPath(t *testing.T) {
+	ps := Params{
+		Param{"name", "gopher"},
+		Param{"ext", "json"},
+		Param{"filepath", "/a/b.go"},
+	}
+
+	for _, test := range []struct {
+		pattern, path string
+	}{
+		{"/", "/"},
+		{"/user/:name", "/user/gopher"},
+		{"/user/:name/", "/user/gopher/"},
+		{"/files/:name.:ext", "/files/gopher.json"},
+		{"/src/*filepath", "/src/a/b.go"},
+		{"/user/:name/src/*filepath", "/user/gopher/src/a/b.go"},
+		{`/ratio/\:1/:name`, "/ratio/:1/gopher"},
+		{"/missing/:id", "/missing/"},
+	} {
+		if path := expandPath(test.pattern, ps); path != test.path {
+			t.Errorf("expandPath(%q) = %q, want %q", test.pattern, path, test.path)
+		}
+	}
+}
+
+func TestTreeMatchers(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/users/:id",
+		"/users/:id/posts",
+		"/img/:name.:ext",
+		"/src/*filepath",
+	}
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	digits := func(s string) bool {
+		for i := 0; i < len(s); i++ {
+			if s[i] < '0' || s[i] > '9' {
+				return false
+			}
+		}
+		return len(s) > 0
+	}
+	tree.setMatchers("/users/:id/posts", map[string]func(string) bool{"id": digits})
+	tree.setMatchers("/img/:name.:ext", map[string]func(string) bool{
+		"ext": func(s string) bool { return s == "png" || s == "gif" },
+	})
+	tree.setMatchers("/src/*filepath", map[string]func(string) bool{
+		"filepath": func(s string) bool { return !strings.Contains(s, "..") },
+	})
+
+	checkRequests(t, tree, testRequests{
+		{"/users/42", false, "/users/:id", Params{Param{"id", "42"}}},
+		{"/users/42/posts", false, "/users/:id/posts", Params{Param{"id", "42"}}},
+		{"/users/bob", true, "", nil},
+		{"/users/bob/posts", true, "", nil},
+		{"/img/a.png", false, "/img/:name.:ext", Params{Param{"name", "a"}, Param{"ext", "png"}}},
+		{"/img/a.jpg", true, "", nil},
+		{"/src/a/b.go", false, "/src/*filepath", Params{Param{"filepath", "/a/b.go"}}},
+		{"/src/a/../b.go", true, "", nil},
+	})
+
+	if handler, _, tsr := tree.getValue("/users/bob/"); handler != nil || tsr {
+		t.Errorf("expected no handle and no TSR recommendation for '/users/bob/'")
+	}
+
+	for _, matchers := range []map[string]func(string) bool{
+		{"id": digits},
+		{"name": digits},
+		{"ext": digits},
+	} {
+		recv := catchPanic(func() {
+			tree.setMatchers("/users/:id", matchers)
+		})
+		if recv == nil {
+			t.Errorf("no panic for invalid matchers %v", matchers)
+		}
+	}
+}
+
 func TestTreeWildcardConflict(t *testing.T) {
 	routes := []testRoute{
 		{"/cmd/:tool/:sub", false},
@@ -359,22 +867,125 @@ func TestTreeDoubleWildcard(t *testing.T) {
 			tree.addRoute(route, nil)
 		})
 
-		if rs, ok := recv.(string); !ok || !strings.HasPrefix(rs, panicMsg) {
+		if err, ok := recv.(*RegistrationError); !ok || err.Kind != KindBadPath ||
+			!strings.HasPrefix(err.Message, panicMsg) {
 			t.Fatalf(`"Expected panic "%s" for route '%s', got "%v"`, panicMsg, route, recv)
 		}
 	}
 }
 
-/*func TestTreeDuplicateWildcard(t *testing.T) {
-	tree := &node{}
-
+func TestTreeDuplicateWildcard(t *testing.T) {
 	routes := [...]string{
 		"/:id/:name/:id",
+		"/:id/*id",
+		"/files/:name.:name",
 	}
 	for _, route := range routes {
-		...
+		tree := &node{}
+		recv := catchPanic(func() {
+			tree.addRoute(route, nil)
+		})
+
+		if err, ok := recv.(*RegistrationError); !ok || err.Kind != KindDuplicateParam {
+			t.Errorf("Expected duplicate param panic for route '%s', got \"%v\"", route, recv)
+		}
+	}
+
+	for _, route := range [...]string{"/:id/:name", `/x/:id/\:id`, "/files/:name.:ext"} {
+		tree := &node{}
+		if recv := catchPanic(func() { tree.addRoute(route, nil) }); recv != nil {
+			t.Errorf("unexpected panic for route '%s': %v", route, recv)
+		}
+	}
+}
+
+// dumpTree returns a description of the structure of the tree that doesn't
+// depend on the order of the children. Param nodes only index their children
+// if they were added in a certain order, so their indices are left out.
+func dumpTree(n *node) string {
+	indices := []byte(n.indices)
+	if n.nType == param {
+		indices = nil
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+
+	children := make([]string, len(n.children))
+	for i, child := range n.children {
+		children[i] = dumpTree(child)
+	}
+	sort.Strings(children)
+
+	return fmt.Sprintf("{%q %d %t %q %q %q [%s]}", n.path, n.nType, n.wildChild,
+		indices, n.fullPath, n.optional, strings.Join(children, " "))
+}
+
+func TestTreeRemove(t *testing.T) {
+	routes := [...]string{
+		"/",
+		"/hi",
+		"/contact",
+		"/co",
+		"/c",
+		"/a",
+		"/ab",
+		"/doc/",
+		"/doc/go_faq.html",
+		"/doc/go1.html",
+		"/α",
+		"/β",
+		"/cmd/:tool/:sub",
+		"/cmd/:tool/",
+		"/src/*filepath",
+		"/search/",
+		"/search/:query",
+		"/user_:name",
+		"/user_:name/about",
+		"/files/:dir/*filepath",
+		"/info/:user/public",
+		"/info/:user/project/:project",
+		"/static/:name.:ext",
+		"/items/:id?",
+	}
+
+	for _, removed := range routes {
+		tree, want := &node{}, &node{}
+		for _, route := range routes {
+			tree.addRoute(route, fakeHandler(route))
+			if route != removed {
+				want.addRoute(route, fakeHandler(route))
+			}
+		}
+
+		paths := []string{removed}
+		if short, long, name := splitOptional(removed); name != "" {
+			paths = []string{long, short}
+		}
+		for _, path := range paths {
+			if !tree.remove(path) {
+				t.Errorf("removing '%s' failed", path)
+			}
+		}
+		if tree.remove(paths[0]) {
+			t.Errorf("removing '%s' twice succeeded", paths[0])
+		}
+
+		if got, want := dumpTree(tree), dumpTree(want); got != want {
+			t.Errorf("tree after removing '%s':\n%s\nwant:\n%s", removed, got, want)
+		}
+		checkPriorities(t, tree)
+		checkLeaves(t, tree)
+		checkLeaves(t, tree.clone())
+	}
+
+	tree := &node{}
+	tree.addRoute("/a/:b", fakeHandler("/a/:b"))
+	if tree.remove("/a/:c") {
+		t.Error("removing an unregistered route succeeded")
+	}
+	if !tree.remove("/a/:b") || tree.handle != nil || len(tree.children) != 0 {
+		t.Errorf("tree not empty after removing its only route: %s", dumpTree(tree))
 	}
-}*/
+}
 
 func TestTreeTrailingSlashRedirect(t *testing.T) {
 	tree := &node{}
@@ -697,3 +1308,15 @@ func TestTreeWildcardConflictEx(t *testing.T) {
 		}
 	}
 }
+
+func BenchmarkTreeGetValueParams(b *testing.B) {
+	tree := &node{}
+	tree.addRoute("/a/:b/c/:d/e/:f/g/:h/*i", fakeHandler("/a/:b/c/:d/e/:f/g/:h/*i"))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree.getValue("/a/1/c/2/e/3/g/4/5/6")
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Route is a registered route, as returned by Handle and its shortcuts.
+type Route struct {
+	router  *Router
+	path    string
+	methods []string
+
+	// candidates are the handles of the route restricted with Query, by
+	// method.
+	candidates map[string]*queryCandidate
+}
+
+// newRoute returns the route registered with the given method and path. cand
+// is the candidate the handle was added as, if any.
+func newRoute(r *Router, path, method string, cand *queryCandidate) *Route {
+	rt := &Route{router: r, path: path, methods: []string{method}}
+	if cand != nil {
+		rt.candidates = map[string]*queryCandidate{method: cand}
+	}
+	return rt
+}
+
+// merge adds the methods of other, a route with the same path, to rt.
+func (rt *Route) merge(other *Route) {
+	rt.methods = append(rt.methods, other.methods...)
+	for method, cand := range other.candidates {
+		if rt.candidates == nil {
+			rt.candidates = make(map[string]*queryCandidate)
+		}
+		rt.candidates[method] = cand
+	}
+}
+
+// Name names the route, so URLs for it can be built with URL and URLAbsolute.
+// The name refers to the path of the route, regardless of the method. It
+// panics if the name is already used for another path or the path already has
+// another name.
+func (rt *Route) Name(name string) *Route {
+	r := rt.router
+	r.lock(rt.path)
+	defer r.mu.Unlock()
+
+	if named, ok := r.names[name]; ok && named.path != rt.path {
+		panic(registrationError(KindConflict, rt.path,
+			"name '"+name+"' is already used for path '"+named.path+"'"))
+	}
+
+	// a path with an optional param names both of its routes
+	plain, constraints := splitConstraints(rt.path)
+	short, long, _ := splitOptional(plain)
+	for _, path := range []string{short, long} {
+		if other, ok := r.pathNames[path]; ok && other != name {
+			panic(registrationError(KindConflict, rt.path,
+				"path '"+path+"' is already named '"+other+"'"))
+		}
+	}
+
+	if r.names == nil {
+		r.names = make(map[string]*namedRoute)
+		r.pathNames = make(map[string]string)
+	}
+	parts := splitPattern(plain)
+	for i, part := range parts {
+		if expr, ok := constraints[part.param]; ok {
+			parts[i].re = compileConstraint(rt.path, part.param, expr)
+		}
+	}
+
+	r.names[name] = &namedRoute{rt.path, parts}
+	r.pathNames[short] = name
+	r.pathNames[long] = name
+	return rt
+}
+
+// removeName removes the name of the given registered path once no route is
+// registered with it for any method.
+func (r *Router) removeName(path string) {
+	for _, route := range r.pending {
+		if route.path == path {
+			return
+		}
+	}
+
+	plain, _ := splitConstraints(path)
+	short, long, _ := splitOptional(plain)
+	for _, root := range r.trees {
+		if root.findLeaf(long) != nil {
+			return
+		}
+	}
+
+	if name, ok := r.pathNames[long]; ok {
+		delete(r.names, name)
+	}
+	delete(r.pathNames, short)
+	delete(r.pathNames, long)
+}
+
+type namedRoute struct {
+	path  string
+	parts []patternPart
+}
+
+// patternPart is a literal part of a path pattern followed by a parameter.
+// The last part of a pattern has no parameter.
+type patternPart struct {
+	literal  string
+	param    string
+	kind     byte // ':' or '*'
+	ext      bool // an extension param, e.g. the second one of :name.:ext
+	optional bool // an optional param, e.g. :id?
+	re       *regexp.Regexp
+}
+
+// splitPattern splits a path pattern into its literal parts and parameters.
+func splitPattern(pattern string) []patternPart {
+	var parts []patternPart
+
+	literal := make([]byte, 0, len(pattern))
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case isEscaped(pattern, i):
+			i++
+			literal = append(literal, pattern[i])
+
+		case c == ':' || c == '*':
+			// find wildcard end (either '/', an extension param or path end)
+			end := i + 1
+			for end < len(pattern) && pattern[end] != '/' &&
+				!(c == ':' && pattern[end] == '.' && end+1 < len(pattern) && pattern[end+1] == ':') {
+				end++
+			}
+
+			// the value of a catch-all includes the '/' before it
+			if c == '*' {
+				literal = literal[:len(literal)-1]
+			}
+
+			part := patternPart{
+				literal: string(literal),
+				param:   pattern[i+1 : end],
+				kind:    c,
+				ext:     i > 0 && pattern[i-1] == '.' && c == ':' && !isEscaped(pattern, i-1),
+			}
+			if strings.HasSuffix(part.param, "?") {
+				part.param = part.param[:len(part.param)-1]
+				part.optional = true
+			}
+			parts = append(parts, part)
+			literal = literal[:0]
+			i = end - 1
+
+		default:
+			literal = append(literal, c)
+		}
+	}
+
+	return append(parts, patternPart{literal: string(literal)})
+}
+
+// URL returns the path of the route of the given name, with its parameters
+// replaced by params in order. The values are percent-encoded as necessary.
+// The value of an optional parameter may be empty or omitted.
+//
+// An error is returned if the number of params does not match the route, or
+// if a value cannot be matched by its parameter, e.g. an empty value or a
+// value containing a '/' for a named parameter, or an empty value for a
+// catch-all parameter.
+//
+//	router.Get("/blog/:category/:post", h).Name("post")
+//	router.URL("post", "go", "routers") // "/blog/go/routers"
+func (r *Router) URL(name string, params ...string) (string, error) {
+	path, err := r.buildPath(name, params)
+	if err != nil {
+		return "", err
+	}
+
+	u := url.URL{Path: path}
+	return u.EscapedPath(), nil
+}
+
+// URLAbsolute is like URL, but returns the absolute URL with the given scheme
+// and host.
+func (r *Router) URLAbsolute(scheme, host, name string, params ...string) (string, error) {
+	if !validScheme(scheme) {
+		return "", errors.New("httprouter: invalid scheme '" + scheme + "'")
+	}
+	if host == "" || strings.ContainsAny(host, "/?#@ ") {
+		return "", errors.New("httprouter: invalid host '" + host + "'")
+	}
+
+	path, err := r.buildPath(name, params)
+	if err != nil {
+		return "", err
+	}
+
+	u := url.URL{Scheme: scheme, Host: host, Path: path}
+	return u.String(), nil
+}
+
+// buildPath returns the unescaped path of the route of the given name, with
+// its parameters replaced by params in order.
+func (r *Router) buildPath(name string, params []string) (string, error) {
+	locked := r.rlock()
+	route, ok := r.names[name]
+	if locked {
+		r.mu.RUnlock()
+	}
+	if !ok {
+		return "", errors.New("httprouter: no route named '" + name + "'")
+	}
+
+	want := len(route.parts) - 1
+	if want > 0 && route.parts[want-1].optional && len(params) == want-1 {
+		params = append(params, "")
+	}
+	if len(params) != want {
+		return "", errors.New("httprouter: route '" + name + "' has " +
+			strconv.Itoa(want) + " params, got " + strconv.Itoa(len(params)))
+	}
+
+	buf := make([]byte, 0, len(route.path))
+	for i, part := range route.parts {
+		buf = append(buf, part.literal...)
+		if part.param == "" {
+			break
+		}
+
+		value := params[i]
+		switch {
+		case part.optional && value == "":
+			// drop the '/' before the absent param, unless it is the root
+			if len(buf) > 1 {
+				buf = buf[:len(buf)-1]
+			}
+		case part.kind == '*':
+			if value == "" {
+				return "", errors.New("httprouter: empty value for catch-all '" +
+					part.param + "' of route '" + name + "'")
+			}
+			if value[0] != '/' {
+				buf = append(buf, '/')
+			}
+		case value == "" || strings.IndexByte(value, '/') >= 0 ||
+			(part.ext && strings.IndexByte(value, '.') >= 0) ||
+			(part.re != nil && !part.re.MatchString(value)):
+			return "", errors.New("httprouter: invalid value '" + value +
+				"' for param '" + part.param + "' of route '" + name + "'")
+		}
+		buf = append(buf, value...)
+	}
+
+	return string(buf), nil
+}
+
+// validScheme reports whether scheme is a valid URL scheme as defined by
+// RFC 3986.
+func validScheme(scheme string) bool {
+	if scheme == "" {
+		return false
+	}
+
+	for i := 0; i < len(scheme); i++ {
+		c := scheme[i]
+		switch {
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' || c == '+' || c == '-' || c == '.':
+			if i == 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRouterURL(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Get("/", handlerFunc).Name("index")
+	router.Get("/blog/:category/:post", handlerFunc).Name("post")
+	router.Get("/files/:name.:ext", handlerFunc).Name("file")
+	router.Get("/static/*filepath", handlerFunc).Name("static")
+	router.Get(`/emoji/\*/:id`, handlerFunc).Name("emoji")
+	router.Get("/items/:id?", handlerFunc).Name("item")
+	router.Get(`/users/:id(\d+)`, handlerFunc).Name("user")
+
+	for _, test := range []struct {
+		name   string
+		params []string
+		url    string
+	}{
+		{"index", nil, "/"},
+		{"post", []string{"go", "routers"}, "/blog/go/routers"},
+		{"post", []string{"go", "100% fast"}, "/blog/go/100%25%20fast"},
+		{"file", []string{"report", "pdf"}, "/files/report.pdf"},
+		{"static", []string{"css/main.css"}, "/static/css/main.css"},
+		{"static", []string{"/css/main.css"}, "/static/css/main.css"},
+		{"emoji", []string{"7"}, "/emoji/%2A/7"},
+		{"item", []string{"42"}, "/items/42"},
+		{"item", []string{""}, "/items"},
+		{"item", nil, "/items"},
+		{"user", []string{"42"}, "/users/42"},
+	} {
+		u, err := router.URL(test.name, test.params...)
+		if err != nil || u != test.url {
+			t.Errorf("URL(%q, %q) = %q, %v; want %q", test.name, test.params, u, err, test.url)
+		}
+	}
+
+	for _, test := range []struct {
+		name   string
+		params []string
+	}{
+		{"missing", nil},
+		{"index", []string{"extra"}},
+		{"post", nil},
+		{"post", []string{"go"}},
+		{"post", []string{"go", "routers", "extra"}},
+		{"static", nil},
+		{"static", []string{""}},
+		{"item", []string{"42", "extra"}},
+		{"item", []string{"a/b"}},
+		{"user", []string{"gopher"}},
+	} {
+		if u, err := router.URL(test.name, test.params...); err == nil {
+			t.Errorf("URL(%q, %q) = %q, want error", test.name, test.params, u)
+		}
+	}
+
+	// an optional param at the root
+	pages := New()
+	pages.Get("/:page?", handlerFunc).Name("page")
+	if u, err := pages.URL("page"); err != nil || u != "/" {
+		t.Errorf(`URL("page") = %q, %v; want "/"`, u, err)
+	}
+
+	// a path can only have a single name
+	recv := catchPanic(func() {
+		router.Get("/", handlerFunc).Name("home")
+	})
+	if recv == nil {
+		t.Error("naming an already named path did not panic")
+	}
+}
+
+func TestRouterURLAbsolute(t *testing.T) {
+	handlerFunc := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	router := New()
+	router.Get("/", handlerFunc).Name("index")
+	router.Get("/blog/:category/:post", handlerFunc).Name("post")
+	router.Get("/files/:name.:ext", handlerFunc).Name("file")
+	router.Get("/src/*filepath", handlerFunc).Name("src")
+	router.Get(`/ratio/\:1/:id`, handlerFunc).Name("ratio")
+
+	for _, test := range []struct {
+		scheme, host, name string
+		params             []string
+		url                string
+	}{
+		{"https", "example.com", "index", nil, "https://example.com/"},
+		{"https", "example.com", "post", []string{"go", "routers"}, "https://example.com/blog/go/routers"},
+		{"http", "example.com:8080", "post", []string{"go", "hello world"}, "http://example.com:8080/blog/go/hello%20world"},
+		{"https", "example.com", "file", []string{"report.tar", "gz"}, "https://example.com/files/report.tar.gz"},
+		{"https", "example.com", "src", []string{"/a/b.go"}, "https://example.com/src/a/b.go"},
+		{"https", "example.com", "src", []string{"a/b.go"}, "https://example.com/src/a/b.go"},
+		{"https", "example.com", "src", []string{"/"}, "https://example.com/src/"},
+		{"https", "example.com", "ratio", []string{"42"}, "https://example.com/ratio/:1/42"},
+	} {
+		u, err := router.URLAbsolute(test.scheme, test.host, test.name, test.params...)
+		if err != nil || u != test.url {
+			t.Errorf("URLAbsolute(%q, %q, %q, %q) = %q, %v; want %q",
+				test.scheme, test.host, test.name, test.params, u, err, test.url)
+		}
+	}
+
+	for _, test := range []struct {
+		scheme, host, name string
+		params             []string
+	}{
+		{"", "example.com", "index", nil},
+		{"1http", "example.com", "index", nil},
+		{"ht tp", "example.com", "index", nil},
+		{"https", "", "index", nil},
+		{"https", "example.com/path", "index", nil},
+		{"https", "user@example.com", "index", nil},
+		{"https", "example.com", "missing", nil},
+		{"https", "example.com", "post", []string{"go"}},
+		{"https", "example.com", "post", []string{"go", "routers", "extra"}},
+		{"https", "example.com", "post", []string{"go", "a/b"}},
+		{"https", "example.com", "post", []string{"go", ""}},
+		{"https", "example.com", "file", []string{"report", "tar.gz"}},
+		{"https", "example.com", "src", []string{""}},
+	} {
+		if u, err := router.URLAbsolute(test.scheme, test.host, test.name, test.params...); err == nil {
+			t.Errorf("URLAbsolute(%q, %q, %q, %q) = %q, want error",
+				test.scheme, test.host, test.name, test.params, u)
+		}
+	}
+
+	// names may be reused for the same path only
+	router.Head("/", handlerFunc).Name("index")
+	recv := catchPanic(func() {
+		router.Get("/about", handlerFunc).Name("index")
+	})
+	if recv == nil {
+		t.Error("reusing a route name for another path did not panic")
+	}
+}